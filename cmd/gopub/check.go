@@ -0,0 +1,360 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"golang.org/x/net/html"
+)
+
+// severity ranks a finding; higher is worse.
+type severity int
+
+const (
+	severityWarning severity = iota + 1
+	severityError
+)
+
+func (s severity) String() string {
+	if s == severityError {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "error":
+		*s = severityError
+	case "warning":
+		*s = severityWarning
+	default:
+		return fmt.Errorf("unknown severity %q", text)
+	}
+	return nil
+}
+
+// finding is a single problem reported by validate.
+type finding struct {
+	Severity severity `json:"severity"`
+	Check    string   `json:"check"`              // container, mimetype, manifest, spine, link, metadata, reader
+	Location string   `json:"location,omitempty"` // path inside the EPUB
+	Message  string   `json:"message"`
+}
+
+func (f finding) String() string {
+	s := fmt.Sprintf("%s [%s] ", f.Severity, f.Check)
+	if f.Location != "" {
+		s += f.Location + ": "
+	}
+	return s + f.Message
+}
+
+const epubMimetype = "application/epub+zip"
+
+// checker collects the findings for one book.
+type checker struct {
+	r        *gopub.ReadCloser
+	files    map[string]*zip.File
+	findings []finding
+}
+
+func (c *checker) report(sev severity, check, location, format string, args ...any) {
+	c.findings = append(c.findings, finding{sev, check, location, fmt.Sprintf(format, args...)})
+}
+
+// checkBook validates the EPUB at name and returns its findings.
+func checkBook(name string) []finding {
+	r, err := gopub.OpenReader(name, gopub.WithLimits(gopub.RecommendedLimits()))
+	if err != nil {
+		return []finding{{severityError, openCheck(err), "", err.Error()}}
+	}
+	defer r.Close()
+
+	c := &checker{r: r, files: make(map[string]*zip.File)}
+	for f := range r.Files() {
+		c.files[f.Name] = f
+	}
+	c.checkMimetype()
+	for _, rf := range r.Rootfiles {
+		c.checkMetadata(rf)
+		c.checkManifest(rf)
+		c.checkProperties(rf)
+		c.checkSpine(rf)
+		c.checkNavigation(rf)
+		c.checkLinks(rf)
+	}
+	// Problems the reader tolerated, including those found by the checks
+	// above while resolving files.
+	for _, w := range r.Warnings() {
+		if !manifestWarning(w) {
+			c.report(severityWarning, "reader", "", "%s", w)
+		}
+	}
+	return c.findings
+}
+
+// manifestWarning reports whether the reader warning w is a duplicate id
+// or a missing file, which checkManifest already reports as errors.
+func manifestWarning(w string) bool {
+	return strings.HasPrefix(w, gopub.ErrDuplicateID.Error()) ||
+		strings.HasPrefix(w, "epub: manifest item ") && strings.Contains(w, " references missing file ")
+}
+
+// openCheck names the check that failed when a book cannot be opened.
+func openCheck(err error) string {
+	switch {
+	case errors.Is(err, gopub.ErrNoContainerfile), errors.Is(err, gopub.ErrBadContainerfile),
+		errors.Is(err, gopub.ErrNoRootfile), errors.Is(err, gopub.ErrBadRootfile):
+		return "container"
+	case errors.Is(err, gopub.ErrNoItemref), errors.Is(err, gopub.ErrBadItemref):
+		return "spine"
+	case errors.Is(err, gopub.ErrBadManifest), errors.Is(err, gopub.ErrDuplicateID):
+		return "manifest"
+	}
+	return "open"
+}
+
+// checkMimetype checks that the archive starts with an uncompressed
+// mimetype entry, as OCF requires.
+func (c *checker) checkMimetype() {
+	var first *zip.File
+	for f := range c.r.Files() {
+		first = f
+		break
+	}
+	if first == nil || first.Name != "mimetype" {
+		c.report(severityError, "mimetype", "mimetype", "mimetype is not the first ZIP entry")
+		if first = c.files["mimetype"]; first == nil {
+			return
+		}
+	}
+	if first.Method != zip.Store {
+		c.report(severityError, "mimetype", "mimetype", "mimetype entry is compressed")
+	}
+	if len(first.Extra) > 0 {
+		c.report(severityWarning, "mimetype", "mimetype", "mimetype entry has an extra field")
+	}
+	rc, err := first.Open()
+	if err != nil {
+		c.report(severityError, "mimetype", "mimetype", "%v", err)
+		return
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, 64))
+	if err != nil {
+		c.report(severityError, "mimetype", "mimetype", "%v", err)
+	} else if string(data) != epubMimetype {
+		c.report(severityError, "mimetype", "mimetype", "mimetype is %q, want %q", data, epubMimetype)
+	}
+}
+
+func (c *checker) checkMetadata(rf *gopub.Rootfile) {
+	md := &rf.Metadata
+	if md.MainTitle().Name == "" {
+		c.report(severityError, "metadata", rf.FullPath, "missing dc:title")
+	}
+	if len(md.Identifier) == 0 {
+		c.report(severityError, "metadata", rf.FullPath, "missing dc:identifier")
+	}
+	if md.PrimaryLanguage() == "" {
+		c.report(severityError, "metadata", rf.FullPath, "missing dc:language")
+	}
+	if rf.UniqueIdentifier == "" {
+		c.report(severityError, "metadata", rf.FullPath, "package has no unique-identifier attribute")
+	}
+	if strings.HasPrefix(rf.Version, "3") && md.Modified == "" {
+		c.report(severityWarning, "metadata", rf.FullPath, "missing dcterms:modified")
+	}
+	if len(md.Creator) == 0 {
+		c.report(severityWarning, "metadata", rf.FullPath, "missing dc:creator")
+	}
+}
+
+func (c *checker) checkManifest(rf *gopub.Rootfile) {
+	seen := make(map[string]bool)
+	listed := make(map[string]bool)
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		if seen[item.ID] {
+			c.report(severityError, "manifest", rf.FullPath, "%v %q", gopub.ErrDuplicateID, item.ID)
+		}
+		seen[item.ID] = true
+		if item.MediaType == "" {
+			c.report(severityError, "manifest", rf.FullPath, "manifest item %q has no media-type", item.ID)
+		}
+		if item.F == nil {
+			c.report(severityError, "manifest", c.resolve(rf.FullPath, item.HREF),
+				"manifest item %q references a missing file", item.ID)
+			continue
+		}
+		listed[item.F.Name] = true
+	}
+
+	dir := path.Dir(rf.FullPath)
+	for f := range c.r.Files() {
+		name := f.Name
+		if dir != "." && !strings.HasPrefix(name, dir+"/") {
+			continue
+		}
+		if listed[name] || name == "mimetype" || name == rf.FullPath ||
+			strings.HasPrefix(name, "META-INF/") || strings.HasSuffix(name, "/") || c.isRootfile(name) {
+			continue
+		}
+		c.report(severityWarning, "manifest", name, "file is not listed in the manifest")
+	}
+}
+
+// checkProperties compares the content properties of the XHTML items of
+// an EPUB 3 package with those their content needs.
+func (c *checker) checkProperties(rf *gopub.Rootfile) {
+	if !strings.HasPrefix(rf.Version, "3") {
+		return
+	}
+	reports, err := rf.AnalyzeProperties()
+	if err != nil {
+		c.report(severityError, "manifest", rf.FullPath, "%v", err)
+		return
+	}
+	for _, p := range reports {
+		if len(p.Missing) > 0 {
+			c.report(severityError, "manifest", p.Item.F.Name, "manifest item %q lacks properties %s",
+				p.Item.ID, strings.Join(p.Missing, " "))
+		}
+		if len(p.Unneeded) > 0 {
+			c.report(severityWarning, "manifest", p.Item.F.Name, "manifest item %q declares unneeded properties %s",
+				p.Item.ID, strings.Join(p.Unneeded, " "))
+		}
+	}
+}
+
+func (c *checker) isRootfile(name string) bool {
+	for _, rf := range c.r.Rootfiles {
+		if rf.FullPath == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) checkSpine(rf *gopub.Rootfile) {
+	seen := make(map[string]bool)
+	for i := range rf.Spine.Itemrefs {
+		ref := &rf.Spine.Itemrefs[i]
+		if seen[ref.IDREF] {
+			c.report(severityError, "spine", rf.FullPath, "itemref %q appears more than once", ref.IDREF)
+		}
+		seen[ref.IDREF] = true
+		switch ref.ManifestItem.MediaType {
+		case "application/xhtml+xml", "image/svg+xml":
+		default:
+			c.report(severityWarning, "spine", rf.FullPath, "spine item %q has media type %q, not a content document",
+				ref.IDREF, ref.ManifestItem.MediaType)
+		}
+	}
+	linear := 0
+	for range rf.Spine.Linear() {
+		linear++
+	}
+	if linear == 0 {
+		c.report(severityError, "spine", rf.FullPath, "spine has no linear items")
+	}
+}
+
+func (c *checker) checkNavigation(rf *gopub.Rootfile) {
+	if strings.HasPrefix(rf.Version, "3") {
+		if rf.TOCNav() == nil {
+			c.report(severityError, "navigation", rf.FullPath, "EPUB 3 package has no toc nav document")
+		}
+	} else if len(rf.NCX.NavPoints) == 0 {
+		c.report(severityError, "navigation", rf.FullPath, "EPUB 2 package has no NCX table of contents")
+	}
+}
+
+// checkLinks reports internal links to files that do not exist, in content
+// documents (including the nav document) and the NCX.
+func (c *checker) checkLinks(rf *gopub.Rootfile) {
+	for item := range rf.Manifest.ByMediaType("application/xhtml+xml", "text/html") {
+		if item.F != nil {
+			c.checkDocumentLinks(item)
+		}
+	}
+
+	for item := range rf.Manifest.ByMediaType("application/x-dtbncx+xml") {
+		if item.F == nil {
+			continue
+		}
+		for _, point := range rf.NCX.Walk() {
+			c.checkLink(item.F.Name, point.Content.Src)
+		}
+	}
+}
+
+// linkAttrs lists the attributes of content documents that reference other
+// resources.
+var linkAttrs = map[string]bool{"href": true, "src": true, "poster": true, "data": true}
+
+func (c *checker) checkDocumentLinks(item *gopub.ManifestItem) {
+	rc, err := item.Open()
+	if err != nil {
+		c.report(severityError, "link", item.F.Name, "%v", err)
+		return
+	}
+	defer rc.Close()
+
+	z := html.NewTokenizer(rc)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				c.report(severityError, "link", item.F.Name, "%v", err)
+			}
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for {
+				key, val, more := z.TagAttr()
+				if linkAttrs[strings.TrimPrefix(string(key), "xlink:")] {
+					c.checkLink(item.F.Name, string(val))
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
+
+// checkLink reports href, relative to the ZIP entry from, if it is an
+// internal link to a file missing from the archive.
+func (c *checker) checkLink(from, href string) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		c.report(severityError, "link", from, "malformed link %q", href)
+		return
+	}
+	if u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return
+	}
+	target := path.Join(path.Dir(from), u.Path)
+	if c.files[target] == nil {
+		c.report(severityError, "link", from, "link %q references missing file %q", href, target)
+	}
+}
+
+// resolve returns the ZIP path of href relative to the ZIP entry base.
+func (c *checker) resolve(base, href string) string {
+	if p, err := url.PathUnescape(href); err == nil {
+		href = p
+	}
+	return path.Join(path.Dir(base), href)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+func runLs(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("ls", stderr)
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	r, err := openBook(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	for n, rf := range r.Rootfiles {
+		if len(r.Rootfiles) > 1 {
+			if n > 0 {
+				fmt.Fprintln(tw)
+			}
+			fmt.Fprintf(tw, "%s:\n", rf.FullPath)
+		}
+		fmt.Fprintln(tw, "ID\tMEDIA TYPE\tSIZE\tHREF")
+		for _, item := range rf.Manifest.Items {
+			size := "missing"
+			if item.F != nil {
+				size = fmt.Sprint(item.F.UncompressedSize64)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", item.ID, item.MediaType, size, item.HREF)
+		}
+	}
+	return tw.Flush()
+}
+
+func runCat(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("cat", stderr)
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+
+	r, err := openBook(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	item := findItem(r, fs.Arg(1))
+	if item == nil {
+		return fmt.Errorf("no manifest item with id or href %q", fs.Arg(1))
+	}
+	f, err := item.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(stdout, f)
+	return err
+}
+
+// findItem returns the manifest item with the given id, href or ZIP path,
+// searching every rendition.
+func findItem(r *gopub.ReadCloser, ref string) *gopub.ManifestItem {
+	for _, rf := range r.Rootfiles {
+		for i := range rf.Manifest.Items {
+			if rf.Manifest.Items[i].ID == ref {
+				return &rf.Manifest.Items[i]
+			}
+		}
+	}
+	for _, rf := range r.Rootfiles {
+		for i := range rf.Manifest.Items {
+			item := &rf.Manifest.Items[i]
+			if item.HREF == ref || path.Join(path.Dir(rf.FullPath), item.HREF) == ref {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func runCover(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("cover", stderr)
+	out := fs.String("o", "", "output file, or - for stdout")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	if *out == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	r, err := openBook(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cover, err := r.GetCover()
+	if err != nil {
+		return err
+	}
+	src, err := cover.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if *out == "-" {
+		_, err = io.Copy(stdout, src)
+		return err
+	}
+	dst, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
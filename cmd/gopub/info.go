@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+type bookInfo struct {
+	File       string          `json:"file"`
+	Renditions []renditionInfo `json:"renditions"`
+}
+
+type renditionInfo struct {
+	Path        string   `json:"path"`
+	Version     string   `json:"version"`
+	Title       string   `json:"title"`
+	Creators    []string `json:"creators,omitempty"`
+	Languages   []string `json:"languages,omitempty"`
+	Identifiers []string `json:"identifiers,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+	Series      string   `json:"series,omitempty"`
+	SeriesIndex string   `json:"seriesIndex,omitempty"`
+	Modified    string   `json:"modified,omitempty"`
+	Spine       struct {
+		Items  int `json:"items"`
+		Linear int `json:"linear"`
+	} `json:"spine"`
+	TOC struct {
+		Source  string `json:"source,omitempty"` // "nav" or "ncx"
+		Entries int    `json:"entries"`
+		Depth   int    `json:"depth"`
+	} `json:"toc"`
+}
+
+func runInfo(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("info", stderr)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	r, err := openBook(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	info := bookInfo{File: fs.Arg(0)}
+	for _, rf := range r.Rootfiles {
+		info.Renditions = append(info.Renditions, describeRendition(rf))
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	printInfo(stdout, info)
+	return nil
+}
+
+func describeRendition(rf *gopub.Rootfile) renditionInfo {
+	md := &rf.Metadata
+	ri := renditionInfo{
+		Path:        rf.FullPath,
+		Version:     rf.Version,
+		Title:       md.MainTitle().Name,
+		Languages:   md.Language,
+		Publisher:   md.PrimaryPublisher().Name,
+		Series:      md.Series,
+		SeriesIndex: md.SeriesIndex,
+		Modified:    md.Modified,
+	}
+	for _, c := range md.Creator {
+		ri.Creators = append(ri.Creators, c.Name)
+	}
+	for _, id := range md.Identifier {
+		ri.Identifiers = append(ri.Identifiers, id.Value)
+	}
+
+	ri.Spine.Items = len(rf.Spine.Itemrefs)
+	for range rf.Spine.Linear() {
+		ri.Spine.Linear++
+	}
+
+	if toc := rf.TOCNav(); toc != nil {
+		ri.TOC.Source = "nav"
+		for pos := range toc.Walk() {
+			ri.TOC.Entries++
+			ri.TOC.Depth = max(ri.TOC.Depth, pos.Depth+1)
+		}
+	} else if len(rf.NCX.NavPoints) > 0 {
+		ri.TOC.Source = "ncx"
+		for pos := range rf.NCX.Walk() {
+			ri.TOC.Entries++
+			ri.TOC.Depth = max(ri.TOC.Depth, pos.Depth+1)
+		}
+	}
+	return ri
+}
+
+func printInfo(w io.Writer, info bookInfo) {
+	fmt.Fprintf(w, "File:        %s\n", info.File)
+	fmt.Fprintf(w, "Renditions:  %d\n", len(info.Renditions))
+	for _, ri := range info.Renditions {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Rendition:   %s (EPUB %s)\n", ri.Path, ri.Version)
+		fmt.Fprintf(w, "Title:       %s\n", ri.Title)
+		printList(w, "Creators:", ri.Creators)
+		printList(w, "Languages:", ri.Languages)
+		printList(w, "Identifiers:", ri.Identifiers)
+		if ri.Publisher != "" {
+			fmt.Fprintf(w, "Publisher:   %s\n", ri.Publisher)
+		}
+		if ri.Series != "" {
+			series := ri.Series
+			if ri.SeriesIndex != "" {
+				series += " #" + ri.SeriesIndex
+			}
+			fmt.Fprintf(w, "Series:      %s\n", series)
+		}
+		if ri.Modified != "" {
+			fmt.Fprintf(w, "Modified:    %s\n", ri.Modified)
+		}
+		fmt.Fprintf(w, "Spine:       %d items (%d linear)\n", ri.Spine.Items, ri.Spine.Linear)
+		if ri.TOC.Source == "" {
+			fmt.Fprintln(w, "TOC:         none")
+		} else {
+			fmt.Fprintf(w, "TOC:         %d entries from %s, depth %d\n", ri.TOC.Entries, ri.TOC.Source, ri.TOC.Depth)
+		}
+	}
+}
+
+func printList(w io.Writer, label string, values []string) {
+	if len(values) > 0 {
+		fmt.Fprintf(w, "%-12s %s\n", label, strings.Join(values, "; "))
+	}
+}
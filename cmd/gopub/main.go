@@ -0,0 +1,126 @@
+// Command gopub inspects EPUB files.
+//
+// Usage:
+//
+//	gopub info [-json] book.epub
+//	gopub ls book.epub
+//	gopub cat book.epub <href|id>
+//	gopub cover -o cover.jpg book.epub
+//	gopub validate [-format text|json|junit] [-j n] book.epub...
+//
+// validate exits with status 1 if any book has errors and 3 if there are
+// only warnings.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+// command is a gopub subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"info", "[-json] book.epub", "print metadata, renditions, spine and TOC summary", runInfo},
+		{"ls", "book.epub", "list manifest items with media types and sizes", runLs},
+		{"cat", "book.epub <href|id>", "write a manifest item to stdout", runCat},
+		{"cover", "-o file book.epub", "extract the declared cover image", runCover},
+		{"validate", "[-format text|json|junit] [-j n] book.epub...", "check books for structural problems", runValidate},
+	}
+}
+
+// errUsage reports invalid arguments; the usage has already been printed.
+var errUsage = errors.New("usage")
+
+// exitCode makes run exit with the given status without printing an error.
+type exitCode int
+
+func (c exitCode) Error() string { return fmt.Sprintf("exit status %d", int(c)) }
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand named by args[0] and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(args[1:], stdout, stderr)
+		var code exitCode
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		case errors.As(err, &code):
+			return int(code)
+		default:
+			fmt.Fprintf(stderr, "gopub %s: %v\n", cmd.name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(stderr, "gopub: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gopub <command> [arguments]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// newFlagSet returns a flag set for the named command that prints its
+// usage to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("gopub "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(stderr, "usage: gopub %s %s\n", cmd.name, cmd.args)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses args into fs and checks that n positional arguments
+// remain.
+func parseArgs(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// openBook opens an EPUB with the limits recommended for untrusted input.
+func openBook(name string) (*gopub.ReadCloser, error) {
+	return gopub.OpenReader(name, gopub.WithLimits(gopub.RecommendedLimits()))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBook = "../../gopub/_test_files/alice.epub"
+
+func runCmd(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestInfo(t *testing.T) {
+	out, errOut, code := runCmd(t, "info", testBook)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, errOut)
+	}
+	for _, want := range []string{"Alice's Adventures in Wonderland", "Lewis Carroll", "EPUB 2.0", "entries from ncx"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("info output missing %q:\n%s", want, out)
+		}
+	}
+
+	out, _, code = runCmd(t, "info", "-json", testBook)
+	var info bookInfo
+	if err := json.Unmarshal([]byte(out), &info); err != nil || code != 0 {
+		t.Fatalf("exit %d: %v", code, err)
+	}
+	ri := info.Renditions[0]
+	if ri.Spine.Items != ri.Spine.Linear+1 || ri.TOC.Source != "ncx" || ri.TOC.Entries == 0 {
+		t.Errorf("unexpected summary %+v", ri)
+	}
+}
+
+func TestLsAndCat(t *testing.T) {
+	out, _, code := runCmd(t, "ls", testBook)
+	if code != 0 || !strings.Contains(out, "item1") || !strings.Contains(out, "53530") {
+		t.Errorf("exit %d:\n%s", code, out)
+	}
+
+	byID, _, code := runCmd(t, "cat", testBook, "item1")
+	if code != 0 || len(byID) != 53530 {
+		t.Errorf("cat by id: exit %d, %d bytes", code, len(byID))
+	}
+	byPath, _, _ := runCmd(t, "cat", testBook, "OEBPS/@public@vhost@g@gutenberg@html@files@28885@28885-h@images@cover.jpg")
+	if byPath != byID {
+		t.Error("cat by ZIP path differs from cat by id")
+	}
+	if _, _, code := runCmd(t, "cat", testBook, "nope"); code != 1 {
+		t.Errorf(expFormat, 1, code)
+	}
+}
+
+func TestCover(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "cover.jpg")
+	if _, errOut, code := runCmd(t, "cover", "-o", out, testBook); code != 0 {
+		t.Fatalf("exit %d: %s", code, errOut)
+	}
+	if fi, err := os.Stat(out); err != nil || fi.Size() != 53530 {
+		t.Errorf("cover file: %v", err)
+	}
+	if _, _, code := runCmd(t, "cover", testBook); code != 2 {
+		t.Errorf(expFormat, 2, code)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"bogus"}, {"info"}} {
+		if _, _, code := runCmd(t, args...); code != 2 {
+			t.Errorf("%v: "+expFormat, args, 2, code)
+		}
+	}
+}
+
+const expFormat = "Expected: %v, but got: %v\n"
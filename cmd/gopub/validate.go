@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Exit codes of gopub validate.
+const (
+	exitInvalid  = 1 // at least one error
+	exitWarnings = 3 // warnings but no errors
+)
+
+// bookReport holds the findings for one validated file.
+type bookReport struct {
+	File     string    `json:"file"`
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Findings []finding `json:"findings"`
+}
+
+type validateReport struct {
+	Errors   int          `json:"errors"`
+	Warnings int          `json:"warnings"`
+	Books    []bookReport `json:"books"`
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", stderr)
+	format := fs.String("format", "text", "output format: text, json or junit")
+	jobs := fs.Int("j", runtime.GOMAXPROCS(0), "number of files validated in parallel")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 || *jobs < 1 {
+		fs.Usage()
+		return errUsage
+	}
+	var write func(io.Writer, *validateReport) error
+	switch *format {
+	case "text":
+		write = writeText
+	case "json":
+		write = writeJSON
+	case "junit":
+		write = writeJUnit
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	report := validate(fs.Args(), *jobs)
+	if err := write(stdout, report); err != nil {
+		return err
+	}
+	switch {
+	case report.Errors > 0:
+		return exitCode(exitInvalid)
+	case report.Warnings > 0:
+		return exitCode(exitWarnings)
+	}
+	return nil
+}
+
+// validate checks files with up to jobs workers, keeping the input order.
+func validate(files []string, jobs int) *validateReport {
+	report := &validateReport{Books: make([]bookReport, len(files))}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, len(files)) {
+		wg.Go(func() {
+			for i := range next {
+				report.Books[i] = newBookReport(files[i], checkBook(files[i]))
+			}
+		})
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, b := range report.Books {
+		report.Errors += b.Errors
+		report.Warnings += b.Warnings
+	}
+	return report
+}
+
+func newBookReport(file string, findings []finding) bookReport {
+	b := bookReport{File: file, Findings: findings}
+	if b.Findings == nil {
+		b.Findings = []finding{}
+	}
+	for _, f := range findings {
+		if f.Severity == severityError {
+			b.Errors++
+		} else {
+			b.Warnings++
+		}
+	}
+	return b
+}
+
+func writeText(w io.Writer, report *validateReport) error {
+	for _, b := range report.Books {
+		if len(b.Findings) == 0 {
+			fmt.Fprintf(w, "%s: OK\n", b.File)
+		}
+		for _, f := range b.Findings {
+			fmt.Fprintf(w, "%s: %s\n", b.File, f)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d files, %d errors, %d warnings\n", len(report.Books), report.Errors, report.Warnings)
+	return err
+}
+
+func writeJSON(w io.Writer, report *validateReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// JUnit XML: one test case per file, failing if it has errors. Warnings
+// are listed in the test case's system-out.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, report *validateReport) error {
+	suite := junitSuite{Name: "gopub validate", Tests: len(report.Books)}
+	for _, b := range report.Books {
+		tc := junitCase{Name: b.File, ClassName: "gopub.validate"}
+		var errs, warns []string
+		for _, f := range b.Findings {
+			if f.Severity == severityError {
+				errs = append(errs, f.String())
+			} else {
+				warns = append(warns, f.String())
+			}
+		}
+		if len(errs) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d errors", len(errs)),
+				Type:    "error",
+				Text:    strings.Join(errs, "\n"),
+			}
+		}
+		tc.SystemOut = strings.Join(warns, "\n")
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
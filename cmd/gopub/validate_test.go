@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBook writes an EPUB with the given entries, mimetype first, and
+// returns its path.
+func writeBook(t *testing.T, files map[string]string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	w.Write([]byte("application/epub+zip"))
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return name
+}
+
+const brokenOPF = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Broken</dc:title>
+    <dc:identifier id="uid">urn:uuid:1</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav scripted"/>
+    <item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch" href="gone.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="ch"/></spine>
+</package>`
+
+func brokenBook(t *testing.T) string {
+	return writeBook(t, map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": brokenOPF,
+		"OEBPS/nav.xhtml": `<html xmlns:epub="http://www.idpf.org/2007/ops"><body>
+<nav epub:type="toc"><ol><li><a href="ch.xhtml">One</a></li></ol></nav></body></html>`,
+		"OEBPS/ch.xhtml": `<html><body><a href="missing.xhtml#x">x</a><a href="http://example.com/">y</a>
+<img src="img/ok.png"/><a href="#top">top</a><script>go()</script></body></html>`,
+		"OEBPS/img/ok.png": "png",
+		"OEBPS/extra.css":  "",
+	})
+}
+
+func TestValidate(t *testing.T) {
+	book := brokenBook(t)
+	out, _, code := runCmd(t, "validate", testBook, book)
+	if code != exitInvalid {
+		t.Errorf(expFormat, exitInvalid, code)
+	}
+	for _, want := range []string{
+		"alice.epub: OK",
+		"duplicate manifest item id",
+		`references missing file "OEBPS/missing.xhtml"`,
+		"missing dc:language",
+		"warning [manifest] OEBPS/extra.css",
+		"warning [manifest] OEBPS/img/ok.png",
+		`error [manifest] OEBPS/ch.xhtml: manifest item "ch" lacks properties scripted`,
+		`warning [manifest] OEBPS/nav.xhtml: manifest item "nav" declares unneeded properties scripted`,
+		"2 files, 5 errors, 5 warnings",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[reader]") {
+		t.Errorf("manifest problems reported again as reader warnings:\n%s", out)
+	}
+	if strings.Contains(out, "example.com") || strings.Contains(out, "#top") {
+		t.Errorf("external or fragment-only link reported:\n%s", out)
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	book := brokenBook(t)
+	out, _, _ := runCmd(t, "validate", "-format", "json", "-j", "1", book, testBook)
+	var report validateReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Books) != 2 || report.Books[0].File != book || report.Books[1].Errors != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	out, _, _ = runCmd(t, "validate", "-format", "junit", book, testBook)
+	var suites junitSuites
+	if err := xml.Unmarshal([]byte(out), &suites); err != nil {
+		t.Fatal(err)
+	}
+	s := suites.Suites[0]
+	if s.Tests != 2 || s.Failures != 1 || s.Cases[0].Failure == nil || s.Cases[1].Failure != nil {
+		t.Errorf("unexpected suite %+v", s)
+	}
+
+	if _, _, code := runCmd(t, "validate", "-format", "yaml", book); code != 2 {
+		t.Errorf(expFormat, 2, code)
+	}
+}
+
+func TestValidateExitCodes(t *testing.T) {
+	if _, _, code := runCmd(t, "validate", filepath.Join(t.TempDir(), "none.epub")); code != exitInvalid {
+		t.Errorf(expFormat, exitInvalid, code)
+	}
+	if _, _, code := runCmd(t, "validate", testBook); code != 0 {
+		t.Errorf(expFormat, 0, code)
+	}
+}
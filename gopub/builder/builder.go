@@ -0,0 +1,655 @@
+// Package builder assembles an EPUB 3 book from Markdown and HTML chapter
+// files. Chapters are split into content documents at headings, images
+// they reference are copied into the book, and both an EPUB 3 navigation
+// document and an EPUB 2 NCX are generated from the headings.
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/uuid"
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoChapters is returned by Build when no chapter files are given.
+var ErrNoChapters = errors.New("builder: no chapters")
+
+// Defaults for Options fields left zero.
+const (
+	DefaultSplitLevel = 1
+	DefaultTOCDepth   = 3
+)
+
+// Paths of the generated files, relative to the package document.
+const (
+	opfDir         = "OEBPS"
+	navHREF        = "nav.xhtml"
+	ncxHREF        = "toc.ncx"
+	stylesheetHREF = "style.css"
+	coverHREF      = "cover.xhtml"
+	imageDir       = "images"
+)
+
+// DefaultStylesheet is the stylesheet used when Options.Stylesheet is empty.
+const DefaultStylesheet = `body { margin: 0 5%; line-height: 1.4; }
+h1, h2, h3, h4, h5, h6 { line-height: 1.2; page-break-after: avoid; }
+pre { white-space: pre-wrap; font-size: 0.9em; }
+img { max-width: 100%; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.2em 0.4em; }
+blockquote { margin: 1em 1.5em; }
+.cover { text-align: center; }
+.cover img { max-height: 95vh; }
+`
+
+// Options configures Build.
+type Options struct {
+	// Metadata describes the book. A missing identifier is generated as a
+	// urn:uuid, a missing title is taken from the first heading, the
+	// language defaults to "und" and Modified to the current time.
+	Metadata gopub.Metadata
+	// SplitLevel is the deepest heading level that starts a new content
+	// document; headings below it stay in the current one. Only headings
+	// at the top level of a chapter's body split. Defaults to
+	// DefaultSplitLevel; a negative value keeps each chapter in one
+	// document.
+	SplitLevel int
+	// TOCDepth is the deepest heading level listed in the table of
+	// contents. Defaults to DefaultTOCDepth.
+	TOCDepth int
+	// Cover is the path of a cover image, added with a cover page.
+	Cover string
+	// Stylesheet replaces DefaultStylesheet.
+	Stylesheet string
+	// FS is the file system chapter, image and cover paths are read from,
+	// as slash-separated paths. If nil, they are OS paths.
+	FS fs.FS
+}
+
+// Build reads the chapter files in order and writes an EPUB 3 book to w.
+// Files ending in .md or .markdown are read as Markdown, anything else as
+// HTML or XHTML, of which only the body is used. Relative links between
+// chapters are rewritten to the documents they end up in; images are
+// stored under images/ in the book.
+func Build(w io.Writer, chapters []string, opts *Options) error {
+	if len(chapters) == 0 {
+		return ErrNoChapters
+	}
+	b := newBook(opts)
+	for _, name := range chapters {
+		if err := b.addChapter(name); err != nil {
+			return err
+		}
+	}
+	b.assignIDs()
+	if err := b.rewrite(); err != nil {
+		return err
+	}
+	return b.write(w)
+}
+
+// BuildFile is like Build but writes the book to the file name.
+func BuildFile(name string, chapters []string, opts *Options) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = Build(f, chapters, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// document is a content document produced from (part of) a chapter.
+type document struct {
+	href    string
+	chapter string // slash-separated chapter path
+	nodes   []*html.Node
+	title   string
+}
+
+// resource is an image copied into the book.
+type resource struct {
+	id, href, mediaType, properties string
+	data                            []byte
+}
+
+type book struct {
+	opts Options
+
+	docs      []*document
+	chapters  map[string][]*document // by chapter path
+	byID      map[string]*document   // "chapter#id" -> document
+	resources []*resource
+	bySource  map[string]*resource
+	names     map[string]bool // used image file names
+}
+
+func newBook(opts *Options) *book {
+	b := &book{
+		chapters: make(map[string][]*document),
+		byID:     make(map[string]*document),
+		bySource: make(map[string]*resource),
+		names:    make(map[string]bool),
+	}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.SplitLevel == 0 {
+		b.opts.SplitLevel = DefaultSplitLevel
+	}
+	if b.opts.TOCDepth == 0 {
+		b.opts.TOCDepth = DefaultTOCDepth
+	}
+	if b.opts.Stylesheet == "" {
+		b.opts.Stylesheet = DefaultStylesheet
+	}
+	return b
+}
+
+// slashPath returns name as a slash-separated path.
+func (b *book) slashPath(name string) string {
+	if b.opts.FS != nil {
+		return name
+	}
+	return filepath.ToSlash(name)
+}
+
+func (b *book) readFile(name string) ([]byte, error) {
+	if b.opts.FS != nil {
+		return fs.ReadFile(b.opts.FS, name)
+	}
+	return os.ReadFile(filepath.FromSlash(name))
+}
+
+// addChapter parses a chapter file and splits it into documents.
+func (b *book) addChapter(name string) error {
+	name = b.slashPath(name)
+	data, err := b.readFile(name)
+	if err != nil {
+		return err
+	}
+	var root *html.Node
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		root, err = html.Parse(strings.NewReader(markdownToHTML(string(data))))
+	default:
+		root, err = xhtml.Parse(bytes.NewReader(data))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	body := xhtml.Find(root, atom.Body)
+	if body == nil {
+		body = root
+	}
+
+	var doc *document
+	for c := body.FirstChild; c != nil; {
+		next := c.NextSibling
+		body.RemoveChild(c)
+		if doc == nil || level(c) > 0 && level(c) <= b.opts.SplitLevel && hasContent(doc.nodes) {
+			doc = &document{chapter: name}
+			b.docs = append(b.docs, doc)
+			b.chapters[name] = append(b.chapters[name], doc)
+		}
+		doc.nodes = append(doc.nodes, c)
+		c = next
+	}
+	if doc == nil {
+		doc = &document{chapter: name}
+		b.docs = append(b.docs, doc)
+		b.chapters[name] = append(b.chapters[name], doc)
+	}
+	return nil
+}
+
+// level returns the heading level of n, or 0 if it is not a heading.
+func level(n *html.Node) int {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return int(n.Data[1] - '0')
+	}
+	return 0
+}
+
+func hasContent(nodes []*html.Node) bool {
+	for _, n := range nodes {
+		if n.Type == html.ElementNode || n.Type == html.TextNode && strings.TrimSpace(n.Data) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// assignIDs names the documents, records where every id ended up and gives
+// headings without an id one derived from their text.
+func (b *book) assignIDs() {
+	for i, doc := range b.docs {
+		doc.href = fmt.Sprintf("ch%03d.xhtml", i+1)
+	}
+	for chapter, docs := range b.chapters {
+		used := make(map[string]bool)
+		for _, doc := range docs {
+			for _, n := range doc.nodes {
+				xhtml.Walk(n, func(n *html.Node) {
+					if id := xhtml.Attr(n, "id"); id != "" {
+						used[id] = true
+						b.byID[chapter+"#"+id] = doc
+					}
+				})
+			}
+		}
+		for _, doc := range docs {
+			for _, n := range doc.nodes {
+				xhtml.Walk(n, func(n *html.Node) {
+					if level(n) == 0 || xhtml.Attr(n, "id") != "" {
+						return
+					}
+					id := xhtml.UniqueName(used, slug(textOf(n)))
+					n.Attr = append(n.Attr, html.Attribute{Key: "id", Val: id})
+					b.byID[chapter+"#"+id] = doc
+				})
+				if doc.title == "" && level(n) > 0 {
+					doc.title = textOf(n)
+				}
+			}
+		}
+	}
+}
+
+// slug returns an id for a heading with the given text.
+func slug(text string) string {
+	parts := strings.FieldsFunc(xhtml.AnchorName(text), func(r rune) bool { return r == '-' })
+	s := strings.Join(parts, "-")
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "h-" + s
+	}
+	return strings.TrimSuffix(s, "-")
+}
+
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// rewrite points links between chapters at the documents holding their
+// targets and copies local images into the book.
+func (b *book) rewrite() error {
+	for _, doc := range b.docs {
+		var err error
+		for _, n := range doc.nodes {
+			xhtml.Walk(n, func(n *html.Node) {
+				switch {
+				case n.DataAtom == atom.A || n.DataAtom == atom.Area:
+					b.rewriteLink(doc, n)
+				case n.DataAtom == atom.Img:
+					if rerr := b.rewriteImage(doc, n, "src"); err == nil {
+						err = rerr
+					}
+				case n.Data == "image" && n.Namespace == "svg":
+					for _, key := range []string{"href", "xlink:href"} {
+						if rerr := b.rewriteImage(doc, n, key); err == nil {
+							err = rerr
+						}
+					}
+				}
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *book) rewriteLink(doc *document, n *html.Node) {
+	for i, a := range n.Attr {
+		if a.Key != "href" || strings.HasPrefix(a.Val, "#") && b.byID[doc.chapter+a.Val] == doc {
+			continue
+		}
+		target, frag, ok := xhtml.Resolve(doc.chapter, a.Val)
+		if !ok || b.chapters[target] == nil {
+			continue
+		}
+		dest := b.chapters[target][0]
+		if d := b.byID[target+"#"+frag]; frag != "" && d != nil {
+			dest = d
+		}
+		href := dest.href
+		if dest == doc {
+			href = ""
+		}
+		if frag != "" {
+			href += "#" + frag
+		}
+		n.Attr[i].Val = href
+	}
+}
+
+func (b *book) rewriteImage(doc *document, n *html.Node, key string) error {
+	for i, a := range n.Attr {
+		if a.Key != key || a.Val == "" || strings.HasPrefix(a.Val, "data:") {
+			continue
+		}
+		target, _, ok := xhtml.Resolve(doc.chapter, a.Val)
+		if !ok {
+			continue
+		}
+		res, err := b.addResource(target, "")
+		if err != nil {
+			return fmt.Errorf("%s: %w", doc.chapter, err)
+		}
+		n.Attr[i].Val = res.href
+	}
+	return nil
+}
+
+// addResource copies the image at the slash-separated path name into the
+// book, once.
+func (b *book) addResource(name, properties string) (*resource, error) {
+	if res := b.bySource[name]; res != nil {
+		return res, nil
+	}
+	data, err := b.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(path.Ext(name))
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	res := &resource{
+		id:         "img" + strconv.Itoa(len(b.resources)+1),
+		href:       imageDir + "/" + xhtml.UniqueName(b.names, xhtml.AnchorName(base)) + ext,
+		mediaType:  mediaType(ext),
+		properties: properties,
+		data:       data,
+	}
+	b.resources = append(b.resources, res)
+	b.bySource[name] = res
+	return res, nil
+}
+
+func mediaType(ext string) string {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return gopub.MediaTypeJPEG
+	case ".png":
+		return gopub.MediaTypePNG
+	case ".gif":
+		return gopub.MediaTypeGIF
+	case ".svg":
+		return gopub.MediaTypeSVG
+	case ".webp":
+		return gopub.MediaTypeWEBP
+	}
+	if mt, _, _ := strings.Cut(mime.TypeByExtension(ext), ";"); mt != "" {
+		return mt
+	}
+	return "application/octet-stream"
+}
+
+// write assembles the package and writes the container to w.
+func (b *book) write(w io.Writer) error {
+	var cover *resource
+	if b.opts.Cover != "" {
+		var err error
+		if cover, err = b.addResource(b.slashPath(b.opts.Cover), "cover-image"); err != nil {
+			return err
+		}
+		cover.properties = "cover-image"
+	}
+	rf := b.rootfile(cover)
+
+	ew := gopub.NewWriter(w)
+	add := func(href string, write func(io.Writer) error) error {
+		f, err := ew.Create(opfDir + "/" + href)
+		if err != nil {
+			return err
+		}
+		return write(f)
+	}
+	lang := rf.Metadata.PrimaryLanguage()
+	if cover != nil {
+		page := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div,
+			Attr: []html.Attribute{{Key: "class", Val: "cover"}}}
+		page.AppendChild(&html.Node{Type: html.ElementNode, Data: "img", DataAtom: atom.Img,
+			Attr: []html.Attribute{{Key: "src", Val: cover.href}, {Key: "alt", Val: rf.Metadata.MainTitle().Name}}})
+		if err := add(coverHREF, func(w io.Writer) error {
+			return writeDocument(w, lang, rf.Metadata.MainTitle().Name, []*html.Node{page})
+		}); err != nil {
+			return err
+		}
+	}
+	for _, doc := range b.docs {
+		var buf bytes.Buffer
+		if err := writeDocument(&buf, lang, orDefault(doc.title, rf.Metadata.MainTitle().Name), doc.nodes); err != nil {
+			return err
+		}
+		props, err := gopub.DetectProperties(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return err
+		}
+		for i := range rf.Manifest.Items {
+			if item := &rf.Manifest.Items[i]; item.HREF == doc.href {
+				item.Properties = strings.Join(props, " ")
+			}
+		}
+		if err := ew.WriteFile(opfDir+"/"+doc.href, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, res := range b.resources {
+		if err := ew.WriteFile(opfDir+"/"+res.href, res.data); err != nil {
+			return err
+		}
+	}
+	if err := ew.WriteFile(opfDir+"/"+stylesheetHREF, []byte(b.opts.Stylesheet)); err != nil {
+		return err
+	}
+	if err := add(navHREF, rf.WriteNav); err != nil {
+		return err
+	}
+	if err := add(ncxHREF, rf.WriteNCX); err != nil {
+		return err
+	}
+	if err := ew.AddRootfile(rf); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// rootfile builds the package, navigation document and NCX of the book.
+func (b *book) rootfile(cover *resource) *gopub.Rootfile {
+	rf := &gopub.Rootfile{FullPath: opfDir + "/content.opf"}
+	rf.Version = "3.0"
+	rf.Metadata = b.metadata()
+	rf.UniqueIdentifier = orDefault(rf.Metadata.Identifier[0].ID, "uid")
+	if cover != nil {
+		rf.Metadata.CoverManifestId = cover.id
+	}
+
+	items := []gopub.ManifestItem{
+		{ID: "nav", HREF: navHREF, MediaType: gopub.MediaTypeXHTML, Properties: "nav"},
+		{ID: "ncx", HREF: ncxHREF, MediaType: gopub.MediaTypeNCX},
+		{ID: "css", HREF: stylesheetHREF, MediaType: gopub.MediaTypeCSS},
+	}
+	rf.Spine.Toc = "ncx"
+	var landmarks []gopub.NavItem
+	if cover != nil {
+		items = append(items, gopub.ManifestItem{ID: "cover", HREF: coverHREF, MediaType: gopub.MediaTypeXHTML})
+		rf.Spine.Itemrefs = append(rf.Spine.Itemrefs, gopub.SpineItem{IDREF: "cover"})
+		landmarks = append(landmarks, landmark("cover", "Cover", coverHREF))
+		rf.Guide.References = append(rf.Guide.References, gopub.GuideReference{Type: "cover", Title: "Cover", Href: coverHREF})
+	}
+	for _, doc := range b.docs {
+		id := strings.TrimSuffix(doc.href, ".xhtml")
+		items = append(items, gopub.ManifestItem{ID: id, HREF: doc.href, MediaType: gopub.MediaTypeXHTML})
+		rf.Spine.Itemrefs = append(rf.Spine.Itemrefs, gopub.SpineItem{IDREF: id})
+	}
+	for _, res := range b.resources {
+		items = append(items, gopub.ManifestItem{ID: res.id, HREF: res.href, MediaType: res.mediaType, Properties: res.properties})
+	}
+	rf.Manifest.Items = items
+
+	first := b.docs[0].href
+	landmarks = append(landmarks, landmark("toc", "Contents", navHREF), landmark("bodymatter", "Start", first))
+	rf.Guide.References = append(rf.Guide.References, gopub.GuideReference{Type: "text", Title: "Start", Href: first})
+
+	toc := b.toc()
+	rf.NavDoc.Navs = []gopub.NavSection{{Type: "toc", Items: toc}, {Type: "landmarks", Items: landmarks}}
+	rf.NavDoc.HREF = navHREF
+	rf.NCX.NavPoints = navPoints(toc)
+	return rf
+}
+
+// metadata returns the book's metadata with the required fields filled in.
+func (b *book) metadata() gopub.Metadata {
+	md := b.opts.Metadata
+	md.Identifier = append([]gopub.Identifier(nil), md.Identifier...)
+	if len(md.Identifier) == 0 {
+		md.Identifier = []gopub.Identifier{{Value: "urn:uuid:" + uuid.New()}}
+	}
+	if len(md.Title) == 0 {
+		title := "Untitled"
+		for _, doc := range b.docs {
+			if doc.title != "" {
+				title = doc.title
+				break
+			}
+		}
+		md.Title = []gopub.Title{{Refinable: gopub.Refinable{Name: title}}}
+	}
+	if len(md.Language) == 0 {
+		md.Language = []string{"und"}
+	}
+	if md.Modified == "" {
+		md.Modified = time.Now().UTC().Format(time.RFC3339)
+	}
+	return md
+}
+
+func landmark(typ, text, href string) gopub.NavItem {
+	var item gopub.NavItem
+	item.Link.Type = typ
+	item.Link.Text = text
+	item.Link.Href = href
+	return item
+}
+
+// toc returns the table of contents built from the headings of every
+// document down to Options.TOCDepth.
+func (b *book) toc() []gopub.NavItem {
+	type entry struct {
+		level int
+		item  gopub.NavItem
+		subs  []*entry
+	}
+	root := &entry{}
+	stack := []*entry{root}
+	for _, doc := range b.docs {
+		for _, n := range doc.nodes {
+			xhtml.Walk(n, func(n *html.Node) {
+				l := level(n)
+				if l == 0 || l > b.opts.TOCDepth {
+					return
+				}
+				e := &entry{level: l}
+				e.item.Link.Text = textOf(n)
+				e.item.Link.Href = doc.href + "#" + xhtml.Attr(n, "id")
+				for len(stack) > 1 && stack[len(stack)-1].level >= l {
+					stack = stack[:len(stack)-1]
+				}
+				parent := stack[len(stack)-1]
+				parent.subs = append(parent.subs, e)
+				stack = append(stack, e)
+			})
+		}
+	}
+	var items func(es []*entry) []gopub.NavItem
+	items = func(es []*entry) []gopub.NavItem {
+		var out []gopub.NavItem
+		for _, e := range es {
+			e.item.SubItems = items(e.subs)
+			out = append(out, e.item)
+		}
+		return out
+	}
+	toc := items(root.subs)
+	if len(toc) == 0 {
+		// Without headings, list the documents themselves.
+		for _, doc := range b.docs {
+			var item gopub.NavItem
+			item.Link.Text = orDefault(doc.title, path.Base(doc.chapter))
+			item.Link.Href = doc.href
+			toc = append(toc, item)
+		}
+	}
+	return toc
+}
+
+func navPoints(items []gopub.NavItem) []gopub.NavPoint {
+	var out []gopub.NavPoint
+	for _, item := range items {
+		var np gopub.NavPoint
+		np.NavLabel.Text = item.Link.Text
+		np.Content.Src = item.Link.Href
+		np.NavPoints = navPoints(item.SubItems)
+		out = append(out, np)
+	}
+	return out
+}
+
+// writeDocument writes an XHTML content document with the given body.
+func writeDocument(w io.Writer, lang, title string, body []*html.Node) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"`)
+	b.WriteString(` lang="` + html.EscapeString(lang) + `" xml:lang="` + html.EscapeString(lang) + `">
+<head>
+<title>` + html.EscapeString(title) + `</title>
+<link rel="stylesheet" type="text/css" href="` + stylesheetHREF + `"/>
+</head>
+<body>
+`)
+	for _, n := range body {
+		if err := xhtml.Render(&b, n); err != nil {
+			return err
+		}
+	}
+	b.WriteString("\n</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func orDefault(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
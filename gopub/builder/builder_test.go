@@ -0,0 +1,229 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+const chapterOne = `# Getting Started
+
+Intro with **bold**, *emphasis*, ` + "`code`" + ` and a [link][web].
+
+![A picture](img/pic.png "Title")
+
+## Install
+
+1. first
+2. second
+   - nested
+
+> Quoted
+> text
+
+| A | B |
+|:--|--:|
+| 1 | x\|y |
+
+` + "```go\nfmt.Println(\"<hi>\")\n```" + `
+
+# Usage
+
+See [the reference](ref.html#api) and [install](#install).
+
+[web]: https://example.com/
+`
+
+const chapterTwo = `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Ref</title></head><body>
+<h1>Reference</h1>
+<p>Back to <a href="one.md#usage">usage</a>.<br/></p>
+<h2 id="api">API</h2>
+<p><img src="img/pic.png" alt=""/></p>
+<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>
+</body></html>`
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"book/one.md":       {Data: []byte(chapterOne)},
+		"book/ref.html":     {Data: []byte(chapterTwo)},
+		"book/img/pic.png":  {Data: []byte("png")},
+		"book/cover.jpg":    {Data: []byte("jpg")},
+		"book/missing.md":   {Data: []byte("![gone](nowhere.png)")},
+		"book/headless.md":  {Data: []byte("Just text.")},
+		"book/nested/x.txt": {Data: []byte("x")},
+	}
+}
+
+func build(t *testing.T, chapters []string, opts *Options) *gopub.Rootfile {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Build(&buf, chapters, opts); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gopub.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.DefaultRendition()
+}
+
+func readItem(t *testing.T, rf *gopub.Rootfile, href string) string {
+	t.Helper()
+	for _, item := range rf.Manifest.Items {
+		if item.HREF == href {
+			data, err := item.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+	t.Fatalf("no manifest item %s", href)
+	return ""
+}
+
+func TestBuild(t *testing.T) {
+	md := gopub.Metadata{
+		Title:    []gopub.Title{{Refinable: gopub.Refinable{Name: "Manual"}}},
+		Language: []string{"en"},
+		Creator:  []gopub.Creator{{Refinable: gopub.Refinable{Name: "Tech Writer"}, CreatorRole: "aut"}},
+	}
+	rf := build(t, []string{"book/one.md", "book/ref.html"}, &Options{FS: testFS(), Metadata: md, Cover: "book/cover.jpg"})
+
+	if rf.Version != "3.0" || rf.Metadata.MainTitle().Name != "Manual" || rf.Metadata.Creator[0].CreatorRole != "aut" {
+		t.Errorf("metadata: %+v", rf.Metadata)
+	}
+	if id := rf.Metadata.Identifier[0].Value; !strings.HasPrefix(id, "urn:uuid:") || rf.Metadata.Modified == "" {
+		t.Errorf("generated metadata: %q %q", id, rf.Metadata.Modified)
+	}
+	var spine []string
+	for _, ref := range rf.Spine.Itemrefs {
+		spine = append(spine, ref.HREF)
+	}
+	if got := strings.Join(spine, " "); got != "cover.xhtml ch001.xhtml ch002.xhtml ch003.xhtml" {
+		t.Errorf("spine: "+expFormat, "cover.xhtml ch001.xhtml ch002.xhtml ch003.xhtml", got)
+	}
+	for _, item := range rf.Manifest.Items {
+		if item.ID == rf.Metadata.CoverManifestId && (item.HREF != "images/cover.jpg" || item.Properties != "cover-image") {
+			t.Errorf("cover: %+v", item)
+		}
+	}
+	if len(rf.Manifest.Images()) != 2 {
+		t.Errorf("images: %+v", rf.Manifest.Images())
+	}
+
+	one := readItem(t, rf, "ch001.xhtml")
+	for _, want := range []string{
+		`<h1 id="getting-started">Getting Started</h1>`,
+		"<strong>bold</strong>, <em>emphasis</em>, <code>code</code>",
+		`<a href="https://example.com/">link</a>`,
+		`<img src="images/pic.png" alt="A picture" title="Title"/>`,
+		`<h2 id="install">Install</h2>`,
+		"<li>second\n<ul>\n<li>nested</li>",
+		`<th style="text-align: left">A</th>`,
+		"<td style=\"text-align: right\">x|y</td>",
+		`<code class="language-go">fmt.Println("&lt;hi&gt;")`,
+		`<link rel="stylesheet" type="text/css" href="style.css"/>`,
+	} {
+		if !strings.Contains(one, want) {
+			t.Errorf("ch001.xhtml missing %q:\n%s", want, one)
+		}
+	}
+	two := readItem(t, rf, "ch002.xhtml")
+	for _, want := range []string{
+		`<h1 id="usage">Usage</h1>`,
+		`<a href="ch003.xhtml#api">the reference</a>`,
+		`<a href="ch001.xhtml#install">install</a>`,
+	} {
+		if !strings.Contains(two, want) {
+			t.Errorf("ch002.xhtml missing %q:\n%s", want, two)
+		}
+	}
+	three := readItem(t, rf, "ch003.xhtml")
+	for _, want := range []string{
+		`<a href="ch002.xhtml#usage">usage</a>.<br/>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`,
+		`<img src="images/pic.png" alt=""/>`,
+	} {
+		if !strings.Contains(three, want) {
+			t.Errorf("ch003.xhtml missing %q:\n%s", want, three)
+		}
+	}
+	for _, item := range rf.Manifest.Items {
+		if want := map[string]string{"ch003.xhtml": "svg", "nav.xhtml": "nav"}[item.HREF]; item.Properties != want && item.HREF != "images/cover.jpg" {
+			t.Errorf("%s properties: "+expFormat, item.HREF, want, item.Properties)
+		}
+	}
+
+	var toc []string
+	for pos, item := range rf.TOCNav().Walk() {
+		toc = append(toc, strings.Repeat(" ", pos.Depth)+item.Link.Text+"="+item.Link.Href)
+	}
+	wantTOC := "Getting Started=ch001.xhtml#getting-started| Install=ch001.xhtml#install|Usage=ch002.xhtml#usage|Reference=ch003.xhtml#reference| API=ch003.xhtml#api"
+	if got := strings.Join(toc, "|"); got != wantTOC {
+		t.Errorf("toc: "+expFormat, wantTOC, got)
+	}
+	var ncx []string
+	for _, np := range rf.NCX.Walk() {
+		ncx = append(ncx, np.Content.Src)
+	}
+	if len(ncx) != 5 || ncx[4] != "ch003.xhtml#api" || rf.NCX.NavPoints[1].PlayOrder != 3 {
+		t.Errorf("ncx: %v %+v", ncx, rf.NCX.NavPoints)
+	}
+	if l := rf.LandmarksNav(); l == nil || len(l.Items) != 3 || l.Items[2].Link.Type != "bodymatter" {
+		t.Errorf("landmarks: %+v", l)
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	rf := build(t, []string{"book/one.md", "book/headless.md"}, &Options{FS: testFS(), SplitLevel: -1, TOCDepth: 1})
+	if len(rf.Spine.Itemrefs) != 2 {
+		t.Errorf("spine length: "+expFormat, 2, len(rf.Spine.Itemrefs))
+	}
+	if got := rf.Metadata.MainTitle().Name; got != "Getting Started" {
+		t.Errorf("title: "+expFormat, "Getting Started", got)
+	}
+	if toc := rf.TOCNav().Items; len(toc) != 2 || len(toc[0].SubItems) != 0 || toc[1].Link.Href != "ch001.xhtml#usage" {
+		t.Errorf("toc: %+v", toc)
+	}
+	if rf.Metadata.PrimaryLanguage() != "und" {
+		t.Errorf("language: "+expFormat, "und", rf.Metadata.PrimaryLanguage())
+	}
+
+	if err := Build(&bytes.Buffer{}, nil, nil); !errors.Is(err, ErrNoChapters) {
+		t.Errorf(expFormat, ErrNoChapters, err)
+	}
+	if err := Build(&bytes.Buffer{}, []string{"book/missing.md"}, &Options{FS: testFS()}); err == nil {
+		t.Error("expected an error for a missing image")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	for src, want := range map[string]string{
+		"Title\n=====":                     "<h1>Title</h1>\n",
+		"a *b **c** d* e":                  "<p>a <em>b <strong>c</strong> d</em> e</p>\n",
+		"***both***":                       "<p><em><strong>both</strong></em></p>\n",
+		"snake_case_name":                  "<p>snake_case_name</p>\n",
+		"line  \nbreak":                    "<p>line<br />\nbreak</p>\n",
+		"a \\*literal\\*":                  "<p>a *literal*</p>\n",
+		"<https://x.org>":                  "<p><a href=\"https://x.org\">https://x.org</a></p>\n",
+		"x < y & z &amp; w":                "<p>x &lt; y &amp; z &amp; w</p>\n",
+		"- a\n\n- b":                       "<ul>\n<li><p>a</p></li>\n<li><p>b</p></li>\n</ul>\n",
+		"3. c\n4. d":                       "<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>\n",
+		"    code\n    more":               "<pre><code>code\nmore\n</code></pre>\n",
+		"***":                              "<hr />\n",
+		"<div class=\"x\">\n*raw*\n</div>": "<div class=\"x\">\n*raw*\n</div>\n",
+		"[a](<b c> 'd')":                   "<p><a href=\"b c\" title=\"d\">a</a></p>\n",
+		"[missing]":                        "<p>[missing]</p>\n",
+	} {
+		if got := markdownToHTML(src); got != want {
+			t.Errorf("%q: "+expFormat, src, want, got)
+		}
+	}
+}
+
+const expFormat = "Expected: %v, but got: %v\n"
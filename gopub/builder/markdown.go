@@ -0,0 +1,766 @@
+package builder
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This file converts the commonly used subset of CommonMark, plus GitHub
+// tables, to HTML: ATX and setext headings, paragraphs, emphasis, code
+// spans and blocks, links and images (inline and by reference), autolinks,
+// nested lists, block quotes, thematic breaks and raw HTML. The output is
+// reparsed with the HTML5 parser, so it need not be well-formed.
+
+var (
+	atxHeading   = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematic     = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextLine   = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+	orderedItem  = regexp.MustCompile(`^(\d{1,9})([.)])(?:[ \t]|$)`)
+	tableDelim   = regexp.MustCompile(`^\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?$`)
+	linkRefDef   = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*<?([^\s>]+)>?(?:[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?[ \t]*$`)
+	entityRef    = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	autolink     = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*|[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9-]+)*)>`)
+	inlineTag    = regexp.MustCompile(`^<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][a-zA-Z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?|!--(?s:.*?)--)>`)
+	htmlBlockTag = regexp.MustCompile(`^<(?:!--|/?([a-zA-Z][a-zA-Z0-9]*)(?:[\s/>]|$))`)
+)
+
+// blockTags start an HTML block when a line opens with them.
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true,
+	"div": true, "dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "header": true, "hr": true, "main": true, "math": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true, "svg": true,
+	"table": true, "ul": true, "script": true, "style": true, "audio": true, "video": true,
+}
+
+type linkRef struct{ dest, title string }
+
+type mdParser struct {
+	refs map[string]linkRef
+}
+
+// markdownToHTML converts Markdown source to an HTML fragment.
+func markdownToHTML(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	p := &mdParser{refs: make(map[string]linkRef)}
+	lines := p.collectRefs(strings.Split(src, "\n"))
+	var b strings.Builder
+	p.blocks(&b, lines, false)
+	return b.String()
+}
+
+// collectRefs removes link reference definitions outside code blocks from
+// lines and records them.
+func (p *mdParser) collectRefs(lines []string) []string {
+	var out []string
+	fence := ""
+	for i, line := range lines {
+		t := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+		} else if f := fenceOf(line); f != "" {
+			fence = f
+		} else if m := linkRefDef.FindStringSubmatch(line); m != nil && (i == 0 || isBlank(lines[i-1]) || linkRefDef.MatchString(lines[i-1])) {
+			label := normalizeLabel(m[1])
+			if _, ok := p.refs[label]; !ok {
+				p.refs[label] = linkRef{dest: m[2], title: m[3] + m[4] + m[5]}
+			}
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func normalizeLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// blocks writes the block structure of lines. In a tight list item,
+// paragraphs are written without <p> tags.
+func (p *mdParser) blocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			i++
+			continue
+		}
+		t := strings.TrimLeft(line, " ")
+		switch {
+		case indentOf(line) >= 4:
+			i = p.indentedCode(b, lines, i)
+		case fenceOf(line) != "":
+			i = p.fencedCode(b, lines, i)
+		case atxHeading.MatchString(t):
+			m := atxHeading.FindStringSubmatch(t)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + p.inline(strings.TrimSpace(m[2])) + "</h" + level + ">\n")
+			i++
+		case thematic.MatchString(t):
+			b.WriteString("<hr />\n")
+			i++
+		case strings.HasPrefix(t, ">"):
+			i = p.blockquote(b, lines, i)
+		case listMarker(line) != nil:
+			i = p.list(b, lines, i)
+		case isHTMLBlock(t):
+			i = p.htmlBlock(b, lines, i)
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableDelim.MatchString(strings.TrimSpace(lines[i+1])) &&
+			len(splitRow(line)) == len(splitRow(lines[i+1])):
+			i = p.table(b, lines, i)
+		default:
+			i = p.paragraph(b, lines, i, tight)
+		}
+	}
+}
+
+func (p *mdParser) indentedCode(b *strings.Builder, lines []string, i int) int {
+	var code []string
+	for ; i < len(lines) && (isBlank(lines[i]) || indentOf(lines[i]) >= 4); i++ {
+		code = append(code, stripIndent(lines[i], 4))
+	}
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>\n")
+	return i
+}
+
+func (p *mdParser) fencedCode(b *strings.Builder, lines []string, i int) int {
+	indent := indentOf(lines[i])
+	t := strings.TrimLeft(lines[i], " ")
+	fence := fenceOf(lines[i])
+	info := strings.Fields(strings.TrimLeft(t, fence[:1]))
+	var code []string
+	for i++; i < len(lines); i++ {
+		c := strings.TrimLeft(lines[i], " ")
+		if strings.HasPrefix(c, fence) && strings.Trim(c, fence[:1]+" \t") == "" {
+			i++
+			break
+		}
+		code = append(code, stripIndent(lines[i], indent))
+	}
+	b.WriteString("<pre><code")
+	if len(info) > 0 {
+		b.WriteString(` class="language-` + html.EscapeString(info[0]) + `"`)
+	}
+	b.WriteString(">")
+	if len(code) > 0 {
+		b.WriteString(html.EscapeString(strings.Join(code, "\n")) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// fenceOf returns the opening code fence of line, e.g. "```", or "".
+func fenceOf(line string) string {
+	if indentOf(line) >= 4 {
+		return ""
+	}
+	t := strings.TrimLeft(line, " ")
+	for _, c := range []byte{'`', '~'} {
+		n := 0
+		for n < len(t) && t[n] == c {
+			n++
+		}
+		if n >= 3 && (c == '~' || !strings.Contains(t[n:], "`")) {
+			return t[:n]
+		}
+	}
+	return ""
+}
+
+func (p *mdParser) blockquote(b *strings.Builder, lines []string, i int) int {
+	var inner []string
+	for ; i < len(lines) && !isBlank(lines[i]); i++ {
+		t := strings.TrimLeft(lines[i], " ")
+		if rest, ok := strings.CutPrefix(t, ">"); ok && indentOf(lines[i]) < 4 {
+			inner = append(inner, strings.TrimPrefix(rest, " "))
+		} else if len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !startsBlock(lines[i]) {
+			inner = append(inner, lines[i]) // lazy continuation
+		} else {
+			break
+		}
+	}
+	b.WriteString("<blockquote>\n")
+	p.blocks(b, inner, false)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+// marker describes a list item marker.
+type marker struct {
+	ordered bool
+	delim   byte // bullet character or '.' / ')'
+	start   int
+	content int // column where the item's content starts
+	offset  int // byte offset of the content in the marker's line
+}
+
+func listMarker(line string) *marker {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return nil
+	}
+	lead := len(line) - len(strings.TrimLeft(line, " \t"))
+	t := line[lead:]
+	m := &marker{}
+	var width int
+	if len(t) > 0 && strings.IndexByte("-*+", t[0]) >= 0 && (len(t) == 1 || t[1] == ' ' || t[1] == '\t') {
+		m.delim, width = t[0], 1
+	} else if om := orderedItem.FindStringSubmatch(t); om != nil {
+		m.ordered, m.delim = true, om[2][0]
+		m.start, _ = strconv.Atoi(om[1])
+		width = len(om[1]) + 1
+	} else {
+		return nil
+	}
+	spaces := 0
+	for width+spaces < len(t) && t[width+spaces] == ' ' {
+		spaces++
+	}
+	if spaces == 0 || spaces > 4 || width+spaces == len(t) {
+		spaces = 1
+	}
+	m.content = indent + width + spaces
+	m.offset = min(lead+width+spaces, len(line))
+	return m
+}
+
+func (m *marker) sameList(o *marker) bool {
+	return o != nil && o.ordered == m.ordered && o.delim == m.delim
+}
+
+func (p *mdParser) list(b *strings.Builder, lines []string, i int) int {
+	first := listMarker(lines[i])
+	var items [][]string
+	loose := false
+	for i < len(lines) {
+		m := listMarker(lines[i])
+		if !first.sameList(m) || thematic.MatchString(strings.TrimLeft(lines[i], " ")) {
+			break
+		}
+		item := []string{lines[i][m.offset:]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			switch {
+			case isBlank(line):
+				item = append(item, "")
+				continue
+			case indentOf(line) >= m.content:
+				item = append(item, stripIndent(line, m.content))
+				continue
+			case !isBlank(item[len(item)-1]) && !startsBlock(line) && listMarker(line) == nil:
+				item = append(item, line) // lazy continuation
+				continue
+			}
+			break
+		}
+		trailing := 0
+		for len(item) > 1 && isBlank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+			trailing++
+		}
+		if trailing > 0 && first.sameList(listMarker(lineAt(lines, i))) {
+			loose = true
+		}
+		for j := 1; j < len(item); j++ {
+			if isBlank(item[j-1]) && !isBlank(item[j]) && indentOf(item[j]) == 0 && listMarker(item[j]) == nil {
+				loose = true
+			}
+		}
+		items = append(items, item)
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		var content strings.Builder
+		p.blocks(&content, item, !loose)
+		b.WriteString("<li>" + strings.TrimSuffix(content.String(), "\n") + "</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func isHTMLBlock(t string) bool {
+	m := htmlBlockTag.FindStringSubmatch(t)
+	return m != nil && (m[1] == "" || blockTags[strings.ToLower(m[1])])
+}
+
+func (p *mdParser) htmlBlock(b *strings.Builder, lines []string, i int) int {
+	comment := strings.HasPrefix(strings.TrimLeft(lines[i], " "), "<!--")
+	for ; i < len(lines); i++ {
+		if !comment && isBlank(lines[i]) {
+			break
+		}
+		b.WriteString(lines[i] + "\n")
+		if comment && strings.Contains(lines[i], "-->") {
+			i++
+			break
+		}
+	}
+	return i
+}
+
+func (p *mdParser) table(b *strings.Builder, lines []string, i int) int {
+	var align []string
+	for _, cell := range splitRow(lines[i+1]) {
+		switch l, r := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":"); {
+		case l && r:
+			align = append(align, "center")
+		case r:
+			align = append(align, "right")
+		case l:
+			align = append(align, "left")
+		default:
+			align = append(align, "")
+		}
+	}
+	row := func(line, tag string) {
+		cells := splitRow(line)
+		b.WriteString("<tr>")
+		for j, a := range align {
+			b.WriteString("<" + tag)
+			if a != "" {
+				b.WriteString(` style="text-align: ` + a + `"`)
+			}
+			b.WriteString(">")
+			if j < len(cells) {
+				b.WriteString(p.inline(cells[j]))
+			}
+			b.WriteString("</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("<table>\n<thead>\n")
+	row(lines[i], "th")
+	b.WriteString("</thead>\n")
+	i += 2
+	if i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|") {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|"); i++ {
+			row(lines[i], "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i
+}
+
+// splitRow splits a table row into trimmed cells; "\|" does not split.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	start := 0
+	for j := 0; j < len(line); j++ {
+		switch line[j] {
+		case '\\':
+			j++
+		case '|':
+			cells = append(cells, strings.TrimSpace(line[start:j]))
+			start = j + 1
+		}
+	}
+	cells = append(cells, strings.TrimSpace(line[start:]))
+	for j, c := range cells {
+		cells[j] = strings.ReplaceAll(c, `\|`, "|")
+	}
+	return cells
+}
+
+func (p *mdParser) paragraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	text := []string{strings.TrimLeft(lines[i], " \t")}
+	for i++; i < len(lines) && !isBlank(lines[i]); i++ {
+		if t := strings.TrimSpace(lines[i]); setextLine.MatchString(t) && indentOf(lines[i]) < 4 {
+			level := "1"
+			if t[0] == '-' {
+				level = "2"
+			}
+			b.WriteString("<h" + level + ">" + p.inline(strings.Join(text, "\n")) + "</h" + level + ">\n")
+			return i + 1
+		}
+		if startsBlock(lines[i]) {
+			break
+		}
+		text = append(text, strings.TrimLeft(lines[i], " \t"))
+	}
+	content := p.inline(strings.TrimSpace(strings.Join(text, "\n")))
+	if tight {
+		b.WriteString(content + "\n")
+	} else {
+		b.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+// startsBlock reports whether line interrupts a paragraph.
+func startsBlock(line string) bool {
+	if indentOf(line) >= 4 {
+		return false
+	}
+	t := strings.TrimLeft(line, " ")
+	if m := listMarker(line); m != nil {
+		// Only non-empty bullets and lists starting at 1 interrupt.
+		return len(strings.TrimSpace(t)) > 1 && (!m.ordered || m.start == 1)
+	}
+	return atxHeading.MatchString(t) || thematic.MatchString(t) || strings.HasPrefix(t, ">") ||
+		fenceOf(line) != "" || isHTMLBlock(t)
+}
+
+// inline converts the inline content of a block to HTML.
+func (p *mdParser) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			b.WriteString("<br />\n")
+			i += 2
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+		case c == '`':
+			i = p.codeSpan(&b, s, i)
+		case c == '!' && strings.HasPrefix(s[i:], "!["):
+			if n, ok := p.link(&b, s, i+1, true); ok {
+				i = n
+			} else {
+				b.WriteString("!")
+				i++
+			}
+		case c == '[':
+			if n, ok := p.link(&b, s, i, false); ok {
+				i = n
+			} else {
+				b.WriteString("[")
+				i++
+			}
+		case c == '<':
+			if m := autolink.FindStringSubmatch(s[i:]); m != nil {
+				href := m[1]
+				if !strings.Contains(href, ":") {
+					href = "mailto:" + href
+				}
+				b.WriteString(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+			} else if tag := inlineTag.FindString(s[i:]); tag != "" {
+				b.WriteString(tag)
+				i += len(tag)
+			} else {
+				b.WriteString("&lt;")
+				i++
+			}
+		case c == '&':
+			if ref := entityRef.FindString(s[i:]); ref != "" {
+				b.WriteString(ref)
+				i += len(ref)
+			} else {
+				b.WriteString("&amp;")
+				i++
+			}
+		case c == '*' || c == '_':
+			i = p.emphasis(&b, s, i)
+		case c == '\n':
+			text := strings.TrimRight(b.String(), " ")
+			if len(b.String())-len(text) >= 2 {
+				b.Reset()
+				b.WriteString(text + "<br />")
+			}
+			b.WriteString("\n")
+			i++
+		default:
+			b.WriteString(html.EscapeString(s[i : i+1]))
+			i++
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func (p *mdParser) codeSpan(b *strings.Builder, s string, i int) int {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		k := strings.IndexByte(s[j:], '`')
+		if k < 0 {
+			break
+		}
+		j += k
+		if m := runLength(s, j); m == n {
+			code := strings.ReplaceAll(s[i+n:j], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			return j + n
+		} else {
+			j += m
+		}
+	}
+	b.WriteString(s[i : i+n])
+	return i + n
+}
+
+// emphasis handles a run of '*' or '_' at s[i]: one delimiter opens <em>,
+// two open <strong> and three open both, if a matching closing run follows.
+func (p *mdParser) emphasis(b *strings.Builder, s string, i int) int {
+	c := s[i]
+	n := runLength(s, i)
+	opens := i+n < len(s) && !isSpace(s[i+n]) && !(c == '_' && i > 0 && isAlnum(s[i-1]))
+	if opens {
+		k := min(n, 3)
+		for j := i + n; j < len(s); {
+			if s[j] == '`' {
+				j += runLength(s, j)
+				continue
+			}
+			if s[j] == '\\' {
+				j += 2
+				continue
+			}
+			if s[j] != c {
+				j++
+				continue
+			}
+			m := runLength(s, j)
+			closes := !isSpace(s[j-1]) && !(c == '_' && j+m < len(s) && isAlnum(s[j+m]))
+			if closes && (m == k || k == 3 && m > 3) {
+				inner := p.inline(s[i+n : j])
+				open, end := "<em>", "</em>"
+				switch k {
+				case 2:
+					open, end = "<strong>", "</strong>"
+				case 3:
+					open, end = "<em><strong>", "</strong></em>"
+				}
+				b.WriteString(strings.Repeat(string(c), n-k) + open + inner + end)
+				return j + k
+			}
+			j += m
+		}
+	}
+	b.WriteString(s[i : i+n])
+	return i + n
+}
+
+// link parses a link or, if image is set, an image whose opening bracket
+// is at s[i]. It returns the index after it and whether one was found.
+func (p *mdParser) link(b *strings.Builder, s string, i int, image bool) (int, bool) {
+	end := closingBracket(s, i)
+	if end < 0 {
+		return 0, false
+	}
+	text := s[i+1 : end]
+	var ref linkRef
+	next := end + 1
+	if dest, title, n, ok := inlineDest(s, next); ok {
+		ref, next = linkRef{dest: dest, title: title}, n
+	} else {
+		label := text
+		if strings.HasPrefix(s[next:], "[") {
+			if e := strings.IndexByte(s[next:], ']'); e > 0 {
+				if l := s[next+1 : next+e]; l != "" {
+					label = l
+				}
+				next += e + 1
+			}
+		}
+		r, ok := p.refs[normalizeLabel(label)]
+		if !ok {
+			return 0, false
+		}
+		ref = r
+	}
+	attrs := ""
+	if ref.title != "" {
+		attrs = ` title="` + html.EscapeString(ref.title) + `"`
+	}
+	if image {
+		alt := html.EscapeString(html.UnescapeString(stripTags(p.inline(text))))
+		b.WriteString(`<img src="` + html.EscapeString(ref.dest) + `" alt="` + alt + `"` + attrs + " />")
+	} else {
+		b.WriteString(`<a href="` + html.EscapeString(ref.dest) + `"` + attrs + ">" + p.inline(text) + "</a>")
+	}
+	return next, true
+}
+
+// closingBracket returns the index of the ']' matching the '[' at s[i],
+// or -1.
+func closingBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			j += runLength(s, j) - 1
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// inlineDest parses "(dest "title")" at s[i].
+func inlineDest(s string, i int) (dest, title string, next int, ok bool) {
+	if i >= len(s) || s[i] != '(' {
+		return "", "", 0, false
+	}
+	j := skipSpace(s, i+1)
+	if j < len(s) && s[j] == '<' {
+		e := strings.IndexByte(s[j:], '>')
+		if e < 0 {
+			return "", "", 0, false
+		}
+		dest, j = s[j+1:j+e], j+e+1
+	} else {
+		start, depth := j, 0
+	loop:
+		for ; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					break loop
+				}
+				depth--
+			case ' ', '\t', '\n':
+				break loop
+			}
+		}
+		dest = s[start:min(j, len(s))]
+	}
+	j = skipSpace(s, j)
+	if j < len(s) && strings.IndexByte(`"'(`, s[j]) >= 0 {
+		closer := s[j]
+		if closer == '(' {
+			closer = ')'
+		}
+		e := strings.IndexByte(s[j+1:], closer)
+		if e < 0 {
+			return "", "", 0, false
+		}
+		title, j = s[j+1:j+1+e], skipSpace(s, j+e+2)
+	}
+	if j >= len(s) || s[j] != ')' {
+		return "", "", 0, false
+	}
+	return unescapePunct(dest), unescapePunct(title), j + 1, true
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func stripTags(s string) string {
+	return tagPattern.ReplaceAllString(s, "")
+}
+
+func unescapePunct(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return html.UnescapeString(b.String())
+}
+
+func runLength(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// indentOf returns the width of line's leading whitespace, counting tabs
+// as four columns.
+func indentOf(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// stripIndent removes up to n columns of leading whitespace from line.
+func stripIndent(line string, n int) string {
+	col := 0
+	for i, c := range line {
+		if col >= n {
+			return line[i:]
+		}
+		switch c {
+		case ' ':
+			col++
+		case '\t':
+			col += 4 - col%4
+			if col > n {
+				return strings.Repeat(" ", col-n) + line[i+1:]
+			}
+		default:
+			return line[i:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package gopub
+
+import (
+	"archive/zip"
+	"bytes"
+	"container/list"
+	"context"
+	"runtime"
+	"sync"
+)
+
+// itemKey identifies a cached manifest item. The ZIP entry is part of the
+// key because ids are only unique within one rendition.
+type itemKey struct {
+	id string
+	f  *zip.File
+}
+
+type cacheEntry struct {
+	key  itemKey
+	data []byte
+}
+
+// itemCache is a least-recently-used cache of decompressed manifest items
+// bounded by the total size of their contents.
+type itemCache struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	order   *list.List // front is most recently used
+	entries map[itemKey]*list.Element
+}
+
+func newItemCache(max int64) *itemCache {
+	return &itemCache{max: max, order: list.New(), entries: make(map[itemKey]*list.Element)}
+}
+
+// get returns a copy of the cached contents of key.
+func (c *itemCache) get(key itemKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return bytes.Clone(el.Value.(*cacheEntry).data), true
+}
+
+// put stores a copy of data, evicting the least recently used items until
+// the cache fits. Items larger than the whole cache are not stored.
+func (c *itemCache) put(key itemKey, data []byte) {
+	n := int64(len(data))
+	if n > c.max {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	for c.size+n > c.max {
+		oldest := c.order.Back()
+		e := c.order.Remove(oldest).(*cacheEntry)
+		delete(c.entries, e.key)
+		c.size -= int64(len(e.data))
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, data: bytes.Clone(data)})
+	c.size += n
+}
+
+// ReadSpine reads the contents of every spine item of rf using up to
+// workers goroutines (GOMAXPROCS if workers <= 0). The result is indexed
+// like rf.Spine.Itemrefs. The first error, or ctx's error once it is
+// cancelled, stops the remaining reads.
+func (r *Reader) ReadSpine(ctx context.Context, rf *Rootfile, workers int) ([][]byte, error) {
+	if err := rf.Load(); err != nil {
+		return nil, err
+	}
+	refs := rf.Spine.Itemrefs
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(refs))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out := make([][]byte, len(refs))
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		cancel()
+	}
+	for range workers {
+		wg.Go(func() {
+			for i := range jobs {
+				data, err := r.readItemContext(ctx, refs[i].ManifestItem)
+				if err != nil {
+					fail(err)
+					return
+				}
+				out[i] = data
+			}
+		})
+	}
+
+feed:
+	for i := range refs {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package gopub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestItemCacheEviction(t *testing.T) {
+	c := newItemCache(10)
+	a, b, d := itemKey{id: "a"}, itemKey{id: "b"}, itemKey{id: "d"}
+	c.put(a, []byte("aaaa"))
+	c.put(b, []byte("bbbb"))
+	c.get(a) // b is now least recently used
+	c.put(d, []byte("dddd"))
+
+	if _, ok := c.get(b); ok {
+		t.Error("least recently used item not evicted")
+	}
+	if data, ok := c.get(a); !ok || string(data) != "aaaa" {
+		t.Errorf(expFormat, "aaaa", string(data))
+	}
+	if c.size != 8 {
+		t.Errorf(expFormat, 8, c.size)
+	}
+	c.put(itemKey{id: "big"}, make([]byte, 11))
+	if c.size != 8 {
+		t.Errorf("oversized item cached; size %d", c.size)
+	}
+
+	data, _ := c.get(a)
+	data[0] = 'x'
+	if again, _ := c.get(a); string(again) != "aaaa" {
+		t.Error("caller modified cached contents")
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub", WithItemCache(256<<10), WithMode(ModeLazy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	rf := r.DefaultRendition()
+	if err := rf.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := rf.Manifest.Items[40].ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			got, err := rf.Manifest.Items[40].ReadAll()
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("concurrent ReadAll: %v", err)
+			}
+			if _, err := r.FindCover(); err != nil {
+				t.Error(err)
+			}
+			_ = rf.ItemName(rf.Manifest.Items[40].HREF)
+			_ = r.Warnings()
+		})
+	}
+	wg.Wait()
+
+	// Close waits for reads in progress; later reads fail cleanly.
+	for range 4 {
+		wg.Go(func() {
+			if _, err := rf.Manifest.Items[0].ReadAll(); err != nil && !errors.Is(err, os.ErrClosed) {
+				t.Error(err)
+			}
+		})
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+	if _, err := rf.Manifest.Items[0].ReadAll(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf(expFormat, os.ErrClosed, err)
+	}
+}
+
+func TestReadSpine(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	rf := r.DefaultRendition()
+	docs, err := r.ReadSpine(context.Background(), rf, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != len(rf.Spine.Itemrefs) {
+		t.Fatalf(expFormat, len(rf.Spine.Itemrefs), len(docs))
+	}
+	for i, ref := range rf.Spine.Itemrefs {
+		want, _ := ref.ManifestItem.ReadAll()
+		if !bytes.Equal(docs[i], want) {
+			t.Errorf("spine item %d out of order", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.ReadSpine(ctx, rf, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf(expFormat, context.Canceled, err)
+	}
+
+	broken := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf": limitsTestOPF, // ch.xhtml is missing
+		"OEBPS/toc.ncx":     nestedNavPoints(1),
+	})
+	if _, err := broken.ReadSpine(context.Background(), broken.DefaultRendition(), 0); err != ErrBadManifest {
+		t.Errorf(expFormat, ErrBadManifest, err)
+	}
+}
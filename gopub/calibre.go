@@ -0,0 +1,274 @@
+package gopub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calibreSidecarName is the file Calibre writes next to every book in a library.
+const calibreSidecarName = "metadata.opf"
+
+// Calibre is a typed view of the calibre:* meta tags Calibre writes into the OPF.
+// EPUB 2.0 books store them as <meta name="calibre:..."> and EPUB 3.0 books as
+// <meta property="calibre:...">; both end up in Metadata.OtherTags.
+type Calibre struct {
+	ID          string  // dc:identifier with scheme "calibre"
+	UUID        string  // dc:identifier with scheme "uuid"
+	Series      string  // calibre:series
+	SeriesIndex float64 // calibre:series_index, 0 if absent
+	// Rating is Calibre's internal 0–10 scale (stars × 2), 0 if absent.
+	Rating    float64
+	Timestamp time.Time // calibre:timestamp, zero if absent or unparseable
+	TitleSort string    // calibre:title_sort
+	// AuthorLinkMap maps author names to their configured link URLs.
+	AuthorLinkMap map[string]string
+	// UserMetadata holds custom columns keyed by lookup name (e.g. "#genre").
+	UserMetadata map[string]CalibreColumn
+}
+
+// CalibreColumn is a Calibre custom column definition together with its value.
+type CalibreColumn struct {
+	Label    string `json:"label"`
+	Name     string `json:"name"`
+	Datatype string `json:"datatype"`
+	// IsMultiple is non-empty for columns that hold a list of values.
+	IsMultiple struct {
+		CacheToList string `json:"cache_to_list"`
+		UIToList    string `json:"ui_to_list"`
+		ListToUI    string `json:"list_to_ui"`
+	} `json:"is_multiple"`
+	Display map[string]any `json:"display"`
+	// Value is the raw JSON "#value#" payload; use the typed accessors.
+	Value json.RawMessage `json:"#value#"`
+	// Extra is the raw JSON "#extra#" payload (the series index for series columns).
+	Extra json.RawMessage `json:"#extra#"`
+}
+
+// Multiple reports whether the column holds a list of values.
+func (c CalibreColumn) Multiple() bool {
+	return c.IsMultiple.UIToList != ""
+}
+
+// IsNull reports whether the column has no value for this book.
+func (c CalibreColumn) IsNull() bool {
+	v := strings.TrimSpace(string(c.Value))
+	return v == "" || v == "null"
+}
+
+// Text returns the value of a text-like column (text, comments, series,
+// enumeration, datetime). Multiple-value columns are joined with ", ".
+func (c CalibreColumn) Text() string {
+	if c.IsNull() {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(c.Value, &s); err == nil {
+		return s
+	}
+	if list := c.List(); list != nil {
+		return strings.Join(list, ", ")
+	}
+	return strings.TrimSpace(string(c.Value))
+}
+
+// List returns the values of a multiple-value column, or a single-element
+// slice for a non-null single-value text column.
+func (c CalibreColumn) List() []string {
+	if c.IsNull() {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(c.Value, &list); err == nil {
+		return list
+	}
+	var s string
+	if err := json.Unmarshal(c.Value, &s); err == nil {
+		return []string{s}
+	}
+	return nil
+}
+
+// Number returns the value of an int, float or rating column.
+// ok is false when the column is null or not numeric.
+func (c CalibreColumn) Number() (v float64, ok bool) {
+	if c.IsNull() {
+		return 0, false
+	}
+	if err := json.Unmarshal(c.Value, &v); err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// Bool returns the value of a bool column.
+// ok is false when the column is null or not a boolean.
+func (c CalibreColumn) Bool() (v bool, ok bool) {
+	if c.IsNull() {
+		return false, false
+	}
+	if err := json.Unmarshal(c.Value, &v); err != nil {
+		return false, false
+	}
+	return v, true
+}
+
+// Time returns the value of a datetime column.
+// ok is false when the column is null or the value cannot be parsed.
+func (c CalibreColumn) Time() (t time.Time, ok bool) {
+	if c.IsNull() {
+		return time.Time{}, false
+	}
+	return parseCalibreTime(c.Text())
+}
+
+// SeriesIndex returns the "#extra#" series index of a series column.
+func (c CalibreColumn) SeriesIndex() (v float64, ok bool) {
+	if len(c.Extra) == 0 {
+		return 0, false
+	}
+	if err := json.Unmarshal(c.Extra, &v); err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// Calibre returns the Calibre metadata stored in the package, or nil if the
+// book carries no calibre:* tags or calibre identifier. Malformed JSON
+// payloads are skipped and reported in the returned error alongside the
+// fields that did decode.
+func (m *Metadata) Calibre() (*Calibre, error) {
+	c := &Calibre{}
+	found := false
+	var errs []string
+
+	for _, id := range m.Identifier {
+		switch strings.ToLower(id.Scheme) {
+		case "calibre":
+			c.ID = strings.TrimSpace(id.Value)
+			found = true
+		case "uuid":
+			// Not a sign of Calibre on its own: many tools write uuid identifiers.
+			c.UUID = strings.TrimSpace(id.Value)
+		}
+	}
+
+	if v := m.calibreTag("series"); v != "" {
+		c.Series = v
+		found = true
+	}
+	if v := m.calibreTag("series_index"); v != "" {
+		c.SeriesIndex, _ = strconv.ParseFloat(v, 64)
+		found = true
+	}
+	if v := m.calibreTag("rating"); v != "" {
+		c.Rating, _ = strconv.ParseFloat(v, 64)
+		found = true
+	}
+	if v := m.calibreTag("timestamp"); v != "" {
+		c.Timestamp, _ = parseCalibreTime(v)
+		found = true
+	}
+	if v := m.calibreTag("title_sort"); v != "" {
+		c.TitleSort = v
+		found = true
+	}
+	if v := m.calibreTag("author_link_map"); v != "" {
+		found = true
+		if err := json.Unmarshal([]byte(v), &c.AuthorLinkMap); err != nil {
+			errs = append(errs, fmt.Sprintf("author_link_map: %v", err))
+		}
+	}
+
+	// EPUB 2.0: one <meta name="calibre:user_metadata:#col"> per column.
+	keys := make([]string, 0, len(m.OtherTags))
+	for k := range m.OtherTags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		col, ok := strings.CutPrefix(k, "calibre:user_metadata:")
+		if !ok || len(m.OtherTags[k]) == 0 {
+			continue
+		}
+		found = true
+		var cc CalibreColumn
+		if err := json.Unmarshal([]byte(m.OtherTags[k][0]), &cc); err != nil {
+			errs = append(errs, fmt.Sprintf("user_metadata %s: %v", col, err))
+			continue
+		}
+		if c.UserMetadata == nil {
+			c.UserMetadata = make(map[string]CalibreColumn)
+		}
+		c.UserMetadata[col] = cc
+	}
+
+	// EPUB 3.0: a single <meta property="calibre:user_metadata"> JSON object.
+	if v := m.calibreTag("user_metadata"); v != "" {
+		found = true
+		var cols map[string]CalibreColumn
+		if err := json.Unmarshal([]byte(v), &cols); err != nil {
+			errs = append(errs, fmt.Sprintf("user_metadata: %v", err))
+		}
+		for col, cc := range cols {
+			if c.UserMetadata == nil {
+				c.UserMetadata = make(map[string]CalibreColumn)
+			}
+			c.UserMetadata[col] = cc
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+	if len(errs) > 0 {
+		return c, fmt.Errorf("epub: malformed calibre metadata: %s", strings.Join(errs, "; "))
+	}
+	return c, nil
+}
+
+// calibreTag returns the first value of the calibre:<name> meta tag, or "".
+func (m *Metadata) calibreTag(name string) string {
+	if v := m.OtherTags["calibre:"+name]; len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
+
+// parseCalibreTime parses the ISO 8601 timestamps Calibre writes,
+// with or without fractional seconds and timezone.
+func parseCalibreTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ReadCalibreSidecar reads the metadata.opf file Calibre keeps next to the
+// book at epubPath. It returns an error wrapping os.ErrNotExist if there is none.
+func ReadCalibreSidecar(epubPath string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(epubPath), calibreSidecarName))
+	if err != nil {
+		return nil, err
+	}
+
+	var pkg Package
+	if err := xmlDecodeBytes(data, &pkg); err != nil {
+		return nil, err
+	}
+	processRefinements(&pkg.Metadata)
+	return &pkg.Metadata, nil
+}
@@ -0,0 +1,146 @@
+package gopub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCalibreEPUB2(t *testing.T) {
+	md := Metadata{
+		Identifier: []Identifier{
+			{Scheme: "calibre", Value: "42"},
+			{Scheme: "uuid", Value: "0b6a3f2c-0000-4000-8000-000000000000"},
+		},
+		Meta: []MetaTag{
+			{Name: "calibre:series", Content: "Discworld"},
+			{Name: "calibre:series_index", Content: "3.0"},
+			{Name: "calibre:rating", Content: "8.0"},
+			{Name: "calibre:timestamp", Content: "2021-04-05T10:11:12.123456+00:00"},
+			{Name: "calibre:title_sort", Content: "Equal Rites"},
+			{Name: "calibre:author_link_map", Content: `{"Terry Pratchett": "https://example.org"}`},
+			{Name: "calibre:user_metadata:#genre", Content: `{"label": "genre", "name": "Genre", "datatype": "text", "is_multiple": {"cache_to_list": "|", "ui_to_list": ",", "list_to_ui": ", "}, "#value#": ["Fantasy", "Humour"], "#extra#": null}`},
+			{Name: "calibre:user_metadata:#read", Content: `{"label": "read", "name": "Read", "datatype": "bool", "is_multiple": {}, "#value#": true, "#extra#": null}`},
+			{Name: "calibre:user_metadata:#broken", Content: `{not json`},
+		},
+	}
+	processRefinements(&md)
+
+	c, err := md.Calibre()
+	if err == nil {
+		t.Error("expected error for malformed column")
+	}
+	if c == nil {
+		t.Fatal("expected partial Calibre view")
+	}
+	if c.ID != "42" || c.UUID == "" {
+		t.Errorf("identifiers: got %q %q", c.ID, c.UUID)
+	}
+	if c.Series != "Discworld" || c.SeriesIndex != 3 {
+		t.Errorf(expFormat, "Discworld 3", c.Series)
+	}
+	if c.Rating != 8 {
+		t.Errorf(expFormat, 8, c.Rating)
+	}
+	if c.Timestamp.Year() != 2021 {
+		t.Errorf(expFormat, 2021, c.Timestamp)
+	}
+	if c.TitleSort != "Equal Rites" {
+		t.Errorf(expFormat, "Equal Rites", c.TitleSort)
+	}
+	if c.AuthorLinkMap["Terry Pratchett"] != "https://example.org" {
+		t.Errorf(expFormat, "link", c.AuthorLinkMap)
+	}
+
+	genre, ok := c.UserMetadata["#genre"]
+	if !ok || !genre.Multiple() {
+		t.Fatalf("missing multiple #genre column: %+v", c.UserMetadata)
+	}
+	if got := genre.List(); len(got) != 2 || got[1] != "Humour" {
+		t.Errorf(expFormat, "[Fantasy Humour]", got)
+	}
+	if v, ok := c.UserMetadata["#read"].Bool(); !ok || !v {
+		t.Errorf(expFormat, true, v)
+	}
+	if _, ok := c.UserMetadata["#broken"]; ok {
+		t.Error("malformed column should be skipped")
+	}
+}
+
+func TestCalibreEPUB3UserMetadata(t *testing.T) {
+	md := Metadata{
+		Meta: []MetaTag{
+			{Property: "calibre:user_metadata", InnerXML: `{"#pages": {"label": "pages", "datatype": "int", "#value#": 312}}`},
+		},
+	}
+	processRefinements(&md)
+
+	c, err := md.Calibre()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := c.UserMetadata["#pages"].Number(); !ok || v != 312 {
+		t.Errorf(expFormat, 312, v)
+	}
+}
+
+func TestCalibreAbsent(t *testing.T) {
+	for _, md := range []Metadata{
+		{},
+		{Identifier: []Identifier{{Scheme: "uuid", Value: "0b6a3f2c-0000-4000-8000-000000000000"}}},
+	} {
+		processRefinements(&md)
+		if c, err := md.Calibre(); c != nil || err != nil {
+			t.Errorf(expFormat, "nil, nil", c)
+		}
+	}
+}
+
+func TestOpenReaderCalibreSidecar(t *testing.T) {
+	dir := t.TempDir()
+	src, err := os.ReadFile("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	epubPath := filepath.Join(dir, "alice.epub")
+	if err := os.WriteFile(epubPath, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opf := `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata>
+    <dc:title>Alice</dc:title>
+    <dc:identifier opf:scheme="calibre">7</dc:identifier>
+    <meta name="calibre:rating" content="10.0"/>
+  </metadata>
+</package>`
+	if err := os.WriteFile(filepath.Join(dir, "metadata.opf"), []byte(opf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenReader(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if r.Sidecar != nil {
+		t.Error("sidecar read without WithCalibreSidecar")
+	}
+
+	r, err = OpenReader(epubPath, WithCalibreSidecar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Sidecar == nil {
+		t.Fatal("expected sidecar metadata")
+	}
+	c, err := r.Sidecar.Calibre()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != "7" || c.Rating != 10 {
+		t.Errorf(expFormat, "7 10", c)
+	}
+}
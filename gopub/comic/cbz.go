@@ -0,0 +1,139 @@
+package comic
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+)
+
+// WriteCBZ writes the page images of the fixed-layout book rf to w as a
+// CBZ archive, one image per spine item in reading order. Image spine
+// items are used as is; for XHTML and SVG pages, the first image they
+// show is taken. A ComicInfo.xml derived from the metadata comes first,
+// marking the cover, landscape spreads and right-to-left reading.
+func WriteCBZ(w io.Writer, rf *gopub.Rootfile) error {
+	if err := rf.Load(); err != nil {
+		return err
+	}
+	byPath := make(map[string]*gopub.ManifestItem)
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		if item.F != nil {
+			byPath[item.F.Name] = item
+		}
+	}
+
+	ci := FromMetadata(&rf.Metadata)
+	if rf.Spine.PPD == "rtl" {
+		ci.Manga = "YesAndRightToLeft"
+	}
+	var images []*gopub.ManifestItem
+	for _, ref := range rf.Spine.Itemrefs {
+		img, err := pageImage(ref.ManifestItem, byPath)
+		if err != nil {
+			return err
+		}
+		if img == nil || (len(images) > 0 && images[len(images)-1] == img) {
+			continue
+		}
+		p := Page{Image: len(images)}
+		if img.ID == rf.Metadata.CoverManifestId || strings.Contains(" "+img.Properties+" ", " cover-image ") {
+			p.Type = "FrontCover"
+		}
+		p.DoublePage = strings.Contains(ref.SpineProperties, "page-spread-center")
+		if p.Type != "" || p.DoublePage {
+			ci.Pages = append(ci.Pages, p)
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return ErrNoPages
+	}
+	ci.PageCount = strconv.Itoa(len(images))
+
+	zw := zip.NewWriter(w)
+	f, err := zw.Create(ComicInfoName)
+	if err != nil {
+		return err
+	}
+	if err := ci.Encode(f); err != nil {
+		return err
+	}
+	width := max(3, len(strconv.Itoa(len(images))))
+	for i, img := range images {
+		data, err := img.ReadAll()
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%0*d%s", width, i+1, strings.ToLower(path.Ext(img.F.Name)))
+		// Images are already compressed.
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: img.F.Modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// WriteCBZFile writes the page images of rf to the CBZ file name.
+func WriteCBZFile(name string, rf *gopub.Rootfile) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = WriteCBZ(f, rf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// pageImage returns the image shown by the spine item, or nil.
+func pageImage(item *gopub.ManifestItem, byPath map[string]*gopub.ManifestItem) (*gopub.ManifestItem, error) {
+	if item == nil || item.F == nil {
+		return nil, nil
+	}
+	switch item.MediaType {
+	case gopub.MediaTypeXHTML, gopub.MediaTypeHTML, gopub.MediaTypeSVG:
+	default:
+		if strings.HasPrefix(item.MediaType, "image/") {
+			return item, nil
+		}
+		return nil, nil
+	}
+	data, err := item.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := xhtml.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var img *gopub.ManifestItem
+	xhtml.Walk(doc, func(n *html.Node) {
+		if img != nil || (n.Data != "img" && n.Data != "image") {
+			return
+		}
+		for _, key := range []string{"src", "href", "xlink:href"} {
+			target, _, ok := xhtml.Resolve(item.F.Name, xhtml.Attr(n, key))
+			if found := byPath[target]; ok && found != nil && strings.HasPrefix(found.MediaType, "image/") && found.MediaType != gopub.MediaTypeSVG {
+				img = found
+				return
+			}
+		}
+	})
+	return img, nil
+}
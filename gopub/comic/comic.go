@@ -0,0 +1,470 @@
+// Package comic converts between comic archives and fixed-layout EPUB 3
+// books. Build turns a directory or CBZ of page images into a
+// pre-paginated EPUB with one XHTML page per image; WriteCBZ extracts the
+// page images of a fixed-layout book, in spine order, into a CBZ.
+package comic
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/uuid"
+	"github.com/LapisApple/go-epub/gopub/internal/ziplimit"
+)
+
+// ErrNoPages is returned when there are no page images to convert.
+var ErrNoPages = errors.New("comic: no page images")
+
+// DefaultSpread is the rendition:spread value used when Options.Spread is
+// empty: two pages side by side in landscape orientation.
+const DefaultSpread = "landscape"
+
+const (
+	opfDir    = "OEBPS"
+	styleHREF = "style.css"
+)
+
+// pageCSS makes every page fill its viewport.
+const pageCSS = `html, body { margin: 0; padding: 0; width: 100%; height: 100%; }
+img { display: block; width: 100%; height: 100%; object-fit: contain; }
+`
+
+// Options configures Build.
+type Options struct {
+	// Metadata describes the book. Fields it sets take precedence over
+	// those read from ComicInfo.xml. A missing identifier is generated as
+	// a urn:uuid and the language defaults to "und".
+	Metadata gopub.Metadata
+	// RTL lays the pages out right to left. It is also enabled by a
+	// ComicInfo.xml with Manga set to YesAndRightToLeft.
+	RTL bool
+	// Spread is the rendition:spread value. Defaults to DefaultSpread.
+	Spread string
+}
+
+// imageTypes are the page image media types by file extension.
+var imageTypes = map[string]string{
+	".jpg":  gopub.MediaTypeJPEG,
+	".jpeg": gopub.MediaTypeJPEG,
+	".png":  gopub.MediaTypePNG,
+	".gif":  gopub.MediaTypeGIF,
+	".webp": gopub.MediaTypeWEBP,
+}
+
+// page is a page image found in the source.
+type page struct {
+	name          string
+	ext           string
+	width, height int
+}
+
+// Build writes a fixed-layout EPUB 3 book to w with one page per image
+// found in src, ordered by path with numbers compared by value, so that
+// "page2.jpg" precedes "page10.jpg". src is typically os.DirFS or a
+// *zip.Reader. A ComicInfo.xml in src supplies metadata and bookmarks;
+// the first page is the cover. Pages are placed alternately on the right
+// and left of a spread, starting on the right (left for RTL); landscape
+// images fill a whole spread.
+func Build(w io.Writer, src fs.FS, opts *Options) error {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	return build(w, src, &o, "Untitled")
+}
+
+// build is Build with the title used when neither the options nor
+// ComicInfo.xml name the book.
+func build(w io.Writer, src fs.FS, o *Options, title string) error {
+	pages, ci, err := readSource(src)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return ErrNoPages
+	}
+	md := gopub.Metadata{}
+	if ci != nil {
+		md = ci.ToMetadata()
+		o.RTL = o.RTL || ci.RightToLeft()
+	}
+	mergeMetadata(&md, &o.Metadata)
+	fillMetadata(&md, title)
+	if o.Spread == "" {
+		o.Spread = DefaultSpread
+	}
+	for _, key := range []string{"rendition:layout", "rendition:orientation", "rendition:spread"} {
+		delete(md.OtherTags, key)
+	}
+	md.OtherTags["rendition:layout"] = []string{"pre-paginated"}
+	md.OtherTags["rendition:orientation"] = []string{"auto"}
+	md.OtherTags["rendition:spread"] = []string{o.Spread}
+	md.CoverManifestId = "img001"
+
+	rf := &gopub.Rootfile{FullPath: opfDir + "/content.opf"}
+	rf.Version = "3.0"
+	rf.Metadata = md
+	rf.UniqueIdentifier = "uid"
+	if md.Identifier[0].ID != "" {
+		rf.UniqueIdentifier = md.Identifier[0].ID
+	}
+	rf.Spine.Toc = "ncx"
+	if o.RTL {
+		rf.Spine.PPD = "rtl"
+	}
+	rf.Manifest.Items = []gopub.ManifestItem{
+		{ID: "nav", HREF: "nav.xhtml", MediaType: gopub.MediaTypeXHTML, Properties: "nav"},
+		{ID: "ncx", HREF: "toc.ncx", MediaType: gopub.MediaTypeNCX},
+		{ID: "css", HREF: styleHREF, MediaType: gopub.MediaTypeCSS},
+	}
+
+	ew := gopub.NewWriter(w)
+	first := "right"
+	if o.RTL {
+		first = "left"
+	}
+	side := first
+	var pageList []gopub.NavItem
+	for i, p := range pages {
+		n := fmt.Sprintf("%03d", i+1)
+		img := gopub.ManifestItem{ID: "img" + n, HREF: "images/p" + n + p.ext, MediaType: imageTypes[p.ext]}
+		if i == 0 {
+			img.Properties = "cover-image"
+		}
+		doc := gopub.ManifestItem{ID: "page" + n, HREF: "p" + n + ".xhtml", MediaType: gopub.MediaTypeXHTML}
+		rf.Manifest.Items = append(rf.Manifest.Items, doc, img)
+
+		ref := gopub.SpineItem{IDREF: doc.ID}
+		if p.width > p.height {
+			ref.SpineProperties = "rendition:page-spread-center"
+			side = first
+		} else {
+			ref.SpineProperties = "rendition:page-spread-" + side
+			side = map[string]string{"left": "right", "right": "left"}[side]
+		}
+		rf.Spine.Itemrefs = append(rf.Spine.Itemrefs, ref)
+		pageList = append(pageList, navItem(strconv.Itoa(i+1), doc.HREF, ""))
+
+		if err := copyPage(ew, opfDir+"/"+img.HREF, src, p.name); err != nil {
+			return err
+		}
+		if err := ew.WriteFile(opfDir+"/"+doc.HREF, pageDocument(i+1, p, img.HREF)); err != nil {
+			return err
+		}
+	}
+
+	toc := bookmarks(ci, len(pages))
+	if len(toc) == 0 {
+		toc = []gopub.NavItem{navItem(md.MainTitle().Name, "p001.xhtml", "")}
+	}
+	landmarks := []gopub.NavItem{navItem("Cover", "p001.xhtml", "cover")}
+	if len(pages) > 1 {
+		landmarks = append(landmarks, navItem("Start", "p002.xhtml", "bodymatter"))
+	}
+	rf.NavDoc.Navs = []gopub.NavSection{
+		{Type: "toc", Items: toc},
+		{Type: "landmarks", Items: landmarks},
+		{Type: "page-list", Items: pageList},
+	}
+	for _, item := range toc {
+		var np gopub.NavPoint
+		np.NavLabel.Text = item.Link.Text
+		np.Content.Src = item.Link.Href
+		rf.NCX.NavPoints = append(rf.NCX.NavPoints, np)
+	}
+
+	if err := ew.WriteFile(opfDir+"/"+styleHREF, []byte(pageCSS)); err != nil {
+		return err
+	}
+	for _, doc := range []struct {
+		name  string
+		write func(io.Writer) error
+	}{{"nav.xhtml", rf.WriteNav}, {"toc.ncx", rf.WriteNCX}} {
+		f, err := ew.Create(opfDir + "/" + doc.name)
+		if err != nil {
+			return err
+		}
+		if err := doc.write(f); err != nil {
+			return err
+		}
+	}
+	if err := ew.AddRootfile(rf); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// BuildFile converts the directory or CBZ/ZIP archive src to a
+// fixed-layout EPUB written to the file name. Archives are read within
+// gopub.RecommendedLimits, adjusted by limits such as gopub.WithMaxFileSize.
+// A book without a title is named after src.
+func BuildFile(name, src string, opts *Options, limits ...gopub.Option) error {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	var fsys fs.FS
+	if fi.IsDir() {
+		fsys = os.DirFS(src)
+	} else {
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		l := gopub.RecommendedLimits()
+		for _, opt := range limits {
+			opt(&l)
+		}
+		fsys, err = ziplimit.FS(&zr.Reader, ziplimit.Limits{
+			MaxFileSize:         l.MaxFileSize,
+			MaxEntries:          l.MaxEntries,
+			MaxTotalSize:        l.MaxTotalSize,
+			MaxCompressionRatio: l.MaxCompressionRatio,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = build(f, fsys, &o, strings.TrimSuffix(fi.Name(), path.Ext(fi.Name())))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readSource collects the page images of src, reading only as much of each
+// as its dimensions take, and its ComicInfo.xml.
+func readSource(src fs.FS) ([]*page, *ComicInfo, error) {
+	var names []string
+	var ci *ComicInfo
+	err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		base := d.Name()
+		if name != "." && (strings.HasPrefix(base, ".") || base == "__MACOSX") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.EqualFold(base, ComicInfoName) && ci == nil {
+			f, err := src.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if ci, err = ReadComicInfo(f); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		}
+		if imageTypes[strings.ToLower(path.Ext(base))] != "" {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	slices.SortFunc(names, naturalCompare)
+
+	pages := make([]*page, 0, len(names))
+	for _, name := range names {
+		p := &page{name: name, ext: strings.ToLower(path.Ext(name))}
+		if p.ext == ".jpeg" {
+			p.ext = ".jpg"
+		}
+		f, err := src.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.width, p.height, err = gopub.ReadImageSize(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		pages = append(pages, p)
+	}
+	return pages, ci, nil
+}
+
+// copyPage writes the page image name of src to the entry dst of ew.
+func copyPage(ew *gopub.Writer, dst string, src fs.FS, name string) error {
+	f, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := ew.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// naturalCompare orders paths case-insensitively, comparing runs of
+// digits by their numeric value.
+func naturalCompare(a, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if c := len(na) - len(nb); c != 0 {
+				return c
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// pageDocument returns the XHTML page showing the image at href, with a
+// viewport of the image's size.
+func pageDocument(n int, p *page, href string) []byte {
+	title := "Page " + strconv.Itoa(n)
+	return fmt.Appendf(nil, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+<title>%s</title>
+<meta name="viewport" content="width=%d, height=%d"/>
+<link rel="stylesheet" type="text/css" href="%s"/>
+</head>
+<body>
+<img src="%s" alt="%s"/>
+</body>
+</html>
+`, title, p.width, p.height, styleHREF, href, title)
+}
+
+// bookmarks returns TOC entries for the bookmarked pages of ci.
+func bookmarks(ci *ComicInfo, pages int) []gopub.NavItem {
+	if ci == nil {
+		return nil
+	}
+	var items []gopub.NavItem
+	for _, p := range ci.Pages {
+		if p.Bookmark != "" && p.Image >= 0 && p.Image < pages {
+			items = append(items, navItem(p.Bookmark, fmt.Sprintf("p%03d.xhtml", p.Image+1), ""))
+		}
+	}
+	return items
+}
+
+func navItem(text, href, typ string) gopub.NavItem {
+	var item gopub.NavItem
+	item.Link.Text = text
+	item.Link.Href = href
+	item.Link.Type = typ
+	return item
+}
+
+// mergeMetadata copies the fields set in src over dst.
+func mergeMetadata(dst, src *gopub.Metadata) {
+	if len(src.Title) > 0 {
+		dst.Title = src.Title
+	}
+	set := func(d *[]string, s []string) {
+		if len(s) > 0 {
+			*d = s
+		}
+	}
+	set(&dst.Language, src.Language)
+	set(&dst.Subject, src.Subject)
+	set(&dst.Rights, src.Rights)
+	if len(src.Identifier) > 0 {
+		dst.Identifier = src.Identifier
+	}
+	if len(src.Creator) > 0 {
+		dst.Creator = src.Creator
+	}
+	if len(src.Contributor) > 0 {
+		dst.Contributor = src.Contributor
+	}
+	if len(src.Publisher) > 0 {
+		dst.Publisher = src.Publisher
+	}
+	if len(src.Event) > 0 {
+		dst.Event = src.Event
+	}
+	for _, f := range []struct{ d, s *string }{
+		{&dst.Description, &src.Description},
+		{&dst.Source, &src.Source},
+		{&dst.Series, &src.Series},
+		{&dst.SeriesIndex, &src.SeriesIndex},
+		{&dst.Modified, &src.Modified},
+	} {
+		if *f.s != "" {
+			*f.d = *f.s
+		}
+	}
+	if len(src.OtherTags) > 0 && dst.OtherTags == nil {
+		dst.OtherTags = make(map[string][]string)
+	}
+	for k, v := range src.OtherTags {
+		dst.OtherTags[k] = v
+	}
+}
+
+// fillMetadata sets the identifier, title, language and modification date
+// an EPUB 3 package requires.
+func fillMetadata(md *gopub.Metadata, title string) {
+	if len(md.Title) == 0 {
+		md.Title = []gopub.Title{{Refinable: gopub.Refinable{Name: title}}}
+	}
+	if len(md.Identifier) == 0 {
+		md.Identifier = []gopub.Identifier{{Value: "urn:uuid:" + uuid.New()}}
+	}
+	if len(md.Language) == 0 {
+		md.Language = []string{"und"}
+	}
+	if md.Modified == "" {
+		md.Modified = time.Now().UTC().Format(time.RFC3339)
+	}
+	if md.OtherTags == nil {
+		md.OtherTags = make(map[string][]string)
+	}
+}
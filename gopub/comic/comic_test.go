@@ -0,0 +1,242 @@
+package comic
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+const comicInfo = `<?xml version="1.0"?>
+<ComicInfo>
+  <Series>Saga</Series>
+  <Number>3</Number>
+  <Writer>Ann Writer</Writer>
+  <Penciller>Pen One, Pen Two</Penciller>
+  <Genre>Fantasy, Drama</Genre>
+  <Year>2021</Year>
+  <Month>4</Month>
+  <LanguageISO>ja</LanguageISO>
+  <Manga>YesAndRightToLeft</Manga>
+  <GTIN>9780000000002</GTIN>
+  <Pages>
+    <Page Image="0" Type="FrontCover"/>
+    <Page Image="2" Bookmark="Chapter 1"/>
+  </Pages>
+</ComicInfo>`
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testFS(t *testing.T) fstest.MapFS {
+	return fstest.MapFS{
+		"ComicInfo.xml":           {Data: []byte(comicInfo)},
+		"pages/page10.png":        {Data: testPNG(t, 8, 12)},
+		"pages/page2.png":         {Data: testPNG(t, 8, 12)},
+		"pages/page1.PNG":         {Data: testPNG(t, 8, 12)},
+		"pages/page3-spread.png":  {Data: testPNG(t, 16, 12)},
+		"pages/.hidden.png":       {Data: []byte("junk")},
+		"__MACOSX/page1.png":      {Data: []byte("junk")},
+		"pages/notes.txt":         {Data: []byte("ignored")},
+		"pages/page4.png":         {Data: testPNG(t, 8, 12)},
+		"pages/page5.png":         {Data: testPNG(t, 8, 12)},
+		"pages/sub/page11.png":    {Data: testPNG(t, 8, 12)},
+		"pages/sub/.DS_Store/x.x": {Data: []byte("junk")},
+	}
+}
+
+func buildComic(t *testing.T, fsys fstest.MapFS, opts *Options) *gopub.Rootfile {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Build(&buf, fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gopub.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.DefaultRendition()
+}
+
+func TestBuild(t *testing.T) {
+	md := gopub.Metadata{Title: []gopub.Title{{Refinable: gopub.Refinable{Name: "Saga, Vol. 3"}}}}
+	rf := buildComic(t, testFS(t), &Options{Metadata: md})
+
+	got := rf.Metadata
+	if got.MainTitle().Name != "Saga, Vol. 3" || got.Series != "Saga" || got.SeriesIndex != "3" || got.PrimaryLanguage() != "ja" {
+		t.Errorf("metadata: %+v", got)
+	}
+	if got.Creator[0].Name != "Ann Writer" || len(got.Contributor) != 2 || got.Contributor[1].CreatorRole != "art" {
+		t.Errorf("creators: %+v %+v", got.Creator, got.Contributor)
+	}
+	if got.Identifier[0].Value != "urn:isbn:9780000000002" || got.Event[0].Date != "2021-04" {
+		t.Errorf("identifier and date: %+v %+v", got.Identifier, got.Event)
+	}
+	for key, want := range map[string]string{"rendition:layout": "pre-paginated", "rendition:spread": "landscape"} {
+		if v := got.OtherTags[key]; len(v) != 1 || v[0] != want {
+			t.Errorf("%s: "+expFormat, key, want, v)
+		}
+	}
+	if rf.Spine.PPD != "rtl" {
+		t.Errorf("page progression: "+expFormat, "rtl", rf.Spine.PPD)
+	}
+
+	var spreads []string
+	for _, ref := range rf.Spine.Itemrefs {
+		spreads = append(spreads, strings.TrimPrefix(ref.SpineProperties, "rendition:page-spread-"))
+	}
+	want := []string{"left", "right", "center", "left", "right", "left", "right"}
+	if !slices.Equal(spreads, want) {
+		t.Errorf("spreads: "+expFormat, want, spreads)
+	}
+
+	var cover *gopub.ManifestItem
+	for i := range rf.Manifest.Items {
+		if rf.Manifest.Items[i].ID == got.CoverManifestId {
+			cover = &rf.Manifest.Items[i]
+		}
+	}
+	if cover == nil || cover.HREF != "images/p001.png" || cover.Properties != "cover-image" {
+		t.Errorf("cover: %+v", cover)
+	}
+	for _, ref := range rf.Spine.Itemrefs[2:3] {
+		data, err := ref.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `<meta name="viewport" content="width=16, height=12"/>`) {
+			t.Errorf("page viewport:\n%s", data)
+		}
+	}
+	if toc := rf.TOCNav().Items; len(toc) != 1 || toc[0].Link.Text != "Chapter 1" || toc[0].Link.Href != "p003.xhtml" {
+		t.Errorf("toc: %+v", toc)
+	}
+	if pages := rf.NavDoc.Navs[2]; pages.Type != "page-list" || len(pages.Items) != 7 {
+		t.Errorf("page list: %+v", pages)
+	}
+
+	if err := Build(&bytes.Buffer{}, fstest.MapFS{"a.txt": {}}, nil); !errors.Is(err, ErrNoPages) {
+		t.Errorf(expFormat, ErrNoPages, err)
+	}
+}
+
+func TestWriteCBZ(t *testing.T) {
+	fsys := testFS(t)
+	rf := buildComic(t, fsys, nil)
+	var buf bytes.Buffer
+	if err := WriteCBZ(&buf, rf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{ComicInfoName, "001.png", "002.png", "003.png", "004.png", "005.png", "006.png", "007.png"}
+	if !slices.Equal(names, want) {
+		t.Errorf("entries: "+expFormat, want, names)
+	}
+	f, err := zr.Open("003.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if w, h, err := gopub.ReadImageSize(f); err != nil || w != 16 || h != 12 {
+		t.Errorf("003.png size: %d %d %v", w, h, err)
+	}
+
+	f, err = zr.Open(ComicInfoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ci, err := ReadComicInfo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci.Series != "Saga" || ci.Number != "3" || ci.Penciller != "Pen One, Pen Two" || !ci.RightToLeft() {
+		t.Errorf("comic info: %+v", ci)
+	}
+	if ci.PageCount != "7" || ci.GTIN != "9780000000002" || ci.Year != "2021" || ci.Month != "4" {
+		t.Errorf("comic info: %+v", ci)
+	}
+	wantPages := []Page{{Image: 0, Type: "FrontCover"}, {Image: 2, DoublePage: true}}
+	if !slices.Equal(ci.Pages, wantPages) {
+		t.Errorf("pages: "+expFormat, wantPages, ci.Pages)
+	}
+}
+
+func TestBuildFileLimits(t *testing.T) {
+	dir := t.TempDir()
+	cbz := filepath.Join(dir, "book.cbz")
+	f, err := os.Create(cbz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"p1.png", "p2.png"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(testPNG(t, 800, 1200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out := filepath.Join(dir, "book.epub")
+	if err := BuildFile(out, cbz, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gopub.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := r.DefaultRendition().Metadata.MainTitle().Name; got != "book" {
+		t.Errorf(expFormat, "book", got)
+	}
+
+	if err := BuildFile(out, cbz, nil, gopub.WithMaxTotalSize(100)); !errors.Is(err, gopub.ErrTotalSizeTooLarge) {
+		t.Errorf(expFormat, gopub.ErrTotalSizeTooLarge, err)
+	}
+	if err := BuildFile(out, cbz, nil, gopub.WithMaxFileSize(100)); !errors.Is(err, gopub.ErrFileTooLarge) {
+		t.Errorf(expFormat, gopub.ErrFileTooLarge, err)
+	}
+	if err := BuildFile(out, cbz, nil, gopub.WithMaxEntries(1)); !errors.Is(err, gopub.ErrTooManyEntries) {
+		t.Errorf(expFormat, gopub.ErrTooManyEntries, err)
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	names := []string{"b/10.png", "a10.png", "a2.png", "A1.png", "a02b.png", "b/9.png"}
+	slices.SortFunc(names, naturalCompare)
+	want := []string{"A1.png", "a2.png", "a02b.png", "a10.png", "b/9.png", "b/10.png"}
+	if !slices.Equal(names, want) {
+		t.Errorf(expFormat, want, names)
+	}
+}
+
+const expFormat = "Expected: %v, but got: %v\n"
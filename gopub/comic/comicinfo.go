@@ -0,0 +1,229 @@
+package comic
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+// ComicInfoName is the file name of the ComicInfo metadata in a CBZ.
+const ComicInfoName = "ComicInfo.xml"
+
+// ComicInfo is the ComicRack ComicInfo.xml metadata of a comic archive.
+// Numeric fields are kept as text, as they are often malformed.
+type ComicInfo struct {
+	XMLName     xml.Name `xml:"ComicInfo"`
+	Title       string   `xml:"Title,omitempty"`
+	Series      string   `xml:"Series,omitempty"`
+	Number      string   `xml:"Number,omitempty"`
+	Count       string   `xml:"Count,omitempty"`
+	Volume      string   `xml:"Volume,omitempty"`
+	Summary     string   `xml:"Summary,omitempty"`
+	Notes       string   `xml:"Notes,omitempty"`
+	Year        string   `xml:"Year,omitempty"`
+	Month       string   `xml:"Month,omitempty"`
+	Day         string   `xml:"Day,omitempty"`
+	Writer      string   `xml:"Writer,omitempty"`
+	Penciller   string   `xml:"Penciller,omitempty"`
+	Inker       string   `xml:"Inker,omitempty"`
+	Colorist    string   `xml:"Colorist,omitempty"`
+	Letterer    string   `xml:"Letterer,omitempty"`
+	CoverArtist string   `xml:"CoverArtist,omitempty"`
+	Editor      string   `xml:"Editor,omitempty"`
+	Translator  string   `xml:"Translator,omitempty"`
+	Publisher   string   `xml:"Publisher,omitempty"`
+	Imprint     string   `xml:"Imprint,omitempty"`
+	Genre       string   `xml:"Genre,omitempty"`
+	Tags        string   `xml:"Tags,omitempty"`
+	Web         string   `xml:"Web,omitempty"`
+	PageCount   string   `xml:"PageCount,omitempty"`
+	LanguageISO string   `xml:"LanguageISO,omitempty"`
+	Format      string   `xml:"Format,omitempty"`
+	AgeRating   string   `xml:"AgeRating,omitempty"`
+	// Manga is "Yes", "No" or "YesAndRightToLeft".
+	Manga string `xml:"Manga,omitempty"`
+	GTIN  string `xml:"GTIN,omitempty"`
+	Pages []Page `xml:"Pages>Page,omitempty"`
+}
+
+// Page describes one image of the archive, by index.
+type Page struct {
+	Image int `xml:"Image,attr"`
+	// Type is e.g. "FrontCover", "Story" or "BackCover".
+	Type        string `xml:"Type,attr,omitempty"`
+	DoublePage  bool   `xml:"DoublePage,attr,omitempty"`
+	Bookmark    string `xml:"Bookmark,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr,omitempty"`
+	ImageHeight int    `xml:"ImageHeight,attr,omitempty"`
+}
+
+// contributorFields maps the ComicInfo creator fields to MARC relators.
+var contributorFields = []struct {
+	role  string
+	field func(*ComicInfo) *string
+}{
+	{"aut", func(c *ComicInfo) *string { return &c.Writer }},
+	{"art", func(c *ComicInfo) *string { return &c.Penciller }},
+	{"ill", func(c *ComicInfo) *string { return &c.Inker }},
+	{"clr", func(c *ComicInfo) *string { return &c.Colorist }},
+	{"ctb", func(c *ComicInfo) *string { return &c.Letterer }},
+	{"cov", func(c *ComicInfo) *string { return &c.CoverArtist }},
+	{"edt", func(c *ComicInfo) *string { return &c.Editor }},
+	{"trl", func(c *ComicInfo) *string { return &c.Translator }},
+}
+
+// ReadComicInfo decodes a ComicInfo.xml document.
+func ReadComicInfo(r io.Reader) (*ComicInfo, error) {
+	var ci ComicInfo
+	if err := xml.NewDecoder(r).Decode(&ci); err != nil {
+		return nil, err
+	}
+	return &ci, nil
+}
+
+// Encode writes ci as an indented ComicInfo.xml document.
+func (ci *ComicInfo) Encode(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(ci); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// RightToLeft reports whether the comic is read right to left.
+func (ci *ComicInfo) RightToLeft() bool {
+	return strings.EqualFold(ci.Manga, "YesAndRightToLeft")
+}
+
+// ToMetadata maps ci to EPUB metadata. The writer is the creator; the other
+// credited roles become contributors with their MARC relator.
+func (ci *ComicInfo) ToMetadata() gopub.Metadata {
+	var md gopub.Metadata
+	title := strings.TrimSpace(ci.Title)
+	if title == "" && ci.Series != "" {
+		title = strings.TrimSpace(ci.Series + " " + ci.Number)
+	}
+	if title != "" {
+		md.Title = []gopub.Title{{Refinable: gopub.Refinable{Name: title}}}
+	}
+	md.Series = ci.Series
+	md.SeriesIndex = ci.Number
+	md.Description = ci.Summary
+	for _, f := range contributorFields {
+		for _, name := range splitList(*f.field(ci)) {
+			c := gopub.Creator{Refinable: gopub.Refinable{Name: name}, CreatorRole: f.role}
+			if f.role == "aut" {
+				md.Creator = append(md.Creator, c)
+			} else {
+				md.Contributor = append(md.Contributor, c)
+			}
+		}
+	}
+	if ci.Publisher != "" {
+		md.Publisher = []gopub.Refinable{{Name: ci.Publisher}}
+	}
+	md.Subject = append(splitList(ci.Genre), splitList(ci.Tags)...)
+	if ci.LanguageISO != "" {
+		md.Language = []string{ci.LanguageISO}
+	}
+	if date := ci.date(); date != "" {
+		md.Event = []gopub.Date{{Date: date}}
+	}
+	if gtin := strings.TrimSpace(ci.GTIN); gtin != "" {
+		if len(gtin) == 13 && (strings.HasPrefix(gtin, "978") || strings.HasPrefix(gtin, "979")) {
+			md.Identifier = []gopub.Identifier{{Value: "urn:isbn:" + gtin}}
+		} else {
+			md.Identifier = []gopub.Identifier{{Scheme: "GTIN", Value: gtin}}
+		}
+	}
+	md.Source = ci.Web
+	return md
+}
+
+// date returns the publication date as YYYY, YYYY-MM or YYYY-MM-DD.
+func (ci *ComicInfo) date() string {
+	var year, month, day int
+	if _, err := fmt.Sscan(ci.Year, &year); err != nil || year <= 0 {
+		return ""
+	}
+	date := fmt.Sprintf("%04d", year)
+	if _, err := fmt.Sscan(ci.Month, &month); err == nil && month >= 1 && month <= 12 {
+		date += fmt.Sprintf("-%02d", month)
+		if _, err := fmt.Sscan(ci.Day, &day); err == nil && day >= 1 && day <= 31 {
+			date += fmt.Sprintf("-%02d", day)
+		}
+	}
+	return date
+}
+
+// FromMetadata maps EPUB metadata to ComicInfo, the reverse of ToMetadata.
+// Creators without a role are credited as writers.
+func FromMetadata(md *gopub.Metadata) ComicInfo {
+	ci := ComicInfo{
+		Title:       md.MainTitle().Name,
+		Series:      md.Series,
+		Number:      md.SeriesIndex,
+		Summary:     md.Description,
+		Publisher:   md.PrimaryPublisher().Name,
+		Genre:       strings.Join(md.Subject, ", "),
+		LanguageISO: md.PrimaryLanguage(),
+	}
+	for _, c := range append(append([]gopub.Creator(nil), md.Creator...), md.Contributor...) {
+		role := c.CreatorRole
+		if role == "" {
+			role = "aut"
+		}
+		for _, f := range contributorFields {
+			if f.role == role {
+				field := f.field(&ci)
+				if *field != "" {
+					*field += ", "
+				}
+				*field += c.Name
+				break
+			}
+		}
+	}
+	if len(md.Event) > 0 {
+		parts := strings.SplitN(md.Event[0].Date, "-", 3)
+		ci.Year = parts[0]
+		if len(parts) > 1 {
+			ci.Month = strings.TrimLeft(parts[1], "0")
+		}
+		if len(parts) > 2 && len(parts[2]) >= 2 {
+			ci.Day = strings.TrimLeft(parts[2][:2], "0")
+		}
+	}
+	for _, id := range md.Identifier {
+		if isbn, ok := strings.CutPrefix(id.Value, "urn:isbn:"); ok {
+			ci.GTIN = isbn
+			break
+		}
+		if strings.EqualFold(id.Scheme, "ISBN") || strings.EqualFold(id.Scheme, "GTIN") {
+			ci.GTIN = id.Value
+			break
+		}
+	}
+	if strings.HasPrefix(md.Source, "http://") || strings.HasPrefix(md.Source, "https://") {
+		ci.Web = md.Source
+	}
+	return ci
+}
+
+func splitList(s string) []string {
+	var out []string
+	for v := range strings.SplitSeq(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -1,5 +1,7 @@
 package gopub
 
+import "sync"
+
 const containerPath = "META-INF/container.xml"
 
 // Rootfile contains the location of an epub .opf file.
@@ -8,6 +10,10 @@ type Rootfile struct {
 	Package
 	NCX
 	NavDoc
+
+	r       *Reader // the Reader Load parses from in ModeLazy, or nil
+	once    sync.Once
+	loadErr error
 }
 
 // Container serves as a directory of Rootfiles.
@@ -24,8 +30,12 @@ func (c *Container) DefaultRendition() *Rootfile {
 }
 
 // ItemName looks up a display name for the given item href.
-// Tries EPUB 3.0 NavDoc first, falls back to EPUB 2.0 NCX.
+// Tries EPUB 3.0 NavDoc first, falls back to EPUB 2.0 NCX. With ModeLazy it
+// returns "" if Load fails.
 func (rf *Rootfile) ItemName(href string) string {
+	if rf.Load() != nil {
+		return ""
+	}
 	if label := rf.navItemName(href); label != "" {
 		return label
 	}
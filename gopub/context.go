@@ -0,0 +1,62 @@
+package gopub
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// ctxReaderAt fails reads once its context is done. Storing nil detaches
+// the context so the Reader keeps working after opening.
+type ctxReaderAt struct {
+	ra  io.ReaderAt
+	ctx atomic.Pointer[context.Context]
+}
+
+func (c *ctxReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if ctx := c.ctx.Load(); ctx != nil {
+		if err := (*ctx).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return c.ra.ReadAt(p, off)
+}
+
+// ctxReadCloser fails reads once ctx is done.
+type ctxReadCloser struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (c *ctxReadCloser) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.ReadCloser.Read(p)
+}
+
+// OpenContext is like Open, but reads from the returned stream fail with
+// ctx.Err() once ctx is cancelled or its deadline passes.
+func (item *ManifestItem) OpenContext(ctx context.Context) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := item.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &ctxReadCloser{ReadCloser: rc, ctx: ctx}, nil
+}
+
+// ReadAllContext is like ReadAll but stops reading once ctx is done.
+func (item *ManifestItem) ReadAllContext(ctx context.Context) ([]byte, error) {
+	if item.r != nil {
+		return item.r.readItemContext(ctx, item)
+	}
+	f, err := item.OpenContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,106 @@
+package gopub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// cancelAfterReaderAt cancels a context after n reads.
+type cancelAfterReaderAt struct {
+	ra     io.ReaderAt
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfterReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if c.n--; c.n == 0 {
+		c.cancel()
+	}
+	return c.ra.ReadAt(p, off)
+}
+
+func TestNewReaderContext(t *testing.T) {
+	data, err := os.ReadFile("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewReaderContext(ctx, bytes.NewReader(data), size); !errors.Is(err, context.Canceled) {
+		t.Errorf(expFormat, context.Canceled, err)
+	}
+
+	// Cancel part-way through opening, after the ZIP directory is read.
+	for _, n := range []int{3, 5, 8} {
+		ctx, cancel := context.WithCancel(context.Background())
+		ra := &cancelAfterReaderAt{ra: bytes.NewReader(data), n: n, cancel: cancel}
+		if _, err := NewReaderContext(ctx, ra, size); !errors.Is(err, context.Canceled) {
+			t.Errorf("cancel after %d reads: "+expFormat, n, context.Canceled, err)
+		}
+	}
+
+	// The context only governs opening.
+	ctx, cancel = context.WithCancel(context.Background())
+	r, err := NewReaderContext(ctx, bytes.NewReader(data), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	item := &r.DefaultRendition().Manifest.Items[0]
+	if _, err := item.ReadAll(); err != nil {
+		t.Error(err)
+	}
+	if _, err := item.ReadAllContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf(expFormat, context.Canceled, err)
+	}
+	if _, err := r.FindCoverContext(ctx); err != nil {
+		t.Errorf("declared cover needs no reads: %v", err)
+	}
+}
+
+func TestOpenContext(t *testing.T) {
+	r, err := OpenReaderContext(context.Background(), "_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := r.DefaultRendition().Manifest.Items[0].OpenContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	if _, err := f.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := f.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Errorf(expFormat, context.Canceled, err)
+	}
+	if _, err := r.DefaultRendition().Manifest.Items[0].OpenContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf(expFormat, context.Canceled, err)
+	}
+}
+
+func TestFindCoverContext(t *testing.T) {
+	r := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf": coverTestOPF(`<item id="p" href="p.png" media-type="image/png"/>`, `<itemref idref="p"/>`),
+		"OEBPS/p.png":       testPNG(t, 300, 600),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.FindCoverContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf(expFormat, context.Canceled, err)
+	}
+	if c, err := r.FindCover(); err != nil || c.Strategy != CoverFromLargestImage {
+		t.Errorf(expFormat, CoverFromLargestImage, c.Strategy)
+	}
+}
@@ -0,0 +1,282 @@
+package gopub
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CoverStrategy names the rule that located a cover.
+type CoverStrategy string
+
+const (
+	// CoverFromMetadata: <meta name="cover"> or the cover-image manifest property.
+	CoverFromMetadata CoverStrategy = "metadata"
+	// CoverFromGuide: EPUB 2.0 <guide><reference type="cover">.
+	CoverFromGuide CoverStrategy = "guide"
+	// CoverFromLandmarks: EPUB 3.0 landmarks entry with epub:type="cover".
+	CoverFromLandmarks CoverStrategy = "landmarks"
+	// CoverFromName: a manifest item whose id or href contains "cover".
+	CoverFromName CoverStrategy = "name"
+	// CoverFromFirstPage: the first spine document showing a single image.
+	CoverFromFirstPage CoverStrategy = "first-page"
+	// CoverFromLargestImage: the largest portrait image in the manifest.
+	CoverFromLargestImage CoverStrategy = "largest-portrait-image"
+)
+
+// Heuristic scores; the highest-scoring candidate wins.
+const (
+	scoreLandmarks     = 90
+	scoreNameImage     = 80
+	scoreNameDocument  = 70
+	scoreFirstPage     = 60
+	scoreLargestImage  = 40
+	scoreNameExactBump = 5
+
+	// firstPageMaxText is the most text a first page may hold and still be a cover.
+	firstPageMaxText = 200
+	// minCoverHeight rejects icons and decorations as largest-image candidates.
+	minCoverHeight = 300
+)
+
+// CoverResult is a cover found by FindCover.
+type CoverResult struct {
+	Item     *ManifestItem
+	Strategy CoverStrategy
+	// Score is 100 for declared covers and the heuristic score otherwise.
+	Score int
+}
+
+// FindCover returns the cover image like GetCover, but when the book declares
+// no cover, or its declaration names a missing item or one that is not an
+// image, it falls back to scored heuristics: the EPUB 3.0 landmarks cover
+// entry, manifest ids/hrefs containing "cover", a first spine page holding a
+// single image, and finally the largest portrait image. The largest-image scan
+// reads image headers and only runs when no other candidate is found. A
+// declared document without an image is returned if no heuristic matches.
+func (r *Reader) FindCover() (CoverResult, error) {
+	return r.FindCoverContext(context.Background())
+}
+
+// FindCoverContext is like FindCover but checks ctx between strategies and
+// between the images read by the largest-image scan, returning ctx.Err()
+// once it is done.
+func (r *Reader) FindCoverContext(ctx context.Context) (CoverResult, error) {
+	var declared CoverResult
+	item, strategy, err := r.declaredCover()
+	switch {
+	case err == nil && strings.HasPrefix(item.MediaType, "image/"):
+		return CoverResult{Item: item, Strategy: strategy, Score: 100}, nil
+	case err == nil:
+		declared = CoverResult{Item: item, Strategy: strategy, Score: 100}
+	case !errors.Is(err, ErrMissingCoverId) && !errors.Is(err, ErrBadManifest):
+		return CoverResult{}, err
+	}
+
+	var best CoverResult
+	consider := func(c CoverResult) {
+		if c.Item != nil && c.Score > best.Score {
+			best = c
+		}
+	}
+
+	for _, rf := range r.Container.Rootfiles {
+		if err := ctx.Err(); err != nil {
+			return CoverResult{}, err
+		}
+		consider(r.landmarksCover(rf))
+		consider(r.namedCover(rf))
+		if best.Score < scoreFirstPage {
+			consider(r.firstPageCover(rf))
+		}
+	}
+	if best.Item == nil {
+		for _, rf := range r.Container.Rootfiles {
+			c, err := r.largestPortraitImage(ctx, rf)
+			if err != nil {
+				return CoverResult{}, err
+			}
+			consider(c)
+		}
+	}
+
+	if best.Item == nil {
+		best = declared
+	}
+	if best.Item == nil {
+		return CoverResult{}, ErrMissingCoverId
+	}
+	return best, nil
+}
+
+// landmarksCover follows the landmarks nav entry with epub:type="cover".
+func (r *Reader) landmarksCover(rf *Rootfile) CoverResult {
+	nav := rf.LandmarksNav()
+	if nav == nil {
+		return CoverResult{}
+	}
+	for _, entry := range nav.Items {
+		if !hasProperty(entry.Link.Type, "cover") {
+			continue
+		}
+		item := rf.itemByHREF(resolveHREF(rf.NavDoc.HREF, entry.Link.Href))
+		if item == nil {
+			continue
+		}
+		if resolved, err := unwrapCoverItem(r, item, rf); err == nil {
+			return CoverResult{Item: resolved, Strategy: CoverFromLandmarks, Score: scoreLandmarks}
+		}
+	}
+	return CoverResult{}
+}
+
+// namedCover picks the manifest item whose id or file name mentions "cover",
+// preferring images over wrapper documents and exact "cover" names.
+func (r *Reader) namedCover(rf *Rootfile) CoverResult {
+	var best CoverResult
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		id := strings.ToLower(item.ID)
+		base := strings.ToLower(path.Base(item.HREF))
+		base = strings.TrimSuffix(base, path.Ext(base))
+		if !strings.Contains(id, "cover") && !strings.Contains(base, "cover") {
+			continue
+		}
+		if strings.Contains(id, "back") || strings.Contains(base, "back") {
+			continue
+		}
+
+		score := 0
+		switch {
+		case strings.HasPrefix(item.MediaType, "image/") && item.MediaType != MediaTypeSVG:
+			score = scoreNameImage
+		case item.MediaType == MediaTypeXHTML || item.MediaType == MediaTypeHTML || item.MediaType == MediaTypeSVG:
+			score = scoreNameDocument
+		default:
+			continue
+		}
+		if id == "cover" || id == "cover-image" || base == "cover" {
+			score += scoreNameExactBump
+		}
+		if score <= best.Score {
+			continue
+		}
+
+		resolved := item
+		if score < scoreNameImage {
+			var err error
+			if resolved, err = unwrapCoverItem(r, item, rf); err != nil {
+				continue
+			}
+		}
+		best = CoverResult{Item: resolved, Strategy: CoverFromName, Score: score}
+	}
+	return best
+}
+
+// firstPageCover accepts the first spine document if it shows exactly one
+// image and little text.
+func (r *Reader) firstPageCover(rf *Rootfile) CoverResult {
+	if len(rf.Spine.Itemrefs) == 0 {
+		return CoverResult{}
+	}
+	item := rf.Spine.Itemrefs[0].ManifestItem
+	if item == nil || (item.MediaType != MediaTypeXHTML && item.MediaType != MediaTypeHTML) {
+		return CoverResult{}
+	}
+	data, err := r.readItem(item)
+	if err != nil {
+		return CoverResult{}
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	images, textLen, inBody := 0, 0, false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "body":
+				inBody = true
+			case "img", "image":
+				images++
+			}
+		case xml.CharData:
+			if inBody {
+				textLen += len(bytes.TrimSpace(t))
+			}
+		}
+	}
+	if images != 1 || textLen > firstPageMaxText {
+		return CoverResult{}
+	}
+
+	resolved, err := resolveXHTMLCover(r, item, rf)
+	if err != nil || resolved == nil {
+		return CoverResult{}
+	}
+	return CoverResult{Item: resolved, Strategy: CoverFromFirstPage, Score: scoreFirstPage}
+}
+
+// largestPortraitImage returns the portrait raster image with the largest area.
+func (r *Reader) largestPortraitImage(ctx context.Context, rf *Rootfile) (CoverResult, error) {
+	var best *ManifestItem
+	bestArea := 0
+	for _, item := range rf.Manifest.Images() {
+		if err := ctx.Err(); err != nil {
+			return CoverResult{}, err
+		}
+		if item.MediaType == MediaTypeSVG {
+			continue
+		}
+		w, h, err := r.ImageSize(item)
+		if err != nil || h <= w || h < minCoverHeight {
+			continue
+		}
+		if area := w * h; area > bestArea {
+			best, bestArea = item, area
+		}
+	}
+	if best == nil {
+		return CoverResult{}, nil
+	}
+	return CoverResult{Item: best, Strategy: CoverFromLargestImage, Score: scoreLargestImage}, nil
+}
+
+// itemByHREF returns the manifest item with the given OPF-relative href.
+func (rf *Rootfile) itemByHREF(href string) *ManifestItem {
+	if href == "" {
+		return nil
+	}
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		if path.Clean(item.HREF) == href {
+			return item
+		}
+	}
+	return nil
+}
+
+// resolveHREF resolves href, found in the document at base (both relative to
+// the OPF directory), dropping any fragment. Remote hrefs resolve to "".
+func resolveHREF(base, href string) string {
+	if i := strings.IndexByte(href, '#'); i >= 0 {
+		href = href[:i]
+	}
+	if href == "" {
+		return ""
+	}
+	if u, err := url.Parse(href); err == nil && (u.Scheme != "" || u.Host != "") {
+		return ""
+	}
+	href, _ = url.PathUnescape(href)
+	return path.Join(path.Dir(base), href)
+}
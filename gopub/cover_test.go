@@ -0,0 +1,165 @@
+package gopub
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func testPNG(t *testing.T, w, h int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func coverTestOPF(manifest, spine string) string {
+	return `<package xmlns="http://www.idpf.org/2007/opf" version="3.0"><metadata/>
+  <manifest>` + manifest + `</manifest>
+  <spine>` + spine + `</spine>
+</package>`
+}
+
+func TestFindCover(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantID   string
+		strategy CoverStrategy
+	}{
+		{
+			name: "declared",
+			files: map[string]string{
+				"OEBPS/content.opf": coverTestOPF(
+					`<item id="img" href="a.png" media-type="image/png" properties="cover-image"/>
+					 <item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>`,
+					`<itemref idref="ch"/>`),
+				"OEBPS/a.png":    testPNG(t, 10, 20),
+				"OEBPS/ch.xhtml": `<html><body><p>text</p></body></html>`,
+			},
+			wantID:   "img",
+			strategy: CoverFromMetadata,
+		},
+		{
+			name: "dangling cover meta",
+			files: map[string]string{
+				"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata><meta name="cover" content="gone"/></metadata>
+  <manifest><item id="i1" href="cover.png" media-type="image/png"/>
+    <item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="ch"/></spine>
+</package>`,
+				"OEBPS/cover.png": testPNG(t, 10, 20),
+				"OEBPS/ch.xhtml":  `<html><body><p>text</p></body></html>`,
+			},
+			wantID:   "i1",
+			strategy: CoverFromName,
+		},
+		{
+			name: "non-image cover meta",
+			files: map[string]string{
+				"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata><meta name="cover" content="css"/></metadata>
+  <manifest><item id="css" href="style.css" media-type="text/css"/>
+    <item id="p1" href="p1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="art" href="art.png" media-type="image/png"/></manifest>
+  <spine><itemref idref="p1"/></spine>
+</package>`,
+				"OEBPS/style.css": "p {}",
+				"OEBPS/p1.xhtml":  `<html><body><img src="art.png" alt="x"/></body></html>`,
+				"OEBPS/art.png":   testPNG(t, 10, 20),
+			},
+			wantID:   "art",
+			strategy: CoverFromFirstPage,
+		},
+		{
+			name: "landmarks",
+			files: map[string]string{
+				"OEBPS/content.opf": coverTestOPF(
+					`<item id="nav" href="text/nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+					 <item id="front" href="text/front.xhtml" media-type="application/xhtml+xml"/>
+					 <item id="pic" href="images/p.png" media-type="image/png"/>
+					 <item id="ch" href="text/ch.xhtml" media-type="application/xhtml+xml"/>`,
+					`<itemref idref="ch"/>`),
+				"OEBPS/text/nav.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+  <nav epub:type="landmarks"><ol><li><a epub:type="cover" href="front.xhtml">Cover</a></li></ol></nav></body></html>`,
+				"OEBPS/text/front.xhtml": `<html><body><img src="../images/p.png"/></body></html>`,
+				"OEBPS/images/p.png":     testPNG(t, 10, 20),
+				"OEBPS/text/ch.xhtml":    `<html><body><p>text</p></body></html>`,
+			},
+			wantID:   "pic",
+			strategy: CoverFromLandmarks,
+		},
+		{
+			name: "name",
+			files: map[string]string{
+				"OEBPS/content.opf": coverTestOPF(
+					`<item id="back" href="backcover.png" media-type="image/png"/>
+					 <item id="i1" href="Cover.png" media-type="image/png"/>
+					 <item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>`,
+					`<itemref idref="ch"/>`),
+				"OEBPS/backcover.png": testPNG(t, 10, 20),
+				"OEBPS/Cover.png":     testPNG(t, 10, 20),
+				"OEBPS/ch.xhtml":      `<html><body><p>text</p></body></html>`,
+			},
+			wantID:   "i1",
+			strategy: CoverFromName,
+		},
+		{
+			name: "first page",
+			files: map[string]string{
+				"OEBPS/content.opf": coverTestOPF(
+					`<item id="p1" href="p1.xhtml" media-type="application/xhtml+xml"/>
+					 <item id="art" href="art.png" media-type="image/png"/>`,
+					`<itemref idref="p1"/>`),
+				"OEBPS/p1.xhtml": `<html><body><div><img src="art.png" alt="x"/></div></body></html>`,
+				"OEBPS/art.png":  testPNG(t, 10, 20),
+			},
+			wantID:   "art",
+			strategy: CoverFromFirstPage,
+		},
+		{
+			name: "largest portrait",
+			files: map[string]string{
+				"OEBPS/content.opf": coverTestOPF(
+					`<item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>
+					 <item id="wide" href="wide.png" media-type="image/png"/>
+					 <item id="small" href="small.png" media-type="image/png"/>
+					 <item id="tall" href="tall.png" media-type="image/png"/>`,
+					`<itemref idref="ch"/>`),
+				"OEBPS/ch.xhtml":  `<html><body><p>text</p><img src="wide.png"/><img src="tall.png"/></body></html>`,
+				"OEBPS/wide.png":  testPNG(t, 900, 400),
+				"OEBPS/small.png": testPNG(t, 40, 80),
+				"OEBPS/tall.png":  testPNG(t, 400, 600),
+			},
+			wantID:   "tall",
+			strategy: CoverFromLargestImage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := openTestEpub(t, tt.files)
+			got, err := r.FindCover()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Item.ID != tt.wantID || got.Strategy != tt.strategy {
+				t.Errorf(expFormat, tt.wantID+"/"+string(tt.strategy), got.Item.ID+"/"+string(got.Strategy))
+			}
+		})
+	}
+}
+
+func TestFindCoverNone(t *testing.T) {
+	r := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf": coverTestOPF(`<item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>`, `<itemref idref="ch"/>`),
+		"OEBPS/ch.xhtml":    `<html><body><p>text</p></body></html>`,
+	})
+	if _, err := r.FindCover(); err != ErrMissingCoverId {
+		t.Errorf(expFormat, ErrMissingCoverId, err)
+	}
+}
@@ -0,0 +1,221 @@
+package gopub
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// DowngradeIssue is content of an EPUB 3 package that EPUB 2 cannot
+// represent, reported by Downgrade. The content is kept as it is.
+type DowngradeIssue struct {
+	ItemID string
+	HREF   string
+	// Feature is "audio", "video", "mathml" or "scripted".
+	Feature string
+}
+
+// guideTypes maps EPUB 3 landmark types to EPUB 2 guide reference types.
+var guideTypes = map[string]string{
+	"cover":           "cover",
+	"titlepage":       "title-page",
+	"toc":             "toc",
+	"index":           "index",
+	"glossary":        "glossary",
+	"acknowledgments": "acknowledgements",
+	"bibliography":    "bibliography",
+	"colophon":        "colophon",
+	"copyright-page":  "copyright-page",
+	"dedication":      "dedication",
+	"epigraph":        "epigraph",
+	"foreword":        "foreword",
+	"loi":             "loi",
+	"lot":             "lot",
+	"endnotes":        "notes",
+	"preface":         "preface",
+	"bodymatter":      "text",
+}
+
+// Downgrade converts the EPUB 3 package rf to EPUB 2 in place:
+//   - without an NCX, one is added to the manifest and spine, built from
+//     the toc of the navigation document with play order numbered by the
+//     spine position of the targets, in nav order within a document and
+//     after the spine for targets outside it; the navigation document
+//     stays as an ordinary item
+//   - landmarks become guide references, unless the guide has one of
+//     that type already
+//   - the cover-image item is named by the cover meta, the modification
+//     date becomes a modification event and URN identifiers get their
+//     opf:scheme in place of the URN prefix; WritePackage then writes role
+//     and file-as as opf: attributes
+//   - manifest and spine properties are removed
+//   - Version becomes "2.0"
+//
+// Audio and video, MathML and scripting have no EPUB 2 equivalent and are
+// returned as issues. The NCX has no file yet; Rewrite generates it.
+// Downgrade does nothing to packages that are already EPUB 2.
+func (rf *Rootfile) Downgrade() ([]DowngradeIssue, error) {
+	if err := rf.Load(); err != nil {
+		return nil, err
+	}
+	if rf.IsEPUB2() {
+		return nil, nil
+	}
+	issues, err := rf.downgradeIssues()
+	if err != nil {
+		return nil, err
+	}
+	rf.downgradeMetadata()
+	rf.downgradeNCX()
+	rf.downgradeGuide()
+	for i := range rf.Manifest.Items {
+		rf.Manifest.Items[i].Properties = ""
+	}
+	for i := range rf.Spine.Itemrefs {
+		rf.Spine.Itemrefs[i].SpineProperties = ""
+	}
+	rf.Version = "2.0"
+	return issues, nil
+}
+
+// downgradeIssues lists the features of the manifest items, declared or
+// found in their content, that EPUB 2 lacks.
+func (rf *Rootfile) downgradeIssues() ([]DowngradeIssue, error) {
+	var issues []DowngradeIssue
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		features, err := contentFeatures(item)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range strings.Fields(item.Properties) {
+			features[p] = true
+		}
+		if typ, _, _ := strings.Cut(item.MediaType, "/"); typ == "audio" || typ == "video" {
+			features[typ] = true
+		}
+		for _, f := range []string{"audio", "video", "mathml", "scripted"} {
+			if features[f] {
+				issues = append(issues, DowngradeIssue{ItemID: item.ID, HREF: item.HREF, Feature: f})
+			}
+		}
+	}
+	return issues, nil
+}
+
+func (rf *Rootfile) downgradeMetadata() {
+	md := &rf.Metadata
+	if md.CoverManifestId == "" {
+		for _, item := range rf.Manifest.Items {
+			if hasProperty(item.Properties, "cover-image") {
+				md.CoverManifestId = item.ID
+				break
+			}
+		}
+	}
+	if md.Modified != "" && !slices.ContainsFunc(md.Event, func(d Date) bool { return d.Name == "modification" }) {
+		md.Event = append(md.Event, Date{Name: "modification", Date: md.Modified})
+	}
+	for i := range md.Identifier {
+		id := &md.Identifier[i]
+		for scheme, urn := range identifierURNs {
+			if id.Scheme == "" && strings.HasPrefix(strings.ToLower(id.Value), urn) {
+				id.Scheme = strings.ToUpper(scheme)
+				id.Value = id.Value[len(urn):]
+			}
+		}
+	}
+}
+
+// downgradeNCX adds an NCX generated from the navigation document's toc.
+func (rf *Rootfile) downgradeNCX() {
+	for _, item := range rf.Manifest.Items {
+		if item.MediaType == MediaTypeNCX {
+			if rf.Spine.Toc == "" {
+				rf.Spine.Toc = item.ID
+			}
+			return
+		}
+	}
+	// Nav links are relative to the navigation document, NCX links to the
+	// NCX, which is stored next to the package document.
+	navDir := path.Dir(rf.NavDoc.HREF)
+	var srcs []string // distinct targets in nav order
+	var points func([]NavItem) []NavPoint
+	points = func(items []NavItem) []NavPoint {
+		var out []NavPoint
+		for _, item := range items {
+			if item.Link.Href == "" {
+				// NCX entries need a target; lift the children of headings.
+				out = append(out, points(item.SubItems)...)
+				continue
+			}
+			var np NavPoint
+			np.NavLabel.Text = item.Link.Text
+			np.Content.Src = rebaseHref(navDir, item.Link.Href)
+			if !slices.Contains(srcs, np.Content.Src) {
+				srcs = append(srcs, np.Content.Src)
+			}
+			np.NavPoints = points(item.SubItems)
+			out = append(out, np)
+		}
+		return out
+	}
+	if toc := rf.TOCNav(); toc != nil {
+		rf.NCX.NavPoints = points(toc.Items)
+	}
+
+	// Number the targets in reading order: by spine position, then nav order.
+	spine := make(map[string]int)
+	for i, ref := range rf.Spine.Itemrefs {
+		j := slices.IndexFunc(rf.Manifest.Items, func(item ManifestItem) bool { return item.ID == ref.IDREF })
+		if j < 0 {
+			continue
+		}
+		href := rf.Manifest.Items[j].HREF
+		if _, ok := spine[href]; !ok {
+			spine[href] = i
+		}
+	}
+	position := func(src string) int {
+		doc, _, _ := strings.Cut(src, "#")
+		if i, ok := spine[doc]; ok {
+			return i
+		}
+		return len(rf.Spine.Itemrefs)
+	}
+	slices.SortStableFunc(srcs, func(a, b string) int { return position(a) - position(b) })
+	order := make(map[string]int)
+	for i, src := range srcs {
+		order[src] = i + 1
+	}
+	for _, np := range rf.NCX.Walk() {
+		np.PlayOrder = order[np.Content.Src]
+	}
+	rf.NCX.DocTitle = rf.Metadata.MainTitle().Name
+
+	id := rf.newID("ncx")
+	rf.addItem(ManifestItem{ID: id, HREF: rf.newHREF("toc", ".ncx"), MediaType: MediaTypeNCX})
+	rf.Spine.Toc = id
+}
+
+// downgradeGuide adds guide references for the landmarks.
+func (rf *Rootfile) downgradeGuide() {
+	landmarks := rf.LandmarksNav()
+	if landmarks == nil {
+		return
+	}
+	navDir := path.Dir(rf.NavDoc.HREF)
+	for _, item := range landmarks.Items {
+		typ := guideTypes[item.Link.Type]
+		if typ == "" || item.Link.Href == "" ||
+			slices.ContainsFunc(rf.Guide.References, func(ref GuideReference) bool { return ref.Type == typ }) {
+			continue
+		}
+		rf.Guide.References = append(rf.Guide.References, GuideReference{
+			Type:  typ,
+			Title: item.Link.Text,
+			Href:  rebaseHref(navDir, item.Link.Href),
+		})
+	}
+}
@@ -3,100 +3,164 @@ package gopub
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"golang.org/x/net/html/charset"
 )
 
-// ReaderOptions configures optional behaviour for Reader and ReadCloser.
-// The zero value is valid and applies no restrictions.
-type ReaderOptions struct {
-	// MaxFileSize limits how many bytes are read from any single file inside
-	// the EPUB ZIP. 0 means unlimited. Set this when processing untrusted
-	// EPUBs to guard against ZIP-bomb / OOM attacks.
-	MaxFileSize int64
-}
-
 // Reader represents a readable epub file.
+//
+// A Reader is safe for concurrent use once NewReader returns: all methods,
+// including ManifestItem.Open and ReadAll, may be called from multiple
+// goroutines. With ModeLazy, Rootfile.Load fills in the rootfile's fields
+// (including Metadata links and the cover id), so read them directly only
+// after it has returned. The exported fields must not be modified while
+// other goroutines use the Reader.
 type Reader struct {
 	Container
-	files map[string]*zip.File
-	Size  int64
-	opts  ReaderOptions
+	files      map[string]*zip.File
+	fuzzyFiles map[string]*zip.File
+	entries    []*zip.File
+	Size       int64
+	opts       ReaderOptions
+	recovery   *RecoveryReport
+	cache      *itemCache
+	mu         sync.Mutex // guards warnings
+	warnings   []string
 }
 
 // ReadCloser represents a readable epub file that can be closed.
 type ReadCloser struct {
 	Reader
-	f *os.File
+	// Sidecar holds the metadata from a Calibre metadata.opf found next to
+	// the book by OpenReader with WithCalibreSidecar, or nil if the option is
+	// unset or there is no readable sidecar.
+	Sidecar *Metadata
+	f       *closingFile
+}
+
+// closingFile is an *os.File whose Close waits for reads in progress;
+// reads after Close fail with os.ErrClosed.
+type closingFile struct {
+	mu sync.RWMutex
+	f  *os.File // nil once closed
+}
+
+func (c *closingFile) ReadAt(p []byte, off int64) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.f == nil {
+		return 0, os.ErrClosed
+	}
+	return c.f.ReadAt(p, off)
+}
+
+func (c *closingFile) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
 }
 
 // OpenReader opens the epub file at name and returns a ReadCloser.
-func OpenReader(name string, opts ...ReaderOptions) (*ReadCloser, error) {
+func OpenReader(name string, opts ...Option) (*ReadCloser, error) {
+	return OpenReaderContext(context.Background(), name, opts...)
+}
+
+// OpenReaderContext is like OpenReader but stops opening the file once ctx
+// is cancelled or its deadline passes, returning ctx.Err().
+func OpenReaderContext(ctx context.Context, name string, opts ...Option) (*ReadCloser, error) {
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewReaderOwning(f)
-}
-
-// NewReader reads an epub from f. The gopub.ReadCloser gains ownership of f.
-func NewReaderOwning(f *os.File, opts ...ReaderOptions) (*ReadCloser, error) {
-	fi, err := f.Stat()
+	rc, err := newReaderOwning(ctx, f, opts)
 	if err != nil {
-		f.Close()
 		return nil, err
 	}
-
-	rc := &ReadCloser{f: f, Reader: Reader{Size: fi.Size()}}
-	if len(opts) > 0 {
-		rc.opts = opts[0]
+	if !rc.opts.CalibreSidecar {
+		return rc, nil
+	}
+	rc.Sidecar, err = ReadCalibreSidecar(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		rc.warn("epub: ignoring calibre sidecar: %v", err)
 	}
-	z, err := zip.NewReader(f, fi.Size())
+	return rc, nil
+}
+
+// NewReaderOwning reads an epub from f. The gopub.ReadCloser gains ownership of f.
+func NewReaderOwning(f *os.File, opts ...Option) (*ReadCloser, error) {
+	return newReaderOwning(context.Background(), f, opts)
+}
+
+func newReaderOwning(ctx context.Context, f *os.File, opts []Option) (*ReadCloser, error) {
+	fi, err := f.Stat()
 	if err != nil {
 		f.Close()
 		return nil, err
 	}
 
-	if err = rc.init(z); err != nil {
+	rc := &ReadCloser{f: &closingFile{f: f}, Reader: Reader{Size: fi.Size(), opts: newReaderOptions(opts)}}
+	if err := rc.open(ctx, rc.f); err != nil {
 		f.Close()
 		return nil, err
 	}
-
 	return rc, nil
 }
 
 // NewReader reads an epub from ra. The caller retains ownership of ra.
-func NewReader(ra io.ReaderAt, size int64, opts ...ReaderOptions) (*Reader, error) {
-	z, err := zip.NewReader(ra, size)
-	if err != nil {
+func NewReader(ra io.ReaderAt, size int64, opts ...Option) (*Reader, error) {
+	return NewReaderContext(context.Background(), ra, size, opts...)
+}
+
+// NewReaderContext is like NewReader but stops reading ra once ctx is
+// cancelled or its deadline passes, returning ctx.Err(). ctx only governs
+// opening; use ManifestItem.OpenContext for later reads.
+func NewReaderContext(ctx context.Context, ra io.ReaderAt, size int64, opts ...Option) (*Reader, error) {
+	r := &Reader{Size: size, opts: newReaderOptions(opts)}
+	if err := r.open(ctx, ra); err != nil {
 		return nil, err
 	}
+	return r, nil
+}
+
+// open reads the ZIP directory and parses the EPUB structure, checking ctx
+// before every read from ra.
+func (r *Reader) open(ctx context.Context, ra io.ReaderAt) error {
+	cra := &ctxReaderAt{ra: ra}
+	cra.ctx.Store(&ctx)
+	defer cra.ctx.Store(nil)
 
-	r := new(Reader)
-	r.Size = size
-	if len(opts) > 0 {
-		r.opts = opts[0]
+	z, err := r.openZip(cra, r.Size)
+	if err == nil {
+		err = r.init(ctx, z)
 	}
-	if err = r.init(z); err != nil {
-		return nil, err
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
 	}
-	return r, nil
+	return err
 }
 
-// Close closes the epub file.
+// Close closes the epub file once the reads from it in progress have
+// finished; later reads fail with os.ErrClosed. It is safe to call more
+// than once and concurrently with reads.
 func (rc *ReadCloser) Close() error {
-	if rc.f != nil {
-		return rc.f.Close()
-	}
-	return nil
+	return rc.f.Close()
 }
 
 // readAll reads from r, honouring MaxFileSize when set.
@@ -116,9 +180,15 @@ func (reader *Reader) readAll(r io.Reader) ([]byte, error) {
 	return io.ReadAll(r)
 }
 
+// openZipFile opens a ZIP entry with the MaxFileSize and compression ratio
+// limits applied to the returned stream.
+func (reader *Reader) openZipFile(zf *zip.File) (io.ReadCloser, error) {
+	return reader.opts.zipLimits().Open(zf)
+}
+
 // readZipFile opens a ZIP entry, reads it fully, and closes it.
 func (reader *Reader) readZipFile(zf *zip.File) ([]byte, error) {
-	f, err := zf.Open()
+	f, err := reader.openZipFile(zf)
 	if err != nil {
 		return nil, err
 	}
@@ -128,38 +198,75 @@ func (reader *Reader) readZipFile(zf *zip.File) ([]byte, error) {
 
 // readItem opens a ManifestItem, reads it fully, and closes it.
 func (reader *Reader) readItem(item *ManifestItem) ([]byte, error) {
-	f, err := item.Open()
+	return reader.readItemContext(context.Background(), item)
+}
+
+// readItemContext is like readItem but stops reading once ctx is done.
+// Cached contents are returned even then.
+func (reader *Reader) readItemContext(ctx context.Context, item *ManifestItem) ([]byte, error) {
+	if item.F == nil {
+		return nil, ErrBadManifest
+	}
+	key := itemKey{id: item.ID, f: item.F}
+	if reader.cache != nil {
+		if data, ok := reader.cache.get(key); ok {
+			return data, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := reader.openZipFile(item.F)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return reader.readAll(f)
+	data, err := reader.readAll(&ctxReadCloser{ReadCloser: f, ctx: ctx})
+	if err != nil {
+		return nil, err
+	}
+	if reader.cache != nil {
+		reader.cache.put(key, data)
+	}
+	return data, nil
 }
 
-func (r *Reader) init(z *zip.Reader) error {
+func (r *Reader) init(ctx context.Context, z *zip.Reader) error {
+	if err := r.opts.zipLimits().Check(z.File); err != nil {
+		return err
+	}
+
+	r.entries = z.File
+	if r.opts.ItemCacheSize > 0 {
+		r.cache = newItemCache(r.opts.ItemCacheSize)
+	}
 	r.files = make(map[string]*zip.File)
 	for _, f := range z.File {
 		r.files[f.Name] = f
 	}
 
-	if err := r.setContainer(); err != nil {
-		return err
-	}
-	if err := r.setPackages(); err != nil {
-		return err
+	if r.opts.Mode&ModeFuzzyPaths != 0 {
+		r.fuzzyFiles = fuzzyIndex(z.File)
 	}
-	if err := r.setItems(); err != nil {
-		return err
+
+	steps := []func() error{r.setContainer, r.setPackages, r.setItems, r.setNCX, r.setTOC, r.checkNavDepths}
+	if r.opts.lazy() {
+		steps = []func() error{r.setContainer, r.setMetadata}
 	}
-	if err := r.setNCX(); err != nil {
-		return err
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := step(); err != nil {
+			return err
+		}
 	}
-	return r.setTOC()
+	return nil
 }
 
 func (r *Reader) setContainer() error {
-	containerZipFile, ok := r.files[containerPath]
-	if !ok {
+	containerZipFile := r.lookup(containerPath)
+	if containerZipFile == nil {
 		return ErrNoContainerfile
 	}
 
@@ -168,7 +275,7 @@ func (r *Reader) setContainer() error {
 		return ErrBadContainerfile
 	}
 
-	if err := xmlDecodeBytes(data, &r.Container); err != nil {
+	if err := r.decodeXML(data, &r.Container); err != nil {
 		return err
 	}
 
@@ -180,58 +287,59 @@ func (r *Reader) setContainer() error {
 
 func (r *Reader) setPackages() error {
 	for _, rf := range r.Container.Rootfiles {
-		zf := r.files[rf.FullPath]
-		if zf == nil {
-			return ErrBadRootfile
-		}
-
-		data, err := r.readZipFile(zf)
+		data, err := r.readRootfile(rf)
 		if err != nil {
 			return err
 		}
 
-		if err := xmlDecodeBytes(data, &rf.Package); err != nil {
+		if err := r.decodeXML(data, &rf.Package); err != nil {
 			return err
 		}
-
-		if ver := rf.Package.Version; ver != "" {
-			major := strings.SplitN(ver, ".", 2)[0]
-			if major != "2" && major != "3" {
-				return fmt.Errorf("epub: unsupported version %q", ver)
-			}
+		if err := checkVersion(rf.Package.Version); err != nil {
+			return err
 		}
+		setCoverProperty(rf)
+		processRefinements(&rf.Metadata)
+	}
+	return nil
+}
 
-		// Cover from manifest properties (EPUB 3.0).
-		for _, manifestItem := range rf.Manifest.Items {
-			if hasProperty(manifestItem.Properties, "cover-image") {
-				rf.Metadata.CoverManifestId = manifestItem.ID
-				break
-			}
-		}
+// readRootfile reads the package document of rf.
+func (r *Reader) readRootfile(rf *Rootfile) ([]byte, error) {
+	zf := r.lookup(rf.FullPath)
+	if zf == nil {
+		return nil, ErrBadRootfile
+	}
+	return r.readZipFile(zf)
+}
 
-		processRefinements(&rf.Metadata)
+// checkVersion rejects package versions other than 2.x and 3.x.
+func checkVersion(ver string) error {
+	if ver == "" {
+		return nil
+	}
+	if major := strings.SplitN(ver, ".", 2)[0]; major != "2" && major != "3" {
+		return fmt.Errorf("epub: unsupported version %q", ver)
 	}
 	return nil
 }
 
+// setCoverProperty records the EPUB 3.0 cover-image manifest item as the
+// cover id.
+func setCoverProperty(rf *Rootfile) {
+	for _, manifestItem := range rf.Manifest.Items {
+		if hasProperty(manifestItem.Properties, "cover-image") {
+			rf.Metadata.CoverManifestId = manifestItem.ID
+			break
+		}
+	}
+}
+
 func (r *Reader) setItems() error {
 	itemrefCount := 0
 	for _, rf := range r.Container.Rootfiles {
-		itemMap := make(map[string]*ManifestItem)
-		for i := range rf.Manifest.Items {
-			item := &rf.Manifest.Items[i]
-			itemMap[item.ID] = item
-			href, _ := url.PathUnescape(item.HREF)
-			abs := path.Join(path.Dir(rf.FullPath), href)
-			item.F = r.files[abs]
-		}
-
-		for i := range rf.Spine.Itemrefs {
-			itemref := &rf.Spine.Itemrefs[i]
-			itemref.ManifestItem = itemMap[itemref.IDREF]
-			if itemref.ManifestItem == nil {
-				return ErrBadItemref
-			}
+		if err := r.setRootfileItems(rf); err != nil {
+			return err
 		}
 		itemrefCount += len(rf.Spine.Itemrefs)
 	}
@@ -242,16 +350,58 @@ func (r *Reader) setItems() error {
 	return nil
 }
 
+// setRootfileItems resolves the manifest, links and spine of rf.
+func (r *Reader) setRootfileItems(rf *Rootfile) error {
+	itemMap := make(map[string]*ManifestItem)
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		item.r = r
+		if _, dup := itemMap[item.ID]; dup {
+			if r.opts.strict() {
+				return ErrDuplicateID
+			}
+			r.warn("%v %q", ErrDuplicateID, item.ID)
+		}
+		// Spine references resolve to the last item with a duplicated id.
+		itemMap[item.ID] = item
+		href, _ := url.PathUnescape(item.HREF)
+		abs := path.Join(path.Dir(rf.FullPath), href)
+		item.F = r.lookup(abs)
+		if item.F == nil {
+			if r.opts.strict() {
+				return ErrBadManifest
+			}
+			r.warn("epub: manifest item %q references missing file %q", item.ID, abs)
+		}
+	}
+
+	r.setLinks(rf)
+
+	for i := range rf.Spine.Itemrefs {
+		itemref := &rf.Spine.Itemrefs[i]
+		itemref.ManifestItem = itemMap[itemref.IDREF]
+		if itemref.ManifestItem == nil {
+			return ErrBadItemref
+		}
+	}
+	return nil
+}
+
 // xmlDecodeBytes strips a UTF-8 BOM and decodes XML with charset support.
 func xmlDecodeBytes(data []byte, v any) error {
-	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
-	data = escapeInvalidAmpersands(data)
-	data = escapeNonAsciiTags(data)
-	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec := xml.NewDecoder(bytes.NewReader(sanitizeXML(data)))
 	dec.CharsetReader = charset.NewReaderLabel
 	return dec.Decode(v)
 }
 
+// sanitizeXML strips a UTF-8 BOM and repairs the malformations handled by
+// escapeInvalidAmpersands and escapeNonAsciiTags.
+func sanitizeXML(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	data = escapeInvalidAmpersands(data)
+	return escapeNonAsciiTags(data)
+}
+
 // escapeNonAsciiTags replaces '<' that start a tag whose name begins with a
 // non-ASCII byte (e.g. CJK characters) with '&lt;'. Such sequences are never
 // valid epub XML element names but appear as unescaped text in some malformed
@@ -1,8 +1,11 @@
 package gopub
 
 import (
+	"archive/zip"
+	"bytes"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -62,6 +65,58 @@ func listTestEpubs(t *testing.T) []string {
 	return paths
 }
 
+// testContainer is a container.xml pointing at OEBPS/content.opf.
+const testContainer = `<?xml version="1.0"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" version="1.0">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+// buildTestEpub zips files (name → content) into an in-memory EPUB,
+// adding the mimetype and container.xml unless files provides them.
+func buildTestEpub(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := files["mimetype"]; !ok {
+		write("mimetype", "application/epub+zip")
+	}
+	if _, ok := files[containerPath]; !ok {
+		write(containerPath, testContainer)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(name, files[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// openTestEpub builds an EPUB from files and opens it with NewReader.
+func openTestEpub(t *testing.T, files map[string]string) *Reader {
+	t.Helper()
+	data := buildTestEpub(t, files)
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
 func TestOpenReader(t *testing.T) {
 	for _, epubPath := range listTestEpubs(t) {
 		name := filepath.Base(epubPath)
@@ -1,16 +1,36 @@
 package gopub
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/LapisApple/go-epub/gopub/internal/ziplimit"
+)
 
 var (
-	ErrNoContainerfile  = errors.New("epub: no containerfile found")
-	ErrBadContainerfile = errors.New("epub: bad containerfile")
-	ErrNoRootfile       = errors.New("epub: no rootfile found in container")
-	ErrBadRootfile      = errors.New("epub: container references non-existent rootfile")
-	ErrNoItemref        = errors.New("epub: no itemrefs found in spine")
-	ErrBadItemref       = errors.New("epub: itemref references non-existent item")
-	ErrBadManifest      = errors.New("epub: manifest references non-existent item")
-	ErrMissingCoverId   = errors.New("epub: missing cover id in metadata")
-	ErrFileTooLarge     = errors.New("epub: file exceeds MaxFileSize limit")
-	ErrDuplicateID      = errors.New("epub: duplicate manifest item id")
+	ErrNoContainerfile   = errors.New("epub: no containerfile found")
+	ErrBadContainerfile  = errors.New("epub: bad containerfile")
+	ErrNoRootfile        = errors.New("epub: no rootfile found in container")
+	ErrBadRootfile       = errors.New("epub: container references non-existent rootfile")
+	ErrNoItemref         = errors.New("epub: no itemrefs found in spine")
+	ErrBadItemref        = errors.New("epub: itemref references non-existent item")
+	ErrBadManifest       = errors.New("epub: manifest references non-existent item")
+	ErrMissingCoverId    = errors.New("epub: missing cover id in metadata")
+	ErrFileTooLarge      = ziplimit.ErrFileTooLarge
+	ErrDuplicateID       = errors.New("epub: duplicate manifest item id")
+	ErrBadLink           = errors.New("epub: link references non-existent resource")
+	ErrUnsupportedRecord = errors.New("epub: unsupported metadata record format")
+	ErrUnsupportedImage  = errors.New("epub: unsupported image format")
+	ErrTooManyEntries    = ziplimit.ErrTooManyEntries
+	ErrTotalSizeTooLarge = ziplimit.ErrTotalSizeTooLarge
+	ErrCompressionRatio  = ziplimit.ErrCompressionRatio
+	ErrXMLTooDeep        = errors.New("epub: xml nesting exceeds MaxXMLDepth limit")
+	ErrXMLTooManyTokens  = errors.New("epub: xml token count exceeds MaxXMLTokens limit")
+	ErrXMLTooManyAttrs   = errors.New("epub: xml element attribute count exceeds MaxXMLAttrs limit")
+	ErrNavTooDeep        = errors.New("epub: navigation nesting exceeds MaxNavDepth limit")
+	ErrUnsafePath        = errors.New("epub: unsafe path in zip entry")
+	ErrSymlinkEntry      = errors.New("epub: zip entry is a symlink")
+	ErrCaseCollision     = errors.New("epub: zip entries collide when case is ignored")
+	ErrExtractTooLarge   = errors.New("epub: extraction exceeds MaxTotalSize limit")
+	ErrDuplicateEntry    = errors.New("epub: duplicate zip entry")
+	ErrImageTooLarge     = errors.New("epub: image exceeds MaxImagePixels limit")
 )
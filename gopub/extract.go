@@ -0,0 +1,221 @@
+package gopub
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ExtractOptions configures Reader.ExtractTo. The zero value extracts every
+// ZIP entry under its own name with no size limit.
+type ExtractOptions struct {
+	// ManifestOnly extracts only files referenced by a manifest.
+	ManifestOnly bool
+	// ByManifestID names each manifest file <id><ext> instead of by its ZIP
+	// path; with several renditions each gets a numbered subdirectory.
+	// Implies ManifestOnly.
+	ByManifestID bool
+	// MaxTotalSize limits the bytes written in total. 0 means unlimited.
+	MaxTotalSize int64
+}
+
+// extractEntry is a validated ZIP entry and its destination path.
+type extractEntry struct {
+	f    *zip.File
+	dest string
+	dir  bool
+}
+
+// ExtractTo writes the EPUB's files under dir, creating it if needed.
+// Every entry is validated before anything is written: absolute paths, ".."
+// segments and backslashes fail with ErrUnsafePath, symlinks with
+// ErrSymlinkEntry, repeated names with ErrDuplicateEntry, and names that
+// differ only in case or Unicode normalization form (which would overwrite
+// each other on case-insensitive file systems) with ErrCaseCollision.
+// Writes go through an os.Root so pre-existing symlinks in dir cannot
+// redirect them. File modification times are preserved.
+func (r *Reader) ExtractTo(dir string, opts ExtractOptions) error {
+	entries, err := r.extractPlan(opts)
+	if err != nil {
+		return err
+	}
+
+	var declared uint64
+	for _, e := range entries {
+		declared += e.f.UncompressedSize64
+	}
+	if opts.MaxTotalSize > 0 && declared > uint64(opts.MaxTotalSize) {
+		return ErrExtractTooLarge
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	var written int64
+	for _, e := range entries {
+		if e.dir {
+			if err := root.MkdirAll(e.dest, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if parent := path.Dir(e.dest); parent != "." {
+			if err := root.MkdirAll(parent, 0o755); err != nil {
+				return err
+			}
+		}
+		n, err := r.extractFile(root, e, opts.MaxTotalSize-written, opts.MaxTotalSize > 0)
+		written += n
+		if err != nil {
+			return err
+		}
+		mtime := e.f.Modified
+		if mtime.IsZero() {
+			mtime = e.f.ModTime()
+		}
+		if !mtime.IsZero() {
+			if err := root.Chtimes(e.dest, mtime, mtime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// extractFile copies one entry into root, failing with ErrExtractTooLarge
+// once more than budget bytes would be written (when limited is set).
+func (r *Reader) extractFile(root *os.Root, e extractEntry, budget int64, limited bool) (int64, error) {
+	src, err := r.openZipFile(e.f)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := root.OpenFile(e.dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+
+	var in io.Reader = src
+	if limited {
+		in = io.LimitReader(src, budget+1)
+	}
+	n, err := io.Copy(dst, in)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && limited && n > budget {
+		err = ErrExtractTooLarge
+	}
+	return n, err
+}
+
+// extractPlan validates the entries selected by opts and computes their
+// destination paths.
+func (r *Reader) extractPlan(opts ExtractOptions) ([]extractEntry, error) {
+	var entries []extractEntry
+	// seen maps destinations to entry names; folded does the same for
+	// destinations in lower case NFC, as macOS and other case-insensitive
+	// file systems compare them.
+	seen := make(map[string]string)
+	folded := make(map[string]string)
+	add := func(f *zip.File, dest string) error {
+		if f.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %q", ErrSymlinkEntry, f.Name)
+		}
+		if prev, ok := seen[dest]; ok {
+			return fmt.Errorf("%w: %q and %q", ErrDuplicateEntry, prev, f.Name)
+		}
+		key := strings.ToLower(norm.NFC.String(dest))
+		if prev, ok := folded[key]; ok {
+			return fmt.Errorf("%w: %q and %q", ErrCaseCollision, prev, f.Name)
+		}
+		seen[dest], folded[key] = f.Name, f.Name
+		entries = append(entries, extractEntry{f: f, dest: dest, dir: strings.HasSuffix(f.Name, "/")})
+		return nil
+	}
+
+	if !opts.ManifestOnly && !opts.ByManifestID {
+		for _, f := range r.entries {
+			dest, err := safeEntryPath(f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if dest == "" {
+				continue
+			}
+			if err := add(f, dest); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+	for n, rf := range r.Container.Rootfiles {
+		for i := range rf.Manifest.Items {
+			item := &rf.Manifest.Items[i]
+			if item.F == nil {
+				continue
+			}
+			dest, err := safeEntryPath(item.F.Name)
+			if err != nil {
+				return nil, err
+			}
+			if opts.ByManifestID {
+				dest, err = safeEntryPath(item.ID + path.Ext(dest))
+				if err != nil || strings.Contains(dest, "/") {
+					return nil, fmt.Errorf("%w: manifest id %q", ErrUnsafePath, item.ID)
+				}
+				if len(r.Container.Rootfiles) > 1 {
+					dest = strconv.Itoa(n) + "/" + dest
+				}
+			} else if seen[dest] == item.F.Name {
+				// Several renditions may share a file.
+				continue
+			}
+			if err := add(item.F, dest); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// safeEntryPath validates a ZIP entry name and returns it as a clean relative
+// slash path, or "" for entries that name the root directory itself.
+func safeEntryPath(name string) (string, error) {
+	switch {
+	case strings.ContainsAny(name, "\\\x00"):
+		return "", fmt.Errorf("%w: %q contains a backslash or NUL", ErrUnsafePath, name)
+	case strings.HasPrefix(name, "/"):
+		return "", fmt.Errorf("%w: %q is absolute", ErrUnsafePath, name)
+	case len(name) >= 2 && name[1] == ':':
+		return "", fmt.Errorf("%w: %q has a drive letter", ErrUnsafePath, name)
+	}
+	for seg := range strings.SplitSeq(name, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("%w: %q contains '..'", ErrUnsafePath, name)
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", nil
+	}
+	return clean, nil
+}
@@ -0,0 +1,160 @@
+package gopub
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// hostileEpub returns a minimal EPUB with one extra entry described by hdr.
+func hostileEpub(t *testing.T, hdr *zip.FileHeader) *Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct{ name, content string }{
+		{"mimetype", "application/epub+zip"},
+		{containerPath, testContainer},
+		{"OEBPS/content.opf", limitsTestOPF},
+		{"OEBPS/ch.xhtml", "<html/>"},
+		{"OEBPS/toc.ncx", nestedNavPoints(1)},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("payload"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestExtractToRejectsUnsafeEntries(t *testing.T) {
+	symlink := &zip.FileHeader{Name: "OEBPS/link"}
+	symlink.SetMode(fs.ModeSymlink | 0o777)
+
+	tests := []struct {
+		name string
+		hdr  *zip.FileHeader
+		want error
+	}{
+		{"dotdot", &zip.FileHeader{Name: "../evil.txt"}, ErrUnsafePath},
+		{"nested dotdot", &zip.FileHeader{Name: "OEBPS/../../evil.txt"}, ErrUnsafePath},
+		{"absolute", &zip.FileHeader{Name: "/tmp/evil.txt"}, ErrUnsafePath},
+		{"backslash", &zip.FileHeader{Name: `..\evil.txt`}, ErrUnsafePath},
+		{"drive letter", &zip.FileHeader{Name: "C:/evil.txt"}, ErrUnsafePath},
+		{"symlink", symlink, ErrSymlinkEntry},
+		{"case collision", &zip.FileHeader{Name: "OEBPS/CH.xhtml"}, ErrCaseCollision},
+		{"duplicate", &zip.FileHeader{Name: "OEBPS/ch.xhtml"}, ErrDuplicateEntry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := hostileEpub(t, tt.hdr)
+			dir := t.TempDir()
+			err := r.ExtractTo(dir, ExtractOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf(expFormat, tt.want, err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("expected nothing written, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestExtractToRejectsNormalizationCollision(t *testing.T) {
+	r := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf":    limitsTestOPF,
+		"OEBPS/ch.xhtml":       "<html/>",
+		"OEBPS/toc.ncx":        nestedNavPoints(1),
+		"OEBPS/caf\u00e9.css":  "",
+		"OEBPS/cafe\u0301.css": "",
+	})
+	dir := t.TempDir()
+	if err := r.ExtractTo(dir, ExtractOptions{}); !errors.Is(err, ErrCaseCollision) {
+		t.Fatalf(expFormat, ErrCaseCollision, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected nothing written, found %d entries", len(entries))
+	}
+}
+
+func TestExtractTo(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	dir := t.TempDir()
+	if err := r.ExtractTo(dir, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.entries {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != int64(f.UncompressedSize64) {
+			t.Errorf("%s: "+expFormat, f.Name, f.UncompressedSize64, fi.Size())
+		}
+		if want := f.Modified; !want.IsZero() && !fi.ModTime().Equal(want.Truncate(time.Second)) {
+			t.Errorf("%s mtime: "+expFormat, f.Name, want, fi.ModTime())
+		}
+	}
+}
+
+func TestExtractToByManifestID(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	dir := t.TempDir()
+	if err := r.ExtractTo(dir, ExtractOptions{ByManifestID: true}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(r.Rootfiles[0].Manifest.Items) {
+		t.Errorf(expFormat, len(r.Rootfiles[0].Manifest.Items), len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "item1.jpg")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractToMaxTotalSize(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	err = r.ExtractTo(t.TempDir(), ExtractOptions{MaxTotalSize: 1000})
+	if !errors.Is(err, ErrExtractTooLarge) {
+		t.Fatalf(expFormat, ErrExtractTooLarge, err)
+	}
+}
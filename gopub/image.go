@@ -0,0 +1,200 @@
+package gopub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	// Register the decoders used by ImageSize and DecodeImage.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// NotRasterError is returned when a cover resolves to an SVG or XHTML
+// document that does not embed a raster image.
+type NotRasterError struct {
+	Item *ManifestItem
+}
+
+func (e *NotRasterError) Error() string {
+	return fmt.Sprintf("epub: cover %q (%s) has no embedded raster image", e.Item.HREF, e.Item.MediaType)
+}
+
+// ImageSize returns the pixel dimensions of a JPEG, PNG, GIF or WebP item
+// by reading only its header.
+func (r *Reader) ImageSize(item *ManifestItem) (width, height int, err error) {
+	f, err := item.Open()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return ReadImageSize(f)
+}
+
+// ReadImageSize returns the pixel dimensions of the JPEG, PNG, GIF or WebP
+// image read from r, reading only its header.
+func ReadImageSize(r io.Reader) (width, height int, err error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(30); isWebP(head) {
+		return webpSize(head)
+	}
+	cfg, _, err := image.DecodeConfig(br)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// DecodeImage decodes a JPEG, PNG or GIF manifest item. WebP and AVIF items
+// return ErrUnsupportedImage since the standard library has no decoder.
+// Images declaring more than MaxImagePixels pixels return ErrImageTooLarge
+// without being decoded.
+func (r *Reader) DecodeImage(item *ManifestItem) (image.Image, error) {
+	data, err := r.readItem(item)
+	if err != nil {
+		return nil, err
+	}
+	if isWebP(data) {
+		return nil, ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if limit := r.opts.MaxImagePixels; limit > 0 && int64(cfg.Width)*int64(cfg.Height) > limit {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	return img, nil
+}
+
+// CoverImage resolves the cover with FindCover and decodes it. It returns a
+// *NotRasterError when the cover is an SVG or XHTML page without an image.
+func (r *Reader) CoverImage() (image.Image, *ManifestItem, error) {
+	cover, err := r.FindCover()
+	if err != nil {
+		return nil, nil, err
+	}
+	item := cover.Item
+	switch item.MediaType {
+	case MediaTypeSVG, MediaTypeXHTML, MediaTypeHTML:
+		return nil, item, &NotRasterError{Item: item}
+	}
+	img, err := r.DecodeImage(item)
+	if err != nil {
+		return nil, item, err
+	}
+	return img, item, nil
+}
+
+// CoverThumbnails decodes the cover once and returns one thumbnail per
+// requested bounding box, each fitted inside it with the aspect ratio kept.
+func (r *Reader) CoverThumbnails(sizes ...image.Point) ([]image.Image, error) {
+	img, _, err := r.CoverImage()
+	if err != nil {
+		return nil, err
+	}
+	thumbs := make([]image.Image, len(sizes))
+	for i, size := range sizes {
+		thumbs[i] = Thumbnail(img, size.X, size.Y)
+	}
+	return thumbs, nil
+}
+
+// Thumbnail scales img down to fit within maxWidth × maxHeight, preserving
+// the aspect ratio; images that already fit keep their size. A non-positive
+// bound leaves that dimension unconstrained. Downscaling averages the
+// source pixels covered by each output pixel.
+func Thumbnail(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	scale := 1.0
+	if maxWidth > 0 {
+		scale = float64(maxWidth) / float64(sw)
+	}
+	if maxHeight > 0 {
+		if s := float64(maxHeight) / float64(sh); maxWidth <= 0 || s < scale {
+			scale = s
+		}
+	}
+	scale = min(scale, 1)
+	dw := max(1, int(float64(sw)*scale+0.5))
+	dh := max(1, int(float64(sh)*scale+0.5))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := b.Min.Y + y*sh/dh
+		y1 := max(y0+1, b.Min.Y+(y+1)*sh/dh)
+		for x := 0; x < dw; x++ {
+			x0 := b.Min.X + x*sw/dw
+			x1 := max(x0+1, b.Min.X+(x+1)*sw/dw)
+			dst.SetRGBA(x, y, averageRGBA(img, x0, y0, x1, y1))
+		}
+	}
+	return dst
+}
+
+// averageRGBA returns the mean colour of img over [x0,x1) × [y0,y1).
+func averageRGBA(img image.Image, x0, y0, x1, y1 int) color.RGBA {
+	var sr, sg, sb, sa, n uint64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			sr += uint64(r)
+			sg += uint64(g)
+			sb += uint64(b)
+			sa += uint64(a)
+			n++
+		}
+	}
+	return color.RGBA{
+		R: uint8(sr / n >> 8),
+		G: uint8(sg / n >> 8),
+		B: uint8(sb / n >> 8),
+		A: uint8(sa / n >> 8),
+	}
+}
+
+// isWebP reports whether data starts with a RIFF/WEBP header.
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// webpSize parses the canvas size from the first chunk of a WebP file.
+func webpSize(head []byte) (int, int, error) {
+	if len(head) < 30 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	switch string(head[12:16]) {
+	case "VP8X":
+		w := int(head[24]) | int(head[25])<<8 | int(head[26])<<16
+		h := int(head[27]) | int(head[28])<<8 | int(head[29])<<16
+		return w + 1, h + 1, nil
+	case "VP8L":
+		if head[20] != 0x2f {
+			break
+		}
+		bits := binary.LittleEndian.Uint32(head[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8 ":
+		if head[23] != 0x9d || head[24] != 0x01 || head[25] != 0x2a {
+			break
+		}
+		w := binary.LittleEndian.Uint16(head[26:28]) & 0x3fff
+		h := binary.LittleEndian.Uint16(head[28:30]) & 0x3fff
+		return int(w), int(h), nil
+	}
+	return 0, 0, ErrUnsupportedImage
+}
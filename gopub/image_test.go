@@ -0,0 +1,94 @@
+package gopub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"testing"
+)
+
+func TestCoverImage(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	img, item, err := r.CoverImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h, err := r.ImageSize(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 350 || h != 500 {
+		t.Errorf(expFormat, "350x500", image.Pt(w, h))
+	}
+	if got := img.Bounds().Size(); got != image.Pt(w, h) {
+		t.Errorf(expFormat, image.Pt(w, h), got)
+	}
+
+	thumbs, err := r.CoverThumbnails(image.Pt(100, 100), image.Pt(0, 250), image.Pt(700, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []image.Point{{70, 100}, {175, 250}, {350, 500}} {
+		if got := thumbs[i].Bounds().Size(); got != want {
+			t.Errorf(expFormat, want, got)
+		}
+	}
+}
+
+func TestCoverImageNotRaster(t *testing.T) {
+	r := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata><meta name="cover" content="cover"/></metadata>
+  <manifest><item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="cover"/></spine>
+</package>`,
+		"OEBPS/cover.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><h1>Title</h1></body></html>`,
+	})
+
+	_, _, err := r.CoverImage()
+	var nre *NotRasterError
+	if !errors.As(err, &nre) || nre.Item.ID != "cover" {
+		t.Errorf(expFormat, "*NotRasterError", err)
+	}
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	// A PNG header declaring 60000×60000 RGBA pixels, and no image data.
+	ihdr := []byte("IHDR\x00\x00\xea\x60\x00\x00\xea\x60\x08\x06\x00\x00\x00")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	png = append(png, ihdr...)
+	png = binary.BigEndian.AppendUint32(png, crc32.ChecksumIEEE(ihdr))
+	data := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata><meta name="cover" content="cover"/></metadata>
+  <manifest><item id="cover" href="cover.png" media-type="image/png"/></manifest>
+  <spine><itemref idref="cover"/></spine>
+</package>`,
+		"OEBPS/cover.png": string(png),
+	})
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), WithLimits(RecommendedLimits()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.CoverImage(); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf(expFormat, ErrImageTooLarge, err)
+	}
+}
+
+func TestWebPSize(t *testing.T) {
+	vp8x := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\x3f\x01\x00\xc7\x00\x00")
+	if w, h, err := webpSize(vp8x); err != nil || w != 320 || h != 200 {
+		t.Errorf(expFormat, "320x200", image.Pt(w, h))
+	}
+	vp8l := []byte("RIFF\x00\x00\x00\x00WEBPVP8L\x00\x00\x00\x00\x2f\x3f\x40\x1f\x00\x00\x00\x00\x00\x00")
+	if w, h, err := webpSize(vp8l); err != nil || w != 64 || h != 126 {
+		t.Errorf(expFormat, "64x126", image.Pt(w, h))
+	}
+}
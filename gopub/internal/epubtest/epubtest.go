@@ -0,0 +1,59 @@
+// Package epubtest builds in-memory EPUB fixtures for the tests of the
+// gopub subpackages.
+package epubtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+// Container is a container.xml naming OEBPS/content.opf as the rootfile.
+const Container = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+// Build returns an EPUB archive holding the mimetype entry, Container
+// unless files has its own, and files in name order.
+func Build(t testing.TB, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, content string, method uint16) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("mimetype", "application/epub+zip", zip.Store)
+	if _, ok := files["META-INF/container.xml"]; !ok {
+		add("META-INF/container.xml", Container, zip.Deflate)
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		add(name, files[name], zip.Deflate)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Rendition opens the archive Build returns for files and returns its
+// default rendition.
+func Rendition(t testing.TB, files map[string]string) *gopub.Rootfile {
+	t.Helper()
+	data := Build(t, files)
+	r, err := gopub.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.DefaultRendition()
+}
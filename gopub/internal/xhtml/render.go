@@ -0,0 +1,98 @@
+package xhtml
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Namespace URIs declared on svg and math elements by Render.
+var namespaceURIs = map[string]string{
+	"svg":   "http://www.w3.org/2000/svg",
+	"math":  "http://www.w3.org/1998/Math/MathML",
+	"xlink": "http://www.w3.org/1999/xlink",
+}
+
+// voidElements are written self-closed; every other empty element gets an
+// end tag so that the output also parses as HTML.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "source": true,
+	"track": true, "wbr": true,
+}
+
+// Render writes n and its subtree in XML syntax. Elements parsed into the
+// svg and math namespaces get their xmlns declarations; attributes parsed
+// by the HTML5 parser with a namespace keep their prefix. Doctype nodes
+// are skipped.
+func Render(w io.Writer, n *html.Node) error {
+	bw := bufio.NewWriter(w)
+	render(bw, n)
+	return bw.Flush()
+}
+
+func render(w *bufio.Writer, n *html.Node) {
+	switch n.Type {
+	case html.DocumentNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			render(w, c)
+		}
+	case html.TextNode:
+		w.WriteString(escape(n.Data, false))
+	case html.CommentNode:
+		w.WriteString("<!--" + strings.ReplaceAll(n.Data, "--", "- -") + "-->")
+	case html.ElementNode:
+		w.WriteString("<" + n.Data)
+		if n.Namespace != "" && (n.Parent == nil || n.Parent.Namespace != n.Namespace) {
+			w.WriteString(` xmlns="` + namespaceURIs[n.Namespace] + `"`)
+			if n.Namespace == "svg" && usesXLink(n) {
+				w.WriteString(` xmlns:xlink="` + namespaceURIs["xlink"] + `"`)
+			}
+		}
+		for _, a := range n.Attr {
+			key := a.Key
+			if a.Namespace != "" {
+				key = a.Namespace + ":" + key
+			}
+			w.WriteString(" " + key + `="` + escape(a.Val, true) + `"`)
+		}
+		if n.FirstChild == nil && (voidElements[n.Data] || n.Namespace != "") {
+			w.WriteString("/>")
+			return
+		}
+		w.WriteString(">")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			render(w, c)
+		}
+		w.WriteString("</" + n.Data + ">")
+	}
+}
+
+// usesXLink reports whether an attribute in n's subtree has the xlink prefix.
+func usesXLink(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "xlink" || strings.HasPrefix(a.Key, "xlink:") {
+			return true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if usesXLink(c) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#10;")
+)
+
+func escape(s string, attr bool) string {
+	if attr {
+		return attrEscaper.Replace(s)
+	}
+	return textEscaper.Replace(s)
+}
@@ -0,0 +1,229 @@
+// Package xhtml parses EPUB content documents into golang.org/x/net/html
+// trees. Documents are read as XML first, so self-closing elements such as
+// <a id="p5"/> stay empty, and fall back to the HTML5 parser when they are
+// not well-formed.
+package xhtml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"maps"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+const nsXHTML = "http://www.w3.org/1999/xhtml"
+
+// Namespace prefixes used for attribute keys and element names, e.g.
+// "epub:type" and "epub:switch", whatever prefix the document declares.
+var prefixes = map[string]string{
+	"http://www.idpf.org/2007/ops":         "epub",
+	"http://www.w3.org/1999/xlink":         "xlink",
+	"http://www.w3.org/XML/1998/namespace": "xml",
+}
+
+// Element namespaces recorded in html.Node.Namespace.
+var elementNamespaces = map[string]string{
+	"http://www.w3.org/2000/svg":         "svg",
+	"http://www.w3.org/1998/Math/MathML": "math",
+}
+
+// Parse reads a content document and returns its document node.
+func Parse(r io.Reader) (*html.Node, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err := parseXML(data); err == nil {
+		return doc, nil
+	}
+	return html.Parse(bytes.NewReader(data))
+}
+
+func parseXML(data []byte) (*html.Node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = charset.NewReaderLabel
+
+	doc := &html.Node{Type: html.DocumentNode}
+	cur := doc
+	// scopes holds the prefixes declared for other namespaces, by URI, in
+	// each open element.
+	scopes := []map[string]string{nil}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			scope := scopes[len(scopes)-1]
+			var decls []html.Attribute
+			for _, a := range t.Attr {
+				if a.Name.Space != "xmlns" || a.Value == nsXHTML || prefixes[a.Value] != "" || elementNamespaces[a.Value] != "" {
+					continue
+				}
+				// Declarations of other namespaces are kept so that
+				// prefixed names still resolve when the tree is rendered.
+				if len(decls) == 0 {
+					scope = maps.Clone(scope)
+					if scope == nil {
+						scope = make(map[string]string)
+					}
+				}
+				scope[a.Value] = a.Name.Local
+				decls = append(decls, html.Attribute{Key: "xmlns:" + a.Name.Local, Val: a.Value})
+			}
+			scopes = append(scopes, scope)
+
+			n := &html.Node{Type: html.ElementNode, Namespace: elementNamespaces[t.Name.Space]}
+			if n.Namespace != "" || t.Name.Space == nsXHTML {
+				n.Data = t.Name.Local
+			} else {
+				n.Data = qualify(t.Name, scope)
+			}
+			n.DataAtom = atom.Lookup([]byte(n.Data))
+			n.Attr = decls
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" && a.Name.Space == "" {
+					continue
+				}
+				n.Attr = append(n.Attr, html.Attribute{Key: qualify(a.Name, scope), Val: a.Value})
+			}
+			cur.AppendChild(n)
+			cur = n
+		case xml.EndElement:
+			if cur.Parent != nil {
+				cur = cur.Parent
+				scopes = scopes[:len(scopes)-1]
+			}
+		case xml.CharData:
+			if cur != doc {
+				cur.AppendChild(&html.Node{Type: html.TextNode, Data: string(t)})
+			}
+		case xml.Comment:
+			cur.AppendChild(&html.Node{Type: html.CommentNode, Data: string(t)})
+		}
+	}
+	if doc.FirstChild == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return doc, nil
+}
+
+// qualify returns the element name or attribute key for name, prefixed
+// unless it is in no namespace. scope maps the namespaces of the document
+// without a prefix in prefixes to their declared prefixes.
+func qualify(name xml.Name, scope map[string]string) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if p, ok := prefixes[name.Space]; ok {
+		return p + ":" + name.Local
+	}
+	if p, ok := scope[name.Space]; ok {
+		return p + ":" + name.Local
+	}
+	if !strings.Contains(name.Space, ":") {
+		return name.Space + ":" + name.Local // undeclared prefix
+	}
+	return name.Local // default namespace
+}
+
+// Attr returns the value of n's attribute key, or "".
+func Attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// HasType reports whether n's epub:type attribute contains t.
+func HasType(n *html.Node, t string) bool {
+	for _, v := range strings.Fields(Attr(n, "epub:type")) {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the first element in n's subtree with the given tag, or nil.
+func Find(n *html.Node, tag atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if f := Find(c, tag); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// Resolve resolves href, found in the ZIP entry base, to a ZIP path and a
+// fragment. ok is false for links that leave the book (with a scheme or
+// host) and for malformed hrefs. A fragment-only href resolves to base.
+func Resolve(base, href string) (target, fragment string, ok bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", "", false
+	}
+	if u.Path == "" {
+		return base, u.Fragment, true
+	}
+	return path.Join(path.Dir(base), u.Path), u.Fragment, true
+}
+
+// Walk calls fn for every element in n's subtree, in document order.
+func Walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		Walk(c, fn)
+	}
+}
+
+// AnchorName reduces s to lowercase letters, digits, '-' and '_', for use
+// as an id and URL fragment.
+func AnchorName(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	if b.Len() == 0 {
+		return "doc"
+	}
+	return b.String()
+}
+
+// UniqueName returns name, or name with a "-2", "-3", … suffix if it is
+// already in used, and adds the result to used.
+func UniqueName(used map[string]bool, name string) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
@@ -0,0 +1,171 @@
+// Package ziplimit applies the ZIP-bomb limits of gopub.ReaderOptions to
+// an archive, so that gopub and its subpackages reading other ZIP-based
+// formats share one implementation. gopub re-exports the errors.
+package ziplimit
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+var (
+	ErrFileTooLarge      = errors.New("epub: file exceeds MaxFileSize limit")
+	ErrTooManyEntries    = errors.New("epub: zip entry count exceeds MaxEntries limit")
+	ErrTotalSizeTooLarge = errors.New("epub: total uncompressed size exceeds MaxTotalSize limit")
+	ErrCompressionRatio  = errors.New("epub: zip entry exceeds MaxCompressionRatio limit")
+)
+
+// minRatioCheckSize is the smallest uncompressed entry subject to
+// MaxCompressionRatio; tiny files legitimately compress very well.
+const minRatioCheckSize = 64 << 10
+
+// Limits holds the ZIP limits of gopub.ReaderOptions. 0 means unlimited.
+type Limits struct {
+	MaxFileSize         int64
+	MaxEntries          int
+	MaxTotalSize        int64
+	MaxCompressionRatio float64
+}
+
+// Check validates the archive directory against the entry count, total
+// size and compression ratio limits before anything is decompressed.
+// The declared sizes are trustworthy upper bounds: archive/zip fails reads
+// that produce more data than an entry declares.
+func (l Limits) Check(files []*zip.File) error {
+	if l.MaxEntries > 0 && len(files) > l.MaxEntries {
+		return ErrTooManyEntries
+	}
+	var total uint64
+	for _, f := range files {
+		total += f.UncompressedSize64
+		if l.MaxTotalSize > 0 && total > uint64(l.MaxTotalSize) {
+			return ErrTotalSizeTooLarge
+		}
+		if ExceedsRatio(f.UncompressedSize64, f.CompressedSize64, l.MaxCompressionRatio) {
+			return ErrCompressionRatio
+		}
+	}
+	return nil
+}
+
+// ExceedsRatio reports whether size bytes inflated from compressed bytes
+// exceed maxRatio. A non-positive maxRatio disables the check.
+func ExceedsRatio(size, compressed uint64, maxRatio float64) bool {
+	if maxRatio <= 0 || size < minRatioCheckSize {
+		return false
+	}
+	if compressed == 0 {
+		return true
+	}
+	return float64(size)/float64(compressed) > maxRatio
+}
+
+// Open opens a ZIP entry with the MaxFileSize and compression ratio limits
+// applied to the returned stream.
+func (l Limits) Open(f *zip.File) (io.ReadCloser, error) {
+	if l.MaxFileSize > 0 && f.UncompressedSize64 > uint64(l.MaxFileSize) {
+		return nil, ErrFileTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	if l.MaxFileSize > 0 {
+		rc = &sizeGuard{ReadCloser: rc, max: l.MaxFileSize}
+	}
+	if l.MaxCompressionRatio > 0 {
+		rc = &ratioGuard{ReadCloser: rc, compressed: f.CompressedSize64, maxRatio: l.MaxCompressionRatio}
+	}
+	return rc, nil
+}
+
+// ratioGuard wraps a ZIP entry stream and fails once the bytes produced
+// exceed the compression ratio limit for the entry.
+type ratioGuard struct {
+	io.ReadCloser
+	compressed uint64
+	maxRatio   float64
+	n          uint64
+}
+
+func (g *ratioGuard) Read(p []byte) (int, error) {
+	n, err := g.ReadCloser.Read(p)
+	g.n += uint64(n)
+	if ExceedsRatio(g.n, g.compressed, g.maxRatio) {
+		return n, ErrCompressionRatio
+	}
+	return n, err
+}
+
+// sizeGuard wraps a ZIP entry stream and fails once more than max bytes
+// have been produced.
+type sizeGuard struct {
+	io.ReadCloser
+	max int64
+	n   int64
+}
+
+func (g *sizeGuard) Read(p []byte) (int, error) {
+	n, err := g.ReadCloser.Read(p)
+	g.n += int64(n)
+	if g.n > g.max {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// FS checks the directory of zr against l and returns zr as an fs.FS whose
+// files are opened with Open.
+func FS(zr *zip.Reader, l Limits) (fs.FS, error) {
+	if err := l.Check(zr.File); err != nil {
+		return nil, err
+	}
+	files := make(map[*zip.FileHeader]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[&f.FileHeader] = f
+	}
+	return &limitFS{zr: zr, l: l, files: files}, nil
+}
+
+// limitFS is the fs.FS returned by FS. Files are looked up by the header
+// zip.Reader reports for them, since their names need not be valid fs
+// paths.
+type limitFS struct {
+	zr    *zip.Reader
+	l     Limits
+	files map[*zip.FileHeader]*zip.File
+}
+
+func (l *limitFS) Open(name string) (fs.File, error) {
+	f, err := l.zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return f, err
+	}
+	f.Close()
+	hdr, _ := fi.Sys().(*zip.FileHeader)
+	zf := l.files[hdr]
+	if zf == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	rc, err := l.l.Open(zf)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &limitFile{ReadCloser: rc, fi: fi}, nil
+}
+
+// limitFile is a file of a limitFS.
+type limitFile struct {
+	io.ReadCloser
+	fi fs.FileInfo
+}
+
+func (f *limitFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
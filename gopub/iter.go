@@ -0,0 +1,105 @@
+package gopub
+
+import (
+	"archive/zip"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// NavPos is the position of an entry in a navigation tree.
+type NavPos struct {
+	// Depth is 0 for top-level entries.
+	Depth int
+	// Path holds the index of the entry and each of its ancestors within
+	// their lists, outermost first; len(Path) == Depth+1.
+	Path []int
+}
+
+// Linear yields the index and item of each spine item that is part of the
+// linear reading order, i.e. not marked linear="no".
+func (s *Spine) Linear() iter.Seq2[int, *SpineItem] {
+	return func(yield func(int, *SpineItem) bool) {
+		for i := range s.Itemrefs {
+			item := &s.Itemrefs[i]
+			if item.Linear == "no" {
+				continue
+			}
+			if !yield(i, item) {
+				return
+			}
+		}
+	}
+}
+
+// ByMediaType yields the manifest items whose media type is one of
+// mediaTypes. A media type ending in "/" (e.g. "image/") matches as a prefix.
+func (m *Manifest) ByMediaType(mediaTypes ...string) iter.Seq[*ManifestItem] {
+	return func(yield func(*ManifestItem) bool) {
+		for i := range m.Items {
+			item := &m.Items[i]
+			if !matchesMediaType(item.MediaType, mediaTypes) {
+				continue
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+func matchesMediaType(mt string, mediaTypes []string) bool {
+	for _, want := range mediaTypes {
+		if mt == want || strings.HasSuffix(want, "/") && strings.HasPrefix(mt, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk yields every entry of the nav section depth-first, parents before
+// their children, with its position in the tree.
+func (n *NavSection) Walk() iter.Seq2[NavPos, *NavItem] {
+	return func(yield func(NavPos, *NavItem) bool) {
+		walkNavItems(n.Items, nil, yield)
+	}
+}
+
+func walkNavItems(items []NavItem, path []int, yield func(NavPos, *NavItem) bool) bool {
+	for i := range items {
+		p := append(slices.Clip(path), i)
+		if !yield(NavPos{Depth: len(path), Path: p}, &items[i]) {
+			return false
+		}
+		if !walkNavItems(items[i].SubItems, p, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk yields every navPoint of the NCX depth-first, parents before their
+// children, with its position in the tree.
+func (n *NCX) Walk() iter.Seq2[NavPos, *NavPoint] {
+	return func(yield func(NavPos, *NavPoint) bool) {
+		walkNavPoints(n.NavPoints, nil, yield)
+	}
+}
+
+func walkNavPoints(points []NavPoint, path []int, yield func(NavPos, *NavPoint) bool) bool {
+	for i := range points {
+		p := append(slices.Clip(path), i)
+		if !yield(NavPos{Depth: len(path), Path: p}, &points[i]) {
+			return false
+		}
+		if !walkNavPoints(points[i].NavPoints, p, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// Files yields every entry of the EPUB's ZIP archive in archive order.
+func (r *Reader) Files() iter.Seq[*zip.File] {
+	return slices.Values(r.entries)
+}
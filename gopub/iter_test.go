@@ -0,0 +1,101 @@
+package gopub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSpineAndManifestIterators(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	rf := r.DefaultRendition()
+
+	var linear []int
+	for i, item := range rf.Spine.Linear() {
+		if item.Linear == "no" {
+			t.Errorf("non-linear item %q yielded", item.IDREF)
+		}
+		linear = append(linear, i)
+	}
+	if len(linear) != len(rf.Spine.Itemrefs)-1 || linear[0] != 1 {
+		t.Errorf("unexpected linear indexes %v", linear)
+	}
+
+	images := slices.Collect(rf.Manifest.ByMediaType("image/"))
+	if len(images) != len(rf.Manifest.Images()) {
+		t.Errorf(expFormat, len(rf.Manifest.Images()), len(images))
+	}
+	for item := range rf.Manifest.ByMediaType(MediaTypeNCX, MediaTypeCSS) {
+		if item.MediaType != MediaTypeNCX && item.MediaType != MediaTypeCSS {
+			t.Errorf("unexpected media type %q", item.MediaType)
+		}
+	}
+
+	if n := len(slices.Collect(r.Files())); n != len(r.entries) {
+		t.Errorf(expFormat, len(r.entries), n)
+	}
+}
+
+func TestNavWalk(t *testing.T) {
+	nav := NavSection{Items: []NavItem{
+		{Link: navLink{Text: "1"}, SubItems: []NavItem{
+			{Link: navLink{Text: "1.1"}},
+			{Link: navLink{Text: "1.2"}, SubItems: []NavItem{{Link: navLink{Text: "1.2.1"}}}},
+		}},
+		{Link: navLink{Text: "2"}},
+	}}
+	type visit struct {
+		text string
+		pos  NavPos
+	}
+	var got []visit
+	for pos, item := range nav.Walk() {
+		got = append(got, visit{item.Link.Text, pos})
+	}
+	want := []visit{
+		{"1", NavPos{0, []int{0}}},
+		{"1.1", NavPos{1, []int{0, 0}}},
+		{"1.2", NavPos{1, []int{0, 1}}},
+		{"1.2.1", NavPos{2, []int{0, 1, 0}}},
+		{"2", NavPos{0, []int{1}}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf(expFormat, want, got)
+	}
+	for i := range want {
+		if got[i].text != want[i].text || got[i].pos.Depth != want[i].pos.Depth || !slices.Equal(got[i].pos.Path, want[i].pos.Path) {
+			t.Errorf(expFormat, want[i], got[i])
+		}
+	}
+
+	n := 0
+	for range nav.Walk() {
+		if n++; n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Errorf("break not honoured: %d", n)
+	}
+}
+
+func TestNCXWalk(t *testing.T) {
+	r := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf": limitsTestOPF,
+		"OEBPS/ch.xhtml":    "<html/>",
+		"OEBPS/toc.ncx":     nestedNavPoints(4),
+	})
+	depth := -1
+	for pos, np := range r.DefaultRendition().NCX.Walk() {
+		if pos.Depth != depth+1 || len(pos.Path) != pos.Depth+1 || np.Content.Src != "ch.xhtml" {
+			t.Errorf("unexpected position %+v for %+v", pos, np)
+		}
+		depth = pos.Depth
+	}
+	if depth != 3 {
+		t.Errorf(expFormat, 3, depth)
+	}
+}
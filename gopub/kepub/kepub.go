@@ -0,0 +1,323 @@
+// Package kepub converts EPUBs to Kobo's KEPUB format. Content documents
+// get their text wrapped in koboSpan elements, which the Kobo reader uses
+// for locations, highlights and reading statistics, and their body wrapped
+// in the book-columns and book-inner divs its stylesheet hooks target.
+// Every other entry, including the package documents, is copied unchanged.
+package kepub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+)
+
+// ErrNoBody is returned for content documents without a body element.
+var ErrNoBody = errors.New("kepub: document has no body")
+
+// Ext is the file name extension of KEPUB books.
+const Ext = ".kepub.epub"
+
+// StyleHacks is the stylesheet injected into the head of every converted
+// document, keeping the wrapper divs from adding margins.
+const StyleHacks = `div#book-inner { margin-top: 0; margin-bottom: 0; }`
+
+// Name returns the KEPUB file name for the EPUB name: "book.epub" becomes
+// "book.kepub.epub".
+func Name(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), Ext) {
+		return name
+	}
+	if ext := filepath.Ext(name); strings.EqualFold(ext, ".epub") {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name + Ext
+}
+
+// Convert writes r as a KEPUB to w. The XHTML documents listed in the
+// manifests, except navigation documents, are converted; documents that
+// already contain koboSpans are copied as they are.
+func Convert(w io.Writer, r *gopub.Reader) error {
+	docs := make(map[string]*gopub.ManifestItem)
+	packages := make(map[string]bool)
+	for _, rf := range r.Rootfiles {
+		if err := rf.Load(); err != nil {
+			return err
+		}
+		packages[rf.FullPath] = true
+		for i := range rf.Manifest.Items {
+			item := &rf.Manifest.Items[i]
+			if item.F != nil && item.MediaType == gopub.MediaTypeXHTML && !hasProperty(item.Properties, "nav") {
+				docs[item.F.Name] = item
+			}
+		}
+	}
+
+	ew := gopub.NewWriter(w)
+	for f := range r.Files() {
+		switch {
+		case f.Name == "mimetype" || f.Name == "META-INF/container.xml" || strings.HasSuffix(f.Name, "/"):
+			continue
+		case packages[f.Name]:
+			if err := ew.CopyRootfile(f); err != nil {
+				return err
+			}
+			continue
+		}
+		item := docs[f.Name]
+		if item == nil {
+			if err := ew.CopyFile(f); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := item.ReadAll()
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(data, []byte("koboSpan")) {
+			if data, err = ConvertDocument(data); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		if err := ew.WriteFile(f.Name, data); err != nil {
+			return err
+		}
+	}
+	return ew.Close()
+}
+
+// ConvertFile converts the EPUB file src and writes the KEPUB to dir, or
+// next to src if dir is empty, under the name Name gives. It returns the
+// path written.
+func ConvertFile(src, dir string) (string, error) {
+	rc, err := gopub.OpenReader(src)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	if dir == "" {
+		dir = filepath.Dir(src)
+	}
+	name := filepath.Join(dir, Name(filepath.Base(src)))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	err = Convert(f, &rc.Reader)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// ConvertDocument converts one XHTML content document: text in the body
+// is split into sentences wrapped in <span class="koboSpan"
+// id="kobo.P.S">, numbering paragraphs P and sentences S within them from
+// 1, images get a span of their own, the body content is wrapped in
+// div#book-columns > div#book-inner, and StyleHacks is added to the head.
+func ConvertDocument(data []byte) ([]byte, error) {
+	doc, err := xhtml.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	root := xhtml.Find(doc, atom.Html)
+	body := xhtml.Find(doc, atom.Body)
+	if root == nil || body == nil {
+		return nil, ErrNoBody
+	}
+	if head := xhtml.Find(root, atom.Head); head != nil {
+		style := element(atom.Style, "type", "text/css", "class", "kobostylehacks")
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: StyleHacks})
+		head.AppendChild(style)
+	}
+
+	s := &spanner{newPara: true}
+	s.walk(body)
+
+	columns := element(atom.Div, "id", "book-columns")
+	inner := element(atom.Div, "id", "book-inner")
+	columns.AppendChild(inner)
+	for c := body.FirstChild; c != nil; c = body.FirstChild {
+		body.RemoveChild(c)
+		inner.AppendChild(c)
+	}
+	body.AppendChild(columns)
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(doctype(data) + "\n")
+	setNamespaces(root)
+	if err := xhtml.Render(&b, root); err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// blockElements start a new koboSpan paragraph.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Li: true, atom.Dt: true,
+	atom.Dd: true, atom.Blockquote: true, atom.Pre: true, atom.Td: true,
+	atom.Th: true, atom.Caption: true, atom.Figcaption: true, atom.Section: true,
+	atom.Article: true, atom.Aside: true, atom.Header: true, atom.Footer: true,
+	atom.Table: true, atom.Tr: true, atom.Ul: true, atom.Ol: true, atom.Br: true,
+	atom.Hr: true,
+}
+
+// skipElements are left without spans.
+var skipElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Textarea: true, atom.Noscript: true,
+	atom.Select: true, atom.Button: true,
+}
+
+// spanner numbers and inserts koboSpans.
+type spanner struct {
+	para, sentence int
+	newPara        bool
+}
+
+func (s *spanner) walk(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.TextNode:
+			s.text(c)
+		case c.Type != html.ElementNode || c.Namespace != "" || skipElements[c.DataAtom]:
+		case c.DataAtom == atom.Img:
+			s.newPara = true
+			span := s.span()
+			n.InsertBefore(span, c)
+			n.RemoveChild(c)
+			span.AppendChild(c)
+			s.newPara = true
+		default:
+			block := blockElements[c.DataAtom]
+			if block {
+				s.newPara = true
+			}
+			s.walk(c)
+			if block {
+				s.newPara = true
+			}
+		}
+		c = next
+	}
+}
+
+// text replaces the text node t with one span per sentence.
+func (s *spanner) text(t *html.Node) {
+	if strings.TrimSpace(t.Data) == "" {
+		return
+	}
+	parent := t.Parent
+	rest := t.Data
+	if lead := len(rest) - len(strings.TrimLeftFunc(rest, unicode.IsSpace)); lead > 0 {
+		parent.InsertBefore(&html.Node{Type: html.TextNode, Data: rest[:lead]}, t)
+		rest = rest[lead:]
+	}
+	for _, sentence := range splitSentences(rest) {
+		span := s.span()
+		span.AppendChild(&html.Node{Type: html.TextNode, Data: sentence})
+		parent.InsertBefore(span, t)
+	}
+	parent.RemoveChild(t)
+}
+
+// span returns an empty koboSpan with the next id.
+func (s *spanner) span() *html.Node {
+	if s.newPara {
+		s.para++
+		s.sentence = 0
+		s.newPara = false
+	}
+	s.sentence++
+	return element(atom.Span, "class", "koboSpan", "id", fmt.Sprintf("kobo.%d.%d", s.para, s.sentence))
+}
+
+// sentenceEnd matches the end of a sentence: terminal punctuation, any
+// closing quotes or brackets, and the whitespace after them.
+var sentenceEnd = regexp.MustCompile(`[.!?:…]+['"’”)\]]*\s+`)
+
+// splitSentences splits s after every sentence end. The whitespace
+// following a sentence stays with it.
+func splitSentences(s string) []string {
+	var out []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(s, -1) {
+		if loc[1] < len(s) {
+			out = append(out, s[start:loc[1]])
+			start = loc[1]
+		}
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// doctypePattern matches the document type declaration of a document.
+var doctypePattern = regexp.MustCompile(`(?is)<!DOCTYPE[^>\[]*(\[[^\]]*\])?\s*>`)
+
+// doctype returns the document type declaration of data, or the HTML5 one.
+func doctype(data []byte) string {
+	if m := doctypePattern.Find(data[:min(len(data), 1024)]); m != nil {
+		return string(m)
+	}
+	return "<!DOCTYPE html>"
+}
+
+// setNamespaces declares the XHTML namespace on root, and the EPUB one if
+// an epub: element or attribute is used.
+func setNamespaces(root *html.Node) {
+	attrs := []html.Attribute{{Key: "xmlns", Val: "http://www.w3.org/1999/xhtml"}}
+	usesEPUB := false
+	xhtml.Walk(root, func(n *html.Node) {
+		usesEPUB = usesEPUB || strings.HasPrefix(n.Data, "epub:")
+		for _, a := range n.Attr {
+			usesEPUB = usesEPUB || a.Namespace == "epub" || strings.HasPrefix(a.Key, "epub:")
+		}
+	})
+	if usesEPUB {
+		attrs = append(attrs, html.Attribute{Key: "xmlns:epub", Val: "http://www.idpf.org/2007/ops"})
+	}
+	for _, a := range root.Attr {
+		if a.Key != "xmlns" && a.Key != "xmlns:epub" {
+			attrs = append(attrs, a)
+		}
+	}
+	root.Attr = attrs
+}
+
+func element(tag atom.Atom, attrs ...string) *html.Node {
+	n := &html.Node{Type: html.ElementNode, Data: tag.String(), DataAtom: tag}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attr = append(n.Attr, html.Attribute{Key: attrs[i], Val: attrs[i+1]})
+	}
+	return n
+}
+
+func hasProperty(properties, p string) bool {
+	for _, v := range strings.Fields(properties) {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package kepub
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+const chapter = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.1//EN" "http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en">
+<head><title>One</title></head>
+<body>
+<h1 epub:type="title">Chapter One</h1>
+<p>It began. &#8220;Who?&#8221; she asked. The <em>end</em> came</p>
+<p><img src="a.png" alt=""/> Caption</p>
+<script>var x = "no spans. here";</script>
+</body>
+</html>`
+
+func TestConvertDocument(t *testing.T) {
+	out, err := ConvertDocument([]byte(chapter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.1//EN" "http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd">`,
+		`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en">`,
+		`<style type="text/css" class="kobostylehacks">` + StyleHacks + `</style></head>`,
+		`<body><div id="book-columns"><div id="book-inner">`,
+		`<h1 epub:type="title"><span class="koboSpan" id="kobo.1.1">Chapter One</span></h1>`,
+		`<p><span class="koboSpan" id="kobo.2.1">It began. </span><span class="koboSpan" id="kobo.2.2">“Who?” </span>` +
+			`<span class="koboSpan" id="kobo.2.3">she asked. </span><span class="koboSpan" id="kobo.2.4">The </span>` +
+			`<em><span class="koboSpan" id="kobo.2.5">end</span></em> <span class="koboSpan" id="kobo.2.6">came</span></p>`,
+		`<p><span class="koboSpan" id="kobo.3.1"><img src="a.png" alt=""/></span> <span class="koboSpan" id="kobo.4.1">Caption</span></p>`,
+		`<script>var x = "no spans. here";</script>`,
+		`</div></div></body>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestConvertDocumentNamespaces(t *testing.T) {
+	const doc = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:ops="http://www.idpf.org/2007/ops"
+ xmlns:a="urn:a"><body>
+<ops:switch id="s"><ops:case required-namespace="http://www.w3.org/1998/Math/MathML">Formula</ops:case>
+<ops:default>Text</ops:default></ops:switch>
+<p xmlns:b="urn:b" a:x="1" b:x="2">Two</p>
+</body></html>`
+	out, err := ConvertDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xmlns:a="urn:a">`,
+		`<epub:switch id="s"><epub:case required-namespace="http://www.w3.org/1998/Math/MathML">`,
+		`</epub:case>`,
+		`<epub:default><span class="koboSpan" id="kobo.1.2">Text</span></epub:default></epub:switch>`,
+		`<p xmlns:b="urn:b" a:x="1" b:x="2">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	for s, want := range map[string][]string{
+		"One. Two! Three":         {"One. ", "Two! ", "Three"},
+		"Wait... \"What?\" Done.": {"Wait... ", "\"What?\" ", "Done."},
+		"3.14 is pi":              {"3.14 is pi"},
+		"Trailing.  ":             {"Trailing.  "},
+	} {
+		if got := splitSentences(s); !slices.Equal(got, want) {
+			t.Errorf("%q: "+expFormat, s, want, got)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	for name, want := range map[string]string{
+		"book.epub":       "book.kepub.epub",
+		"Book.EPUB":       "Book.kepub.epub",
+		"book.kepub.epub": "book.kepub.epub",
+		"book":            "book.kepub.epub",
+	} {
+		if got := Name(name); got != want {
+			t.Errorf("%s: "+expFormat, name, want, got)
+		}
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	name, err := ConvertFile("../_test_files/alice.epub", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(name) != "alice.kepub.epub" {
+		t.Errorf(expFormat, "alice.kepub.epub", filepath.Base(name))
+	}
+	orig, err := gopub.OpenReader("../_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	rc, err := gopub.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	want, got := orig.DefaultRendition(), rc.DefaultRendition()
+	if len(got.Manifest.Items) != len(want.Manifest.Items) || len(got.Spine.Itemrefs) != len(want.Spine.Itemrefs) {
+		t.Fatalf("manifest or spine changed: %d/%d items, %d/%d itemrefs",
+			len(got.Manifest.Items), len(want.Manifest.Items), len(got.Spine.Itemrefs), len(want.Spine.Itemrefs))
+	}
+	for i, ref := range got.Spine.Itemrefs {
+		if ref.IDREF != want.Spine.Itemrefs[i].IDREF {
+			t.Errorf("itemref %d: "+expFormat, i, want.Spine.Itemrefs[i].IDREF, ref.IDREF)
+		}
+	}
+	converted := 0
+	for _, ref := range got.Spine.Itemrefs {
+		if ref.ManifestItem == nil || ref.MediaType != gopub.MediaTypeXHTML {
+			continue
+		}
+		data, err := ref.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(`id="kobo.1.1"`)) && bytes.Contains(data, []byte(`<div id="book-inner">`)) {
+			converted++
+		}
+	}
+	if converted == 0 {
+		t.Error("no spine document was converted")
+	}
+
+	var again bytes.Buffer
+	if err := Convert(&again, &rc.Reader); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gopub.NewReader(bytes.NewReader(again.Bytes()), int64(again.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.DefaultRendition().Spine.Itemrefs[0].ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte(`id="book-inner"`)) != 1 {
+		t.Error("converted document converted again")
+	}
+}
+
+const expFormat = "Expected: %v, but got: %v\n"
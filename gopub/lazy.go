@@ -0,0 +1,133 @@
+package gopub
+
+import (
+	"encoding/xml"
+	"io"
+	"slices"
+)
+
+// Load parses the manifest, spine, NCX and nav document of a rootfile
+// opened with ModeLazy. It is safe for concurrent use; every call returns
+// the result of the first, and a failure is also recorded in
+// Reader.Warnings. Without ModeLazy, NewReader has already parsed
+// everything and Load returns nil.
+//
+// Rootfile methods and Reader methods that need these parts call Load
+// themselves; those without an error result, such as TOCNav and ItemName,
+// return nil or "" when it fails. Call it before reading the Manifest,
+// Spine, Guide, NCX or NavDoc fields directly.
+func (rf *Rootfile) Load() error {
+	if rf.r == nil {
+		return nil
+	}
+	rf.once.Do(func() {
+		rf.loadErr = rf.r.loadRootfile(rf)
+		if rf.loadErr != nil {
+			rf.r.warn("epub: loading %s: %v", rf.FullPath, rf.loadErr)
+		}
+	})
+	return rf.loadErr
+}
+
+// Load parses every rootfile of a Reader opened with ModeLazy.
+// See Rootfile.Load.
+func (r *Reader) Load() error {
+	for _, rf := range r.Container.Rootfiles {
+		if err := rf.Load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMetadata returns the metadata of the default rendition, reading only
+// container.xml and the package document up to </metadata>. It is the
+// fastest way to index large numbers of books.
+func ReadMetadata(ra io.ReaderAt, size int64, opts ...Option) (*Metadata, error) {
+	opts = append(slices.Clip(opts), func(o *ReaderOptions) { o.Mode |= ModeLazy })
+	r, err := NewReader(ra, size, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &r.DefaultRendition().Metadata, nil
+}
+
+// setMetadata decodes only the package attributes and metadata of each
+// rootfile, deferring the rest to Rootfile.Load.
+func (r *Reader) setMetadata() error {
+	for _, rf := range r.Container.Rootfiles {
+		data, err := r.readRootfile(rf)
+		if err != nil {
+			return err
+		}
+		if err := r.decodeMetadata(data, &rf.Package); err != nil {
+			return err
+		}
+		if err := checkVersion(rf.Package.Version); err != nil {
+			return err
+		}
+		processRefinements(&rf.Metadata)
+		rf.r = r
+	}
+	return nil
+}
+
+// decodeMetadata decodes the <package> attributes and <metadata> element of
+// an OPF document, stopping after </metadata>.
+func (r *Reader) decodeMetadata(data []byte, pkg *Package) error {
+	dec := r.newXMLDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "package":
+			for _, a := range se.Attr {
+				switch a.Name.Local {
+				case "version":
+					pkg.Version = a.Value
+				case "unique-identifier":
+					pkg.UniqueIdentifier = a.Value
+				}
+			}
+		case "metadata":
+			return dec.DecodeElement(&pkg.Metadata, &se)
+		}
+	}
+}
+
+// loadRootfile parses everything in rf that setMetadata deferred.
+func (r *Reader) loadRootfile(rf *Rootfile) error {
+	data, err := r.readRootfile(rf)
+	if err != nil {
+		return err
+	}
+	var pkg Package
+	if err := r.decodeXML(data, &pkg); err != nil {
+		return err
+	}
+	rf.Manifest, rf.Spine, rf.Guide = pkg.Manifest, pkg.Spine, pkg.Guide
+	setCoverProperty(rf)
+
+	if err := r.setRootfileItems(rf); err != nil {
+		return err
+	}
+	if len(rf.Spine.Itemrefs) < 1 {
+		return ErrNoItemref
+	}
+	if err := r.setRootfileNCX(rf); err != nil {
+		return err
+	}
+	if err := r.setRootfileTOC(rf); err != nil {
+		return err
+	}
+	return r.checkNavDepth(rf)
+}
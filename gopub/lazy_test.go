@@ -0,0 +1,90 @@
+package gopub
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestModeLazy(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub", WithMode(ModeLazy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	rf := r.DefaultRendition()
+	if want := epubExpectations["alice.epub"].title; rf.Metadata.MainTitle().Name != want {
+		t.Errorf(expFormat, want, rf.Metadata.MainTitle().Name)
+	}
+	if len(rf.Manifest.Items) != 0 || len(rf.NCX.NavPoints) != 0 {
+		t.Fatal("manifest or NCX parsed before Load")
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if err := rf.Load(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if rf.Spine.Itemrefs[0].IDREF != "coverpage-wrapper" || rf.Spine.Itemrefs[0].ManifestItem == nil {
+		t.Errorf("spine not resolved: %+v", rf.Spine.Itemrefs[0])
+	}
+	if len(rf.NCX.NavPoints) == 0 {
+		t.Error("NCX not parsed by Load")
+	}
+}
+
+func TestModeLazyDefersErrors(t *testing.T) {
+	data := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Broken</dc:title></metadata>
+  <manifest><item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="missing"/></spine>
+</package>`,
+		"OEBPS/ch.xhtml": "<html/>",
+	})
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err != ErrBadItemref {
+		t.Fatalf(expFormat, ErrBadItemref, err)
+	}
+
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), WithMode(ModeLazy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load(); err != ErrBadItemref {
+		t.Errorf(expFormat, ErrBadItemref, err)
+	}
+	if _, err := r.GetCover(); err != ErrBadItemref {
+		t.Errorf(expFormat, ErrBadItemref, err)
+	}
+	if rf := r.DefaultRendition(); rf.TOCNav() != nil || rf.ItemName("ch.xhtml") != "" {
+		t.Error("navigation returned from a failed load")
+	}
+	if w := r.Warnings(); len(w) != 1 || !strings.Contains(w[0], ErrBadItemref.Error()) {
+		t.Errorf("warnings: %q", w)
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	data, err := os.ReadFile("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMetadata(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := epubExpectations["alice.epub"]
+	if md.MainTitle().Name != exp.title {
+		t.Errorf(expFormat, exp.title, md.MainTitle().Name)
+	}
+	if len(md.Creator) == 0 || md.Creator[0].Name != exp.creator {
+		t.Errorf(expFormat, exp.creator, md.Creator)
+	}
+}
@@ -0,0 +1,148 @@
+package gopub
+
+import (
+	"bytes"
+	"encoding/xml"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/LapisApple/go-epub/gopub/internal/ziplimit"
+)
+
+// RecommendedLimits returns options suitable for opening untrusted EPUBs.
+func RecommendedLimits() ReaderOptions {
+	return ReaderOptions{
+		MaxFileSize:         64 << 20,
+		MaxEntries:          10000,
+		MaxTotalSize:        1 << 30,
+		MaxCompressionRatio: 100,
+		MaxXMLDepth:         256,
+		MaxXMLTokens:        1 << 20,
+		MaxXMLAttrs:         256,
+		MaxNavDepth:         32,
+		MaxImagePixels:      1 << 26,
+	}
+}
+
+// zipLimits returns the ZIP limits of o.
+func (o *ReaderOptions) zipLimits() ziplimit.Limits {
+	return ziplimit.Limits{
+		MaxFileSize:         o.MaxFileSize,
+		MaxEntries:          o.MaxEntries,
+		MaxTotalSize:        o.MaxTotalSize,
+		MaxCompressionRatio: o.MaxCompressionRatio,
+	}
+}
+
+// limitTokenReader counts tokens, nesting depth and attributes while a
+// document decodes.
+type limitTokenReader struct {
+	d         *xml.Decoder
+	maxDepth  int
+	maxTokens int
+	maxAttrs  int
+	depth     int
+	tokens    int
+}
+
+func (l *limitTokenReader) Token() (xml.Token, error) {
+	tok, err := l.d.Token()
+	if err != nil {
+		return tok, err
+	}
+	l.tokens++
+	if l.maxTokens > 0 && l.tokens > l.maxTokens {
+		return nil, ErrXMLTooManyTokens
+	}
+	switch tok := tok.(type) {
+	case xml.StartElement:
+		l.depth++
+		if l.maxDepth > 0 && l.depth > l.maxDepth {
+			return nil, ErrXMLTooDeep
+		}
+		if l.maxAttrs > 0 && len(tok.Attr) > l.maxAttrs {
+			return nil, ErrXMLTooManyAttrs
+		}
+	case xml.EndElement:
+		l.depth--
+	}
+	return tok, nil
+}
+
+// decodeXML decodes an EPUB XML document, enforcing the XML limits in r.opts.
+// In strict mode the document is decoded without repairs.
+func (r *Reader) decodeXML(data []byte, v any) error {
+	return r.newXMLDecoder(data).Decode(v)
+}
+
+// newXMLDecoder returns a decoder for data that applies the repairs and XML
+// limits of decodeXML.
+func (r *Reader) newXMLDecoder(data []byte) *xml.Decoder {
+	if r.opts.strict() {
+		data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	} else {
+		data = sanitizeXML(data)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	if r.opts.MaxXMLDepth <= 0 && r.opts.MaxXMLTokens <= 0 && r.opts.MaxXMLAttrs <= 0 {
+		return dec
+	}
+	lim := &limitTokenReader{d: dec, maxDepth: r.opts.MaxXMLDepth, maxTokens: r.opts.MaxXMLTokens, maxAttrs: r.opts.MaxXMLAttrs}
+	return xml.NewTokenDecoder(lim)
+}
+
+// checkNavDepths enforces MaxNavDepth on every rootfile.
+func (r *Reader) checkNavDepths() error {
+	for _, rf := range r.Container.Rootfiles {
+		if err := r.checkNavDepth(rf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNavDepth enforces MaxNavDepth on the NCX and nav document of rf.
+func (r *Reader) checkNavDepth(rf *Rootfile) error {
+	limit := r.opts.MaxNavDepth
+	if limit <= 0 {
+		return nil
+	}
+	for _, np := range rf.NCX.NavPoints {
+		if navPointDepth(np, limit) > limit {
+			return ErrNavTooDeep
+		}
+	}
+	for _, nav := range rf.NavDoc.Navs {
+		for _, item := range nav.Items {
+			if navItemDepth(item, limit) > limit {
+				return ErrNavTooDeep
+			}
+		}
+	}
+	return nil
+}
+
+// navPointDepth returns the depth of np's subtree, stopping once it exceeds limit.
+func navPointDepth(np NavPoint, limit int) int {
+	deepest := 0
+	for _, child := range np.NavPoints {
+		deepest = max(deepest, navPointDepth(child, limit))
+		if deepest >= limit {
+			break
+		}
+	}
+	return deepest + 1
+}
+
+// navItemDepth returns the depth of item's subtree, stopping once it exceeds limit.
+func navItemDepth(item NavItem, limit int) int {
+	deepest := 0
+	for _, sub := range item.SubItems {
+		deepest = max(deepest, navItemDepth(sub, limit))
+		if deepest >= limit {
+			break
+		}
+	}
+	return deepest + 1
+}
@@ -0,0 +1,88 @@
+package gopub
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const limitsTestOPF = `<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Limits</dc:title></metadata>
+  <manifest>
+    <item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+  </manifest>
+  <spine toc="ncx"><itemref idref="ch"/></spine>
+</package>`
+
+func nestedNavPoints(depth int) string {
+	var sb strings.Builder
+	for i := 0; i < depth; i++ {
+		sb.WriteString(`<navPoint><navLabel><text>x</text></navLabel><content src="ch.xhtml"/>`)
+	}
+	for i := 0; i < depth; i++ {
+		sb.WriteString(`</navPoint>`)
+	}
+	return `<ncx><navMap>` + sb.String() + `</navMap></ncx>`
+}
+
+func TestReaderLimits(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": limitsTestOPF,
+		"OEBPS/ch.xhtml":    "<html/>",
+		"OEBPS/toc.ncx":     nestedNavPoints(6),
+		"OEBPS/zeros.bin":   strings.Repeat("\x00", 1<<20),
+	}
+	data := buildTestEpub(t, files)
+
+	tests := []struct {
+		name string
+		opts ReaderOptions
+		want error
+	}{
+		{"entries", ReaderOptions{MaxEntries: 3}, ErrTooManyEntries},
+		{"total size", ReaderOptions{MaxTotalSize: 1 << 19}, ErrTotalSizeTooLarge},
+		{"ratio", ReaderOptions{MaxCompressionRatio: 50}, ErrCompressionRatio},
+		{"xml depth", ReaderOptions{MaxXMLDepth: 8}, ErrXMLTooDeep},
+		{"xml tokens", ReaderOptions{MaxXMLTokens: 20}, ErrXMLTooManyTokens},
+		{"xml attributes", ReaderOptions{MaxXMLAttrs: 2}, ErrXMLTooManyAttrs},
+		{"nav depth", ReaderOptions{MaxNavDepth: 4}, ErrNavTooDeep},
+		{"within limits", ReaderOptions{MaxEntries: 10, MaxXMLDepth: 32, MaxXMLAttrs: 3, MaxNavDepth: 6, MaxCompressionRatio: 5000}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(data), int64(len(data)), WithLimits(tt.opts))
+			if err != tt.want {
+				t.Errorf(expFormat, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestManifestItemOpenRatioGuard(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": strings.Replace(limitsTestOPF, `<item id="ncx"`, `<item id="zeros" href="zeros.bin" media-type="application/octet-stream"/><item id="ncx"`, 1),
+		"OEBPS/ch.xhtml":    "<html/>",
+		"OEBPS/toc.ncx":     nestedNavPoints(1),
+		"OEBPS/zeros.bin":   strings.Repeat("\x00", 1<<20),
+	}
+	r := openTestEpub(t, files)
+	var item *ManifestItem
+	for i := range r.DefaultRendition().Manifest.Items {
+		if it := &r.DefaultRendition().Manifest.Items[i]; it.ID == "zeros" {
+			item = it
+		}
+	}
+
+	// Tighten the limit after opening to exercise the stream guard alone.
+	r.opts.MaxCompressionRatio = 50
+	rc, err := item.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(io.Discard, rc); err != ErrCompressionRatio {
+		t.Errorf(expFormat, ErrCompressionRatio, err)
+	}
+}
@@ -0,0 +1,93 @@
+package gopub
+
+import (
+	"archive/zip"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Link represents an EPUB 3.0 <link> element inside <metadata>, e.g.
+// <link rel="record" href="onix.xml" media-type="application/xml" properties="onix"/>.
+type Link struct {
+	ID         string `xml:"id,attr"`
+	Rel        string `xml:"rel,attr"`
+	HREF       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+	Hreflang   string `xml:"hreflang,attr"`
+	Refines    string `xml:"refines,attr"`
+	// ManifestItem is the manifest entry the link points to, if any.
+	ManifestItem *ManifestItem `xml:"-"`
+	// F is the ZIP entry the link points to, or nil for remote links.
+	F *zip.File `xml:"-"`
+	r *Reader
+}
+
+// HasRel reports whether rel appears in the link's space-separated rel value.
+func (l *Link) HasRel(rel string) bool {
+	return hasProperty(l.Rel, rel)
+}
+
+// IsRemote reports whether the link points outside the EPUB container.
+func (l *Link) IsRemote() bool {
+	u, err := url.Parse(l.HREF)
+	return err == nil && (u.Scheme != "" || u.Host != "")
+}
+
+// Open returns a ReadCloser that provides access to a local linked resource.
+// The owning Reader's limits apply as for ManifestItem.Open.
+func (l *Link) Open() (io.ReadCloser, error) {
+	if l.F == nil {
+		return nil, ErrBadLink
+	}
+	if l.r == nil {
+		return l.F.Open()
+	}
+	return l.r.openZipFile(l.F)
+}
+
+// Links returns the metadata links whose rel contains rel.
+// An empty rel returns every link.
+func (m *Metadata) Links(rel string) []*Link {
+	var out []*Link
+	for i := range m.Link {
+		l := &m.Link[i]
+		if rel == "" || l.HasRel(rel) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Records returns the rel="record" links pointing to external metadata records.
+func (m *Metadata) Records() []*Link {
+	return m.Links("record")
+}
+
+// setLinks resolves local metadata links to manifest items and ZIP entries.
+func (r *Reader) setLinks(rf *Rootfile) {
+	opfDir := path.Dir(rf.FullPath)
+	for i := range rf.Metadata.Link {
+		l := &rf.Metadata.Link[i]
+		l.r = r
+		if l.HREF == "" || l.IsRemote() {
+			continue
+		}
+		href := l.HREF
+		if j := strings.IndexByte(href, '#'); j >= 0 {
+			href = href[:j]
+		}
+		href, _ = url.PathUnescape(href)
+		abs := path.Join(opfDir, href)
+		l.F = r.lookup(abs)
+		for j := range rf.Manifest.Items {
+			item := &rf.Manifest.Items[j]
+			if item.F != nil && item.F == l.F {
+				l.ManifestItem = item
+				break
+			}
+		}
+	}
+}
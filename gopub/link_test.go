@@ -0,0 +1,115 @@
+package gopub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const linkTestOPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:dc="http://purl.org/dc/elements/1.1/" version="3.0" unique-identifier="uid">
+  <metadata>
+    <dc:identifier id="uid">urn:isbn:9780000000002</dc:identifier>
+    <dc:title id="t1">Linked</dc:title>
+    <dc:language>en</dc:language>
+    <link rel="record" href="meta/onix.xml" media-type="application/xml" properties="onix"/>
+    <link rel="record" href="marc.xml" media-type="application/marcxml+xml"/>
+    <link rel="alternate" href="https://example.org/book" hreflang="en"/>
+    <link rel="voicing" href="audio/title.mp3" media-type="audio/mpeg" refines="#t1"/>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="voice" href="audio/title.mp3" media-type="audio/mpeg"/>
+  </manifest>
+  <spine><itemref idref="ch1"/></spine>
+</package>`
+
+const linkTestONIX = `<?xml version="1.0"?>
+<ONIXMessage xmlns="http://ns.editeur.org/onix/3.0/reference" release="3.0">
+  <Product>
+    <RecordReference>rec-1</RecordReference>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780000000002</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <TitleDetail><TitleType>01</TitleType>
+        <TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>Linked</TitleText><Subtitle>A Test</Subtitle></TitleElement>
+      </TitleDetail>
+      <Contributor><ContributorRole>A01</ContributorRole><PersonName>Jane Doe</PersonName></Contributor>
+      <Language><LanguageRole>01</LanguageRole><LanguageCode>eng</LanguageCode></Language>
+      <Subject><SubjectSchemeIdentifier>10</SubjectSchemeIdentifier><SubjectCode>FIC000000</SubjectCode></Subject>
+    </DescriptiveDetail>
+    <CollateralDetail><TextContent><TextType>03</TextType><Text>About the book.</Text></TextContent></CollateralDetail>
+    <PublishingDetail>
+      <Publisher><PublishingRole>01</PublishingRole><PublisherName>Example Press</PublisherName></Publisher>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date>20200101</Date></PublishingDate>
+    </PublishingDetail>
+  </Product>
+</ONIXMessage>`
+
+const linkTestMARC = `<?xml version="1.0"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+  <record>
+    <controlfield tag="008">200101s2020    nyu           000 1 eng d</controlfield>
+    <datafield tag="020" ind1=" " ind2=" "><subfield code="a">9780000000002 (ebook)</subfield></datafield>
+    <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Doe, Jane,</subfield><subfield code="e">author.</subfield></datafield>
+    <datafield tag="245" ind1="1" ind2="0"><subfield code="a">Linked :</subfield><subfield code="b">a test /</subfield></datafield>
+    <datafield tag="264" ind1=" " ind2="1"><subfield code="b">Example Press,</subfield><subfield code="c">2020.</subfield></datafield>
+    <datafield tag="650" ind1=" " ind2="0"><subfield code="a">Fiction.</subfield></datafield>
+  </record>
+</collection>`
+
+func TestMetadataLinks(t *testing.T) {
+	r := openTestEpub(t, map[string]string{
+		"OEBPS/content.opf":     linkTestOPF,
+		"OEBPS/ch1.xhtml":       "<html/>",
+		"OEBPS/meta/onix.xml":   linkTestONIX,
+		"OEBPS/marc.xml":        linkTestMARC,
+		"OEBPS/audio/title.mp3": "ID3",
+	})
+	md := &r.DefaultRendition().Metadata
+
+	if got := len(md.Links("")); got != 4 {
+		t.Fatalf(expFormat, 4, got)
+	}
+	alt := md.Links("alternate")
+	if len(alt) != 1 || !alt[0].IsRemote() || alt[0].F != nil || alt[0].Hreflang != "en" {
+		t.Errorf("alternate link not parsed as remote: %+v", alt)
+	}
+	voicing := md.Links("voicing")
+	if len(voicing) != 1 || voicing[0].ManifestItem == nil || voicing[0].ManifestItem.ID != "voice" {
+		t.Errorf("voicing link not resolved to manifest item: %+v", voicing)
+	}
+
+	records := md.Records()
+	if len(records) != 2 {
+		t.Fatalf(expFormat, 2, len(records))
+	}
+
+	// ONIX is parsed by package onix, which this package cannot import.
+	if _, err := r.LinkedRecord(records[0]); !errors.Is(err, ErrUnsupportedRecord) || !strings.Contains(err.Error(), "<ONIXMessage>") {
+		t.Errorf(expFormat, ErrUnsupportedRecord, err)
+	}
+
+	marc, err := r.LinkedRecord(records[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marc.Format != RecordMARCXML || marc.Title != "Linked" || marc.Subtitle != "a test" {
+		t.Errorf("marc title: %+v", marc)
+	}
+	if len(marc.Identifiers) != 1 || marc.Identifiers[0].Value != "9780000000002" {
+		t.Errorf("marc identifiers: %+v", marc.Identifiers)
+	}
+	if len(marc.Contributors) != 1 || marc.Contributors[0].Name != "Doe, Jane" {
+		t.Errorf("marc contributors: %+v", marc.Contributors)
+	}
+	if len(marc.Language) != 1 || marc.Language[0] != "eng" {
+		t.Errorf("marc language: %+v", marc.Language)
+	}
+	if marc.Publisher != "Example Press" || marc.PublicationDate != "2020" {
+		t.Errorf("marc publishing: %+v", marc)
+	}
+
+	if _, err := r.LinkedRecord(alt[0]); err != ErrBadLink {
+		t.Errorf(expFormat, ErrBadLink, err)
+	}
+}
@@ -0,0 +1,39 @@
+package gopub
+
+import (
+	"archive/zip"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// lookup returns the ZIP entry named name. With ModeFuzzyPaths, a failed
+// exact match falls back to comparing names case-insensitively, with '\'
+// treated as '/' and in Unicode NFC form, and each such match is warned about.
+func (r *Reader) lookup(name string) *zip.File {
+	if f := r.files[name]; f != nil || r.opts.Mode&ModeFuzzyPaths == 0 {
+		return f
+	}
+	f := r.fuzzyFiles[fuzzyKey(name)]
+	if f != nil {
+		r.warn("epub: %q matched zip entry %q only after normalizing case, separators or Unicode form", name, f.Name)
+	}
+	return f
+}
+
+// fuzzyIndex maps the fuzzyKey of each entry to the first entry with that key.
+func fuzzyIndex(files []*zip.File) map[string]*zip.File {
+	index := make(map[string]*zip.File, len(files))
+	for _, f := range files {
+		key := fuzzyKey(f.Name)
+		if _, dup := index[key]; !dup {
+			index[key] = f
+		}
+	}
+	return index
+}
+
+// fuzzyKey normalizes a path for ModeFuzzyPaths comparison.
+func fuzzyKey(name string) string {
+	return strings.ToLower(norm.NFC.String(strings.ReplaceAll(name, `\`, "/")))
+}
@@ -0,0 +1,52 @@
+package gopub
+
+import (
+	"bytes"
+	"testing"
+)
+
+const fuzzyTestOPF = `<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Fuzzy</dc:title></metadata>
+  <manifest>
+    <item id="ch" href="Text/Chapter.xhtml" media-type="application/xhtml+xml"/>
+    <item id="img" href="Images/cafe%CC%81.png" media-type="image/png"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+  </manifest>
+  <spine toc="ncx"><itemref idref="ch"/></spine>
+</package>`
+
+func TestModeFuzzyPaths(t *testing.T) {
+	data := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf":        fuzzyTestOPF,
+		`OEBPS\text\chapter.XHTML`: "<html/>",
+		"OEBPS/Images/café.png":    "png", // NFC; the href is NFD
+		"OEBPS/toc.ncx":            nestedNavPoints(1),
+	})
+
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range r.DefaultRendition().Manifest.Items[:2] {
+		if item.F != nil {
+			t.Errorf("%s resolved without ModeFuzzyPaths", item.HREF)
+		}
+	}
+
+	r, err = NewReader(bytes.NewReader(data), int64(len(data)), WithMode(ModeFuzzyPaths))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`OEBPS\text\chapter.XHTML`, "OEBPS/Images/café.png"}
+	for i, item := range r.DefaultRendition().Manifest.Items[:2] {
+		if item.F == nil || item.F.Name != want[i] {
+			t.Errorf(expFormat, want[i], item.F)
+		}
+	}
+	if n := len(r.Warnings()); n != 2 {
+		t.Errorf(expFormat, 2, r.Warnings())
+	}
+	if _, err := r.DefaultRendition().Manifest.Items[0].ReadAll(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,377 @@
+// Package markdown converts an EPUB rendition to a single CommonMark
+// document with YAML front matter, GitHub-style tables and footnotes.
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultImageDir is the directory images are linked from when
+// Options.ImageDir is empty.
+const DefaultImageDir = "images"
+
+// Options configures Convert.
+type Options struct {
+	// ImageDir is the directory, relative to the Markdown file, that image
+	// links point into. Defaults to DefaultImageDir.
+	ImageDir string
+}
+
+// Image is an image referenced by the converted document.
+type Image struct {
+	// Path is the image's path relative to the Markdown file, e.g.
+	// "images/cover.jpg".
+	Path string
+	Item *gopub.ManifestItem
+}
+
+// Convert writes the spine of rf to w as one Markdown document and returns
+// the images it links to, which the caller should store at Image.Path.
+// Links between spine documents become links to anchors in the combined
+// document; noterefs (epub:type="noteref") become footnotes.
+func Convert(w io.Writer, rf *gopub.Rootfile, opts *Options) ([]Image, error) {
+	if err := rf.Load(); err != nil {
+		return nil, err
+	}
+	c := newConverter(rf, opts)
+	if err := c.parse(); err != nil {
+		return nil, err
+	}
+	c.scan()
+
+	var b strings.Builder
+	writeFrontMatter(&b, rf)
+	var blocks []string
+	for _, doc := range c.docs {
+		blocks = append(blocks, c.document(doc)...)
+	}
+	if len(blocks) > 0 {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(blocks, "\n\n"))
+		b.WriteString("\n")
+	}
+	for _, n := range c.noteOrder {
+		b.WriteString("\n")
+		b.WriteString(footnote(n))
+		b.WriteString("\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return nil, err
+	}
+	return c.images, nil
+}
+
+// WriteFile converts rf to the Markdown file name and extracts the images
+// it references into Options.ImageDir next to it.
+func WriteFile(name string, rf *gopub.Rootfile, opts *Options) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	images, err := Convert(f, rf, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if err := writeImage(filepath.Join(filepath.Dir(name), filepath.FromSlash(img.Path)), img.Item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeImage(name string, item *gopub.ManifestItem) error {
+	data, err := item.ReadAll()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+// document is a parsed spine document.
+type document struct {
+	path string // ZIP path
+	key  string // anchor for the start of the document
+	root *html.Node
+}
+
+// note is a footnote collected from a noteref target.
+type note struct {
+	label  string
+	blocks []string
+}
+
+type converter struct {
+	rf       *gopub.Rootfile
+	imageDir string
+
+	items   map[string]*gopub.ManifestItem // by ZIP path
+	docs    []*document
+	byPath  map[string]*document
+	ids     map[string]bool // "path#id" of every element with an id
+	targets map[string]bool // link targets: "path" or "path#id"
+
+	noterefs  map[string]string // noteref target "path#id" -> label
+	notes     map[string]*note
+	noteOrder []*note
+	backlinks map[string]bool // "path#id" of noterefs, linked from notes
+
+	images     []Image
+	imageNames map[*gopub.ManifestItem]string
+	usedNames  map[string]bool
+
+	doc     *document // being rendered
+	pending string    // anchors to emit before the next block
+}
+
+func newConverter(rf *gopub.Rootfile, opts *Options) *converter {
+	c := &converter{
+		rf:         rf,
+		imageDir:   DefaultImageDir,
+		items:      make(map[string]*gopub.ManifestItem),
+		byPath:     make(map[string]*document),
+		ids:        make(map[string]bool),
+		targets:    make(map[string]bool),
+		noterefs:   make(map[string]string),
+		notes:      make(map[string]*note),
+		backlinks:  make(map[string]bool),
+		imageNames: make(map[*gopub.ManifestItem]string),
+		usedNames:  make(map[string]bool),
+	}
+	if opts != nil && opts.ImageDir != "" {
+		c.imageDir = strings.TrimSuffix(opts.ImageDir, "/")
+	}
+	for i := range rf.Manifest.Items {
+		if item := &rf.Manifest.Items[i]; item.F != nil {
+			c.items[item.F.Name] = item
+		}
+	}
+	return c
+}
+
+// parse reads every spine document, in spine order.
+func (c *converter) parse() error {
+	keys := make(map[string]bool)
+	for i := range c.rf.Spine.Itemrefs {
+		item := c.rf.Spine.Itemrefs[i].ManifestItem
+		if item == nil || item.F == nil || c.byPath[item.F.Name] != nil {
+			continue
+		}
+		rc, err := item.Open()
+		if err != nil {
+			return err
+		}
+		root, err := xhtml.Parse(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", item.F.Name, err)
+		}
+		base := path.Base(item.F.Name)
+		key := xhtml.UniqueName(keys, xhtml.AnchorName(strings.TrimSuffix(base, path.Ext(base))))
+		doc := &document{path: item.F.Name, key: key, root: root}
+		c.docs = append(c.docs, doc)
+		c.byPath[doc.path] = doc
+	}
+	return nil
+}
+
+// scan records ids, link targets and footnotes before rendering, so that
+// anchors are only emitted where something links to them.
+func (c *converter) scan() {
+	type ref struct{ target, self string }
+	var refs []ref
+	var links []string
+	for _, doc := range c.docs {
+		xhtml.Walk(doc.root, func(n *html.Node) {
+			if id := xhtml.Attr(n, "id"); id != "" {
+				c.ids[doc.path+"#"+id] = true
+			}
+			if n.DataAtom != atom.A {
+				return
+			}
+			target, frag, ok := xhtml.Resolve(doc.path, xhtml.Attr(n, "href"))
+			if !ok || c.byPath[target] == nil {
+				return
+			}
+			key := target
+			if frag != "" {
+				key += "#" + frag
+			}
+			if xhtml.HasType(n, "noteref") && frag != "" {
+				r := ref{target: key}
+				if id := noterefID(n); id != "" {
+					r.self = doc.path + "#" + id
+				}
+				refs = append(refs, r)
+				return
+			}
+			links = append(links, key)
+		})
+	}
+	// Links to missing ids fall back to the start of the document.
+	target := func(key string) {
+		if !c.ids[key] {
+			key, _, _ = strings.Cut(key, "#")
+		}
+		c.targets[key] = true
+	}
+	for _, r := range refs {
+		if !c.ids[r.target] {
+			target(r.target)
+			continue
+		}
+		if _, ok := c.noterefs[r.target]; !ok {
+			n := &note{label: fmt.Sprint(len(c.noteOrder) + 1)}
+			c.noterefs[r.target] = n.label
+			c.notes[r.target] = n
+			c.noteOrder = append(c.noteOrder, n)
+		}
+		if r.self != "" {
+			c.backlinks[r.self] = true
+		}
+	}
+	for _, key := range links {
+		if !c.backlinks[key] {
+			target(key)
+		}
+	}
+}
+
+// noterefID returns the id a footnote's backlink would point to: that of
+// the noteref itself or of an enclosing sup.
+func noterefID(n *html.Node) string {
+	if id := xhtml.Attr(n, "id"); id != "" {
+		return id
+	}
+	if p := n.Parent; p != nil && p.DataAtom == atom.Sup {
+		return xhtml.Attr(p, "id")
+	}
+	return ""
+}
+
+// document renders the body of doc as Markdown blocks.
+func (c *converter) document(doc *document) []string {
+	c.doc = doc
+	c.pending = ""
+	if c.targets[doc.path] {
+		c.pending = anchor(doc.key)
+	}
+	body := xhtml.Find(doc.root, atom.Body)
+	if body == nil {
+		body = doc.root
+	}
+	blocks := c.blocks(body)
+	if c.pending != "" {
+		blocks = append(blocks, c.pending)
+		c.pending = ""
+	}
+	return blocks
+}
+
+// anchorFor returns the anchor name for id in the current document.
+func (c *converter) anchorFor(docPath, id string) string {
+	doc := c.byPath[docPath]
+	if id == "" {
+		return doc.key
+	}
+	return doc.key + "-" + xhtml.AnchorName(id)
+}
+
+// image returns the Markdown path of the image at the ZIP path target,
+// registering it for extraction.
+func (c *converter) image(target string) (string, bool) {
+	item := c.items[target]
+	if item == nil {
+		return "", false
+	}
+	if name, ok := c.imageNames[item]; ok {
+		return name, true
+	}
+	base := path.Base(target)
+	ext := path.Ext(base)
+	name := c.imageDir + "/" + xhtml.UniqueName(c.usedNames, strings.TrimSuffix(base, ext)) + ext
+	c.imageNames[item] = name
+	c.images = append(c.images, Image{Path: name, Item: item})
+	return name, true
+}
+
+func anchor(name string) string {
+	return `<a id="` + name + `"></a>`
+}
+
+// footnote formats n as a footnote definition.
+func footnote(n *note) string {
+	body := strings.Join(n.blocks, "\n\n")
+	return "[^" + n.label + "]: " + indent(body, "    ")
+}
+
+// writeFrontMatter writes the metadata of rf as a YAML front matter block.
+// Strings are written as JSON, which is valid YAML.
+func writeFrontMatter(b *strings.Builder, rf *gopub.Rootfile) {
+	md := &rf.Metadata
+	b.WriteString("---\n")
+	scalar := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(b, "%s: %s\n", key, quote(value))
+		}
+	}
+	list := func(key string, values []string) {
+		if len(values) > 0 {
+			fmt.Fprintf(b, "%s:\n", key)
+			for _, v := range values {
+				fmt.Fprintf(b, "  - %s\n", quote(v))
+			}
+		}
+	}
+
+	scalar("title", md.MainTitle().Name)
+	var authors []string
+	for _, c := range md.Creator {
+		authors = append(authors, c.Name)
+	}
+	list("author", authors)
+	scalar("language", md.PrimaryLanguage())
+	// The package's unique identifier, or the first one if none is named.
+	uid := ""
+	for _, id := range md.Identifier {
+		if uid == "" || (id.ID != "" && id.ID == rf.UniqueIdentifier) {
+			uid = id.Value
+		}
+	}
+	scalar("identifier", uid)
+	scalar("publisher", md.PrimaryPublisher().Name)
+	if len(md.Event) > 0 {
+		scalar("date", md.Event[0].Date)
+	}
+	scalar("description", md.Description)
+	list("subject", md.Subject)
+	scalar("series", md.Series)
+	scalar("series_index", md.SeriesIndex)
+	scalar("modified", md.Modified)
+	b.WriteString("---\n")
+}
+
+func quote(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(strings.TrimSpace(s))
+	return strings.TrimSuffix(b.String(), "\n")
+}
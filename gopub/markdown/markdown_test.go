@@ -0,0 +1,102 @@
+package markdown
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/epubtest"
+)
+
+const testOPF = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Sample &amp; Co</dc:title>
+    <dc:creator>Ann Author</dc:creator>
+    <dc:identifier id="isbn">urn:isbn:9780000000002</dc:identifier>
+    <dc:identifier id="uid">urn:uuid:1</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="one" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="pic" href="img/pic.png" media-type="image/png"/>
+  </manifest>
+  <spine><itemref idref="one"/><itemref idref="two"/></spine>
+</package>`
+
+const chapterOne = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+<h1>Chapter <em>One</em></h1>
+<p>Some <b>bold</b> and <i>italic</i> text with a * star<a epub:type="noteref" id="r1" href="two.xhtml#n1">1</a>.<a id="p1"/></p>
+<p>See <a href="two.xhtml#later">later</a>, <a href="two.xhtml">the next chapter</a> and <a href="https://example.com/">the web</a>.</p>
+<ul><li>first</li><li>second<ol><li>nested</li></ol></li></ul>
+<blockquote><p>Quoted</p></blockquote>
+<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>x|y</td></tr></table>
+<p><img src="../img/pic.png" alt="A picture"/></p>
+<pre>code  here</pre>
+</body></html>`
+
+const chapterTwo = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+<h2 id="later">Later</h2>
+<p>Back to <a href="one.xhtml#nowhere">the start</a>.</p>
+<aside epub:type="footnote" id="n1"><p><a href="one.xhtml#r1">1.</a> The note.</p></aside>
+</body></html>`
+
+func testRendition(t *testing.T) *gopub.Rootfile {
+	return epubtest.Rendition(t, map[string]string{
+		"OEBPS/content.opf":    testOPF,
+		"OEBPS/text/one.xhtml": chapterOne,
+		"OEBPS/text/two.xhtml": chapterTwo,
+		"OEBPS/img/pic.png":    "png",
+	})
+}
+
+func TestConvert(t *testing.T) {
+	var out strings.Builder
+	images, err := Convert(&out, testRendition(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := out.String()
+	for _, want := range []string{
+		"---\ntitle: \"Sample & Co\"\nauthor:\n  - \"Ann Author\"\nlanguage: \"en\"\nidentifier: \"urn:uuid:1\"\n---\n",
+		"# <a id=\"one\"></a>Chapter *One*\n",
+		`Some **bold** and *italic* text with a \* star[^1].`,
+		"See [later](#two-later), [the next chapter](#two) and [the web](https://example.com/).",
+		"- first\n- second\n  1. nested",
+		"> Quoted",
+		"| A | B |\n| --- | --- |\n| 1 | x\\|y |",
+		"![A picture](images/pic.png)",
+		"```\ncode  here\n```",
+		`## <a id="two"></a><a id="two-later"></a>Later`,
+		"Back to [the start](#one).",
+		"[^1]: The note.\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("output missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "n1") || strings.Contains(md, "r1") {
+		t.Errorf("footnote or backlink left in body:\n%s", md)
+	}
+	if len(images) != 1 || images[0].Path != "images/pic.png" || images[0].Item.ID != "pic" {
+		t.Errorf("unexpected images %+v", images)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "book.md")
+	if err := WriteFile(name, testRendition(t), &Options{ImageDir: "assets"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "assets", "pic.png")); err != nil || string(data) != "png" {
+		t.Errorf("image not extracted: %v", err)
+	}
+	md, _ := os.ReadFile(name)
+	if !strings.Contains(string(md), "(assets/pic.png)") {
+		t.Errorf("image link not rewritten:\n%s", md)
+	}
+}
@@ -0,0 +1,483 @@
+package markdown
+
+import (
+	"fmt"
+	"iter"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockElements are rendered as Markdown blocks; everything else is inline.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Aside: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Main: true, atom.Body: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true, atom.Pre: true,
+	atom.Table: true, atom.Hr: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Address: true, atom.Hgroup: true,
+}
+
+// skipped elements produce no output.
+var skipped = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Title: true, atom.Template: true,
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && blockElements[n.DataAtom]
+}
+
+// blocks renders the children of n, collecting runs of inline content into
+// paragraphs.
+func (c *converter) blocks(n *html.Node) []string {
+	var out []string
+	var para strings.Builder
+	flush := func() {
+		if p := paragraph(para.String()); p != "" {
+			out = append(out, c.takePending()+p)
+		}
+		para.Reset()
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if isBlock(ch) {
+			flush()
+			out = append(out, c.block(ch)...)
+		} else {
+			para.WriteString(c.inline(ch))
+		}
+	}
+	flush()
+	return out
+}
+
+func (c *converter) takePending() string {
+	p := c.pending
+	c.pending = ""
+	return p
+}
+
+// captured reports whether n is a footnote body, rendering it into its
+// note instead of the document.
+func (c *converter) captured(n *html.Node) bool {
+	id := xhtml.Attr(n, "id")
+	if id == "" {
+		return false
+	}
+	note := c.notes[c.doc.path+"#"+id]
+	if note == nil {
+		return false
+	}
+	pending := c.pending
+	c.pending = ""
+	if isBlock(n) {
+		note.blocks = c.blocks(n)
+	} else if p := paragraph(c.inlineChildren(n)); p != "" {
+		note.blocks = []string{p}
+	}
+	c.pending = pending
+	return true
+}
+
+// markTarget queues an anchor for n's id if something links to it.
+func (c *converter) markTarget(n *html.Node) {
+	if id := xhtml.Attr(n, "id"); id != "" && c.targets[c.doc.path+"#"+id] {
+		c.pending += anchor(c.anchorFor(c.doc.path, id))
+	}
+}
+
+func (c *converter) block(n *html.Node) []string {
+	if skipped[n.DataAtom] || c.captured(n) {
+		return nil
+	}
+	c.markTarget(n)
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := strings.ReplaceAll(paragraph(c.inlineChildren(n)), "\\\n", " ")
+		if text == "" {
+			return nil
+		}
+		level := int(n.Data[1] - '0')
+		return []string{strings.Repeat("#", level) + " " + c.takePending() + text}
+	case atom.Hr:
+		return []string{"* * *"}
+	case atom.Pre:
+		return append(c.pendingBlock(), fence(textContent(n)))
+	case atom.Blockquote:
+		inner := strings.Join(c.blocks(n), "\n\n")
+		if inner == "" {
+			return nil
+		}
+		lines := strings.Split(inner, "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight("> "+l, " ")
+		}
+		return []string{strings.Join(lines, "\n")}
+	case atom.Ul, atom.Ol:
+		return c.list(n)
+	case atom.Table:
+		return c.table(n)
+	case atom.Dt:
+		if p := paragraph(c.inlineChildren(n)); p != "" {
+			return []string{c.takePending() + "**" + p + "**"}
+		}
+		return nil
+	}
+	return c.blocks(n)
+}
+
+func (c *converter) list(n *html.Node) []string {
+	ordered := n.DataAtom == atom.Ol
+	num := 1
+	if start, err := strconv.Atoi(xhtml.Attr(n, "start")); err == nil && ordered {
+		num = start
+	}
+	var items []string
+	loose := false
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || c.captured(li) {
+			continue
+		}
+		c.markTarget(li)
+		var content []string
+		if li.DataAtom == atom.Li {
+			content = c.blocks(li)
+		} else {
+			content = c.block(li)
+		}
+		// Nested lists keep an item tight; further paragraphs make the list loose.
+		var body strings.Builder
+		for j, b := range content {
+			if j > 0 {
+				if isList(b) {
+					body.WriteString("\n")
+				} else {
+					body.WriteString("\n\n")
+					loose = true
+				}
+			}
+			body.WriteString(b)
+		}
+		marker := "- "
+		if ordered {
+			marker = fmt.Sprintf("%d. ", num)
+			num++
+		}
+		items = append(items, marker+indent(body.String(), strings.Repeat(" ", len(marker))))
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	sep := "\n"
+	if loose {
+		sep = "\n\n"
+	}
+	return []string{strings.Join(items, sep)}
+}
+
+var listMarker = regexp.MustCompile(`^(- |\d+\. )`)
+
+// isList reports whether the Markdown block b is a list.
+func isList(b string) bool {
+	return listMarker.MatchString(b)
+}
+
+func (c *converter) table(n *html.Node) []string {
+	var caption string
+	var rows [][]string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			switch ch.DataAtom {
+			case atom.Caption:
+				caption = paragraph(c.inlineChildren(ch))
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				collect(ch)
+			case atom.Tr:
+				var row []string
+				for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						text := strings.ReplaceAll(paragraph(c.inlineChildren(cell)), "\\\n", " ")
+						row = append(row, strings.ReplaceAll(strings.ReplaceAll(text, "\n", " "), "|", `\|`))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	collect(n)
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	if cols == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	for i, row := range rows {
+		b.WriteString("|")
+		for j := range cols {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		if i == 0 {
+			b.WriteString("\n|" + strings.Repeat(" --- |", cols))
+		}
+		if i < len(rows)-1 {
+			b.WriteString("\n")
+		}
+	}
+	out := c.pendingBlock()
+	if caption != "" {
+		out = append(out, caption)
+	}
+	return append(out, b.String())
+}
+
+// pendingBlock returns the queued anchors as a block of their own, for
+// blocks that cannot start with inline HTML.
+func (c *converter) pendingBlock() []string {
+	if p := c.takePending(); p != "" {
+		return []string{p}
+	}
+	return nil
+}
+
+func (c *converter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(c.inline(ch))
+	}
+	return b.String()
+}
+
+func (c *converter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return escape(collapse(n.Data))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if skipped[n.DataAtom] || c.captured(n) {
+		return ""
+	}
+	prefix := ""
+	if id := xhtml.Attr(n, "id"); id != "" && c.targets[c.doc.path+"#"+id] && n.DataAtom != atom.A {
+		prefix = anchor(c.anchorFor(c.doc.path, id))
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		return "\\\n"
+	case atom.Em, atom.I, atom.Cite, atom.Dfn, atom.Var:
+		return prefix + wrap(c.inlineChildren(n), "*")
+	case atom.Strong, atom.B:
+		return prefix + wrap(c.inlineChildren(n), "**")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		return prefix + codeSpan(textContent(n))
+	case atom.A:
+		return c.link(n)
+	case atom.Img:
+		return prefix + c.imageRef(xhtml.Attr(n, "src"), xhtml.Attr(n, "alt"))
+	case atom.Svg:
+		for img := range imagesIn(n) {
+			href := xhtml.Attr(img, "xlink:href")
+			if href == "" {
+				href = xhtml.Attr(img, "href")
+			}
+			return prefix + c.imageRef(href, "")
+		}
+		return prefix
+	}
+	text := c.inlineChildren(n)
+	if isBlock(n) {
+		text = " " + text + " "
+	}
+	return prefix + text
+}
+
+// imagesIn yields the <image> elements inside an SVG element.
+func imagesIn(n *html.Node) iter.Seq[*html.Node] {
+	return func(yield func(*html.Node) bool) {
+		var visit func(*html.Node) bool
+		visit = func(n *html.Node) bool {
+			for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+				if ch.Type == html.ElementNode && ch.Data == "image" && !yield(ch) {
+					return false
+				}
+				if !visit(ch) {
+					return false
+				}
+			}
+			return true
+		}
+		visit(n)
+	}
+}
+
+func (c *converter) link(n *html.Node) string {
+	id := xhtml.Attr(n, "id")
+	prefix := ""
+	if id != "" && c.targets[c.doc.path+"#"+id] {
+		prefix = anchor(c.anchorFor(c.doc.path, id))
+	}
+	text := c.inlineChildren(n)
+	href := xhtml.Attr(n, "href")
+	if href == "" {
+		return prefix + text
+	}
+	target, frag, internal := xhtml.Resolve(c.doc.path, href)
+	if !internal {
+		if _, err := url.Parse(href); err != nil {
+			return prefix + text
+		}
+		return prefix + "[" + text + "](" + destination(href) + ")"
+	}
+	key := target
+	if frag != "" {
+		key += "#" + frag
+	}
+	if label, ok := c.noterefs[key]; ok && xhtml.HasType(n, "noteref") {
+		return prefix + "[^" + label + "]"
+	}
+	if c.backlinks[key] {
+		return prefix
+	}
+	if c.byPath[target] != nil {
+		if frag != "" && !c.ids[key] {
+			frag = ""
+		}
+		return prefix + "[" + text + "](#" + c.anchorFor(target, frag) + ")"
+	}
+	if name, ok := c.image(target); ok {
+		return prefix + "[" + text + "](" + destination(name) + ")"
+	}
+	return prefix + text
+}
+
+func (c *converter) imageRef(src, alt string) string {
+	target, _, ok := xhtml.Resolve(c.doc.path, src)
+	if ok {
+		if name, found := c.image(target); found {
+			src = name
+		}
+	}
+	if src == "" {
+		return ""
+	}
+	return "![" + escape(collapse(alt)) + "](" + destination(src) + ")"
+}
+
+// destination formats a link destination, escaping spaces and parentheses.
+func destination(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme == "" && u.Host == "" {
+		s = (&url.URL{Path: u.Path, Fragment: u.Fragment}).String()
+	}
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(s)
+}
+
+// wrap surrounds the trimmed text with delim, keeping outer spaces outside.
+func wrap(text, delim string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + delim + trimmed + delim + trail
+}
+
+func codeSpan(s string) string {
+	s = collapse(s)
+	delim := "`"
+	for strings.Contains(s, delim) {
+		delim += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return delim + s + delim
+}
+
+func fence(s string) string {
+	s = strings.Trim(s, "\n")
+	delim := "```"
+	for strings.Contains(s, delim) {
+		delim += "`"
+	}
+	return delim + "\n" + s + "\n" + delim
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.DataAtom == atom.Br {
+			b.WriteString("\n")
+		}
+		b.WriteString(textContent(ch))
+	}
+	return b.String()
+}
+
+var spaces = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+func collapse(s string) string {
+	return spaces.ReplaceAllString(s, " ")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`, `*`, `\*`, `_`, `\_`, "`", "\\`", `[`, `\[`, `]`, `\]`, `<`, `\<`,
+)
+
+var entityLike = regexp.MustCompile(`&([A-Za-z0-9#])`)
+
+func escape(s string) string {
+	return entityLike.ReplaceAllString(textEscaper.Replace(s), `\&$1`)
+}
+
+var orderedMarker = regexp.MustCompile(`^(\d+)([.)])`)
+
+// paragraph tidies inline Markdown into a paragraph: it trims each line,
+// drops empty ones and escapes characters that would start a block.
+func paragraph(s string) string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.Join(strings.Fields(l), " ")
+		if l == "" || l == `\` {
+			continue
+		}
+		if strings.ContainsRune("#>+-=", rune(l[0])) {
+			l = `\` + l
+		} else {
+			l = orderedMarker.ReplaceAllString(l, `$1\$2`)
+		}
+		lines = append(lines, l)
+	}
+	if n := len(lines); n > 0 && strings.HasSuffix(lines[n-1], `\`) && !strings.HasSuffix(lines[n-1], `\\`) {
+		lines[n-1] = strings.TrimSuffix(lines[n-1], `\`)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indent prefixes every line after the first with prefix, leaving blank
+// lines empty.
+func indent(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" && i > 0 {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
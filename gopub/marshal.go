@@ -0,0 +1,593 @@
+package gopub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XML namespaces used when writing package and navigation documents.
+const (
+	nsOPF   = "http://www.idpf.org/2007/opf"
+	nsDC    = "http://purl.org/dc/elements/1.1/"
+	nsXHTML = "http://www.w3.org/1999/xhtml"
+	nsOPS   = "http://www.idpf.org/2007/ops"
+	nsNCX   = "http://www.daisy.org/z3986/2005/ncx/"
+)
+
+// epub3Prefixes are the reserved EPUB 3 metadata prefixes. OtherTags keys
+// using them, or naming a term of the default vocabulary, are written as
+// property metas; every other key is written as a name/content meta.
+var epub3Prefixes = []string{"a11y:", "dcterms:", "marc:", "media:", "onix:", "rendition:", "schema:", "xsd:"}
+
+var epub3MetaTerms = map[string]bool{
+	"alternate-script": true, "authority": true, "belongs-to-collection": true,
+	"collection-type": true, "display-seq": true, "file-as": true,
+	"group-position": true, "identifier-type": true, "meta-auth": true,
+	"role": true, "source-of": true, "term": true, "title-type": true,
+}
+
+// IsEPUB2 reports whether the package declares an EPUB 2 version.
+func (p *Package) IsEPUB2() bool {
+	return strings.HasPrefix(p.Version, "2")
+}
+
+// WritePackage writes rf's package document to w. The output follows
+// Package.Version: EPUB 3 packages express file-as, role, display-seq and
+// title-type through refining metas, keep Metadata.Refinements of the
+// elements written and carry manifest, spine and link properties, while
+// EPUB 2 packages use opf: attributes and calibre series metas instead.
+// An EPUB 3 package with an empty Metadata.Modified is stamped with the
+// current time.
+func (rf *Rootfile) WritePackage(w io.Writer) error {
+	if err := rf.Load(); err != nil {
+		return err
+	}
+	p := &rf.Package
+	epub2 := p.IsEPUB2()
+	x := &xmlWriter{}
+	x.header()
+
+	uid := p.UniqueIdentifier
+	if uid == "" {
+		uid = "uid"
+	}
+	x.start("package", "xmlns", nsOPF, "version", orDefault(p.Version, "3.0"), "unique-identifier", uid)
+	if epub2 {
+		x.start("metadata", "xmlns:dc", nsDC, "xmlns:opf", nsOPF)
+	} else {
+		x.start("metadata", "xmlns:dc", nsDC)
+	}
+	m := &metadataWriter{x: x, md: &p.Metadata, epub2: epub2, ids: make(map[string]bool)}
+	m.reserveIDs()
+	m.identifiers(uid)
+	m.write()
+	x.end("metadata")
+
+	x.start("manifest")
+	for _, item := range p.Manifest.Items {
+		props := item.Properties
+		if epub2 {
+			props = ""
+		}
+		x.elem("item", "", "id", item.ID, "href", item.HREF, "media-type", item.MediaType, "properties", props)
+	}
+	x.end("manifest")
+
+	spine := []string{"toc", p.Spine.Toc}
+	if !epub2 {
+		spine = append(spine, "page-progression-direction", p.Spine.PPD)
+	}
+	x.start("spine", spine...)
+	for _, ref := range p.Spine.Itemrefs {
+		props := ref.SpineProperties
+		if epub2 {
+			props = ""
+		}
+		x.elem("itemref", "", "idref", ref.IDREF, "id", ref.SpineID, "linear", ref.Linear, "properties", props)
+	}
+	x.end("spine")
+
+	if len(p.Guide.References) > 0 {
+		x.start("guide")
+		for _, ref := range p.Guide.References {
+			x.elem("reference", "", "type", ref.Type, "title", ref.Title, "href", ref.Href)
+		}
+		x.end("guide")
+	}
+	x.end("package")
+	return x.flush(w)
+}
+
+// metadataWriter writes the <metadata> children of a package document.
+type metadataWriter struct {
+	x     *xmlWriter
+	md    *Metadata
+	epub2 bool
+	ids   map[string]bool // element ids in use
+	// renamed maps the id of an identifier given the unique identifier's
+	// id to that id.
+	renamed map[string]string
+}
+
+func (m *metadataWriter) reserveIDs() {
+	for _, id := range m.md.Identifier {
+		m.ids[id.ID] = true
+	}
+	for _, t := range m.md.Title {
+		m.ids[t.ID] = true
+	}
+	for _, c := range slices.Concat(m.md.Creator, m.md.Contributor) {
+		m.ids[c.ID] = true
+	}
+	for _, p := range m.md.Publisher {
+		m.ids[p.ID] = true
+	}
+	for _, l := range m.md.Link {
+		m.ids[l.ID] = true
+	}
+	for _, r := range m.md.Refinements {
+		m.ids[r.ID] = true
+	}
+}
+
+// lang returns the xml:lang and dir attributes of r; dir is EPUB 3 only.
+func (m *metadataWriter) lang(r Refinable) []string {
+	dir := r.Dir
+	if m.epub2 {
+		dir = ""
+	}
+	return []string{"xml:lang", r.Lang, "dir", dir}
+}
+
+// id returns id, or a new unique id starting with prefix if it is empty.
+func (m *metadataWriter) id(id, prefix string) string {
+	if id != "" {
+		return id
+	}
+	for i := 1; ; i++ {
+		if id = prefix + strconv.Itoa(i); !m.ids[id] {
+			m.ids[id] = true
+			return id
+		}
+	}
+}
+
+// refine writes an EPUB 3 refinement of the element with the given id.
+func (m *metadataWriter) refine(id, property, value string, attrs ...string) {
+	if value != "" {
+		m.x.elem("meta", value, append([]string{"refines", "#" + id, "property", property}, attrs...)...)
+	}
+}
+
+// identifiers writes the dc:identifier elements, giving the first one the
+// unique identifier's id if none carries it. EPUB 3 packages express a
+// scheme that the value's URN does not as an identifier-type refinement.
+func (m *metadataWriter) identifiers(uid string) {
+	m.ids[uid] = true
+	ids := slices.Clone(m.md.Identifier)
+	if len(ids) > 0 && !slices.ContainsFunc(ids, func(id Identifier) bool { return id.ID == uid }) {
+		m.renamed = map[string]string{ids[0].ID: uid}
+		ids[0].ID = uid
+	}
+	for _, id := range ids {
+		if m.epub2 {
+			m.x.elem("dc:identifier", id.Value, "id", id.ID, "opf:scheme", id.Scheme)
+			continue
+		}
+		scheme := strings.TrimSpace(id.Scheme)
+		urn := identifierURNs[strings.ToLower(scheme)]
+		if scheme == "" || urn != "" && strings.HasPrefix(strings.ToLower(id.Value), urn) || m.refined(id.ID, "identifier-type") {
+			m.x.elem("dc:identifier", id.Value, "id", id.ID)
+			continue
+		}
+		eid := m.id(id.ID, "identifier-")
+		m.x.elem("dc:identifier", id.Value, "id", eid)
+		m.refine(eid, "identifier-type", scheme)
+	}
+}
+
+// refined reports whether Metadata.Refinements refines the element id with
+// property.
+func (m *metadataWriter) refined(id, property string) bool {
+	return id != "" && slices.ContainsFunc(m.md.Refinements, func(r MetaTag) bool {
+		return strings.TrimPrefix(r.Refines, "#") == id && r.Property == property
+	})
+}
+
+func (m *metadataWriter) write() {
+	md, x := m.md, m.x
+	for _, t := range md.Title {
+		if m.epub2 || t.FileAs == "" && t.TitleType == "" {
+			x.elem("dc:title", t.Name, append([]string{"id", t.ID}, m.lang(t.Refinable)...)...)
+			continue
+		}
+		id := m.id(t.ID, "title-")
+		x.elem("dc:title", t.Name, append([]string{"id", id}, m.lang(t.Refinable)...)...)
+		m.refine(id, "title-type", t.TitleType)
+		m.refine(id, "file-as", t.FileAs)
+	}
+	for _, lang := range md.Language {
+		x.elem("dc:language", lang)
+	}
+	m.creators("dc:creator", "creator-", md.Creator)
+	m.creators("dc:contributor", "contributor-", md.Contributor)
+	for _, p := range md.Publisher {
+		if m.epub2 || p.FileAs == "" {
+			x.elem("dc:publisher", p.Name, append([]string{"id", p.ID}, m.lang(p)...)...)
+			continue
+		}
+		id := m.id(p.ID, "publisher-")
+		x.elem("dc:publisher", p.Name, append([]string{"id", id}, m.lang(p)...)...)
+		m.refine(id, "file-as", p.FileAs)
+	}
+	for _, s := range md.Subject {
+		x.elem("dc:subject", s)
+	}
+	x.elem("dc:description", md.Description)
+	m.dates()
+	x.elem("dc:type", md.Type)
+	x.elem("dc:format", md.Format)
+	x.elem("dc:source", md.Source)
+	for _, r := range md.Relation {
+		x.elem("dc:relation", r)
+	}
+	x.elem("dc:coverage", md.Coverage)
+	for _, r := range md.Rights {
+		x.elem("dc:rights", r)
+	}
+	m.metas()
+	if !m.epub2 {
+		m.refinements()
+		for _, l := range md.Link {
+			x.elem("link", "", "id", l.ID, "rel", l.Rel, "href", l.HREF, "media-type", l.MediaType,
+				"properties", l.Properties, "hreflang", l.Hreflang, "refines", l.Refines)
+		}
+	}
+}
+
+func (m *metadataWriter) creators(name, prefix string, creators []Creator) {
+	for _, c := range creators {
+		if m.epub2 {
+			m.x.elem(name, c.Name, append([]string{"id", c.ID, "opf:role", c.CreatorRole, "opf:file-as", c.FileAs},
+				m.lang(c.Refinable)...)...)
+			continue
+		}
+		if c.FileAs == "" && c.CreatorRole == "" && c.DisplaySeq == "" {
+			m.x.elem(name, c.Name, append([]string{"id", c.ID}, m.lang(c.Refinable)...)...)
+			continue
+		}
+		id := m.id(c.ID, prefix)
+		m.x.elem(name, c.Name, append([]string{"id", id}, m.lang(c.Refinable)...)...)
+		m.refine(id, "role", c.CreatorRole, "scheme", "marc:relators")
+		m.refine(id, "file-as", c.FileAs)
+		m.refine(id, "display-seq", c.DisplaySeq)
+	}
+}
+
+// dates writes the dc:date elements. EPUB 3 allows a single, publication
+// date, so only the first date without an event or with the publication
+// event is kept; events with a DCMI term in eventTerms become dcterms:
+// metas unless OtherTags has that term, and other events, including
+// modification, which is Modified, are dropped.
+func (m *metadataWriter) dates() {
+	published := false
+	for _, d := range m.md.Event {
+		switch {
+		case m.epub2:
+			m.x.elem("dc:date", d.Date, "opf:event", d.Name)
+		case d.Name == "" || d.Name == "publication":
+			if !published {
+				m.x.elem("dc:date", d.Date)
+				published = true
+			}
+		default:
+			term, ok := eventTerms[d.Name]
+			if ok && m.md.OtherTags[term] == nil {
+				m.x.elem("meta", d.Date, "property", term)
+			}
+		}
+	}
+}
+
+// eventTerms maps opf:event values to the DCMI terms of EPUB 3 metas.
+var eventTerms = map[string]string{
+	"creation":  "dcterms:created",
+	"copyright": "dcterms:dateCopyrighted",
+	"accepted":  "dcterms:dateAccepted",
+	"submitted": "dcterms:dateSubmitted",
+	"available": "dcterms:available",
+	"issued":    "dcterms:issued",
+	"valid":     "dcterms:valid",
+}
+
+// metas writes the cover, series, writing mode, modification date and
+// OtherTags as meta elements.
+func (m *metadataWriter) metas() {
+	md, x := m.md, m.x
+	if md.CoverManifestId != "" {
+		x.elem("meta", "", "name", "cover", "content", md.CoverManifestId)
+	}
+	if m.epub2 {
+		for _, mode := range md.PrimaryWritingMode {
+			x.elem("meta", "", "name", "primary-writing-mode", "content", mode)
+		}
+		if md.Series != "" && md.OtherTags["calibre:series"] == nil {
+			x.elem("meta", "", "name", "calibre:series", "content", md.Series)
+			if md.SeriesIndex != "" && md.OtherTags["calibre:series_index"] == nil {
+				x.elem("meta", "", "name", "calibre:series_index", "content", md.SeriesIndex)
+			}
+		}
+	} else {
+		modified := md.Modified
+		if modified == "" {
+			modified = time.Now().UTC().Format(time.RFC3339)
+		}
+		x.elem("meta", modified, "property", "dcterms:modified")
+		for _, mode := range md.PrimaryWritingMode {
+			x.elem("meta", mode, "property", "primary-writing-mode")
+		}
+		if md.Series != "" {
+			id := m.id("", "collection-")
+			x.elem("meta", md.Series, "property", "belongs-to-collection", "id", id)
+			m.refine(id, "collection-type", "series")
+			m.refine(id, "group-position", md.SeriesIndex)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(md.OtherTags)) {
+		property := !m.epub2 && isEPUB3Property(key)
+		for _, v := range md.OtherTags[key] {
+			if property {
+				x.elem("meta", v, "property", key)
+			} else {
+				x.elem("meta", "", "name", key, "content", v)
+			}
+		}
+	}
+}
+
+// refinements writes Metadata.Refinements, dropping those of elements
+// that were not written.
+func (m *metadataWriter) refinements() {
+	for _, r := range m.md.Refinements {
+		id := strings.TrimPrefix(r.Refines, "#")
+		if renamed, ok := m.renamed[id]; ok {
+			id = renamed
+		}
+		if id == "" || !m.ids[id] {
+			continue
+		}
+		m.x.elem("meta", r.InnerXML, "id", r.ID, "refines", "#"+id, "property", r.Property,
+			"scheme", r.Scheme, "xml:lang", r.Lang, "dir", r.Dir)
+	}
+}
+
+func isEPUB3Property(key string) bool {
+	if epub3MetaTerms[key] {
+		return true
+	}
+	for _, prefix := range epub3Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteNav writes rf.NavDoc to w as an EPUB 3 navigation document. Links
+// are written as they are, so they must be relative to where the document
+// is stored. Landmarks and page lists are hidden; entries without an href
+// become spans.
+func (rf *Rootfile) WriteNav(w io.Writer) error {
+	if err := rf.Load(); err != nil {
+		return err
+	}
+	x := &xmlWriter{}
+	x.header()
+	x.b.WriteString("<!DOCTYPE html>\n")
+	lang := rf.Metadata.PrimaryLanguage()
+	x.start("html", "xmlns", nsXHTML, "xmlns:epub", nsOPS, "lang", lang, "xml:lang", lang)
+	x.start("head")
+	x.elem("title", orDefault(rf.Metadata.MainTitle().Name, "Contents"))
+	x.end("head")
+	x.start("body")
+	for _, nav := range rf.NavDoc.Navs {
+		hidden := ""
+		if nav.Type == "landmarks" || nav.Type == "page-list" {
+			hidden = "hidden"
+		}
+		x.start("nav", "epub:type", nav.Type, "id", nav.Type, "hidden", hidden)
+		x.elem("h1", navHeading(nav.Type))
+		writeNavItems(x, nav.Items)
+		x.end("nav")
+	}
+	x.end("body")
+	x.end("html")
+	return x.flush(w)
+}
+
+func navHeading(typ string) string {
+	switch typ {
+	case "toc":
+		return "Contents"
+	case "landmarks":
+		return "Landmarks"
+	case "page-list":
+		return "Pages"
+	}
+	return typ
+}
+
+func writeNavItems(x *xmlWriter, items []NavItem) {
+	x.start("ol")
+	for _, item := range items {
+		x.start("li")
+		if item.Link.Href == "" {
+			x.elem("span", item.Link.Text)
+		} else {
+			x.elem("a", item.Link.Text, "href", item.Link.Href, "epub:type", item.Link.Type)
+		}
+		if len(item.SubItems) > 0 {
+			writeNavItems(x, item.SubItems)
+		}
+		x.end("li")
+	}
+	x.end("ol")
+}
+
+// WriteNCX writes rf.NCX to w as an EPUB 2 NCX document. Play order is
+// kept if every navPoint has one, and otherwise renumbered in document
+// order, with navPoints pointing at the same location sharing a number.
+// Missing navPoint ids are generated. The document title defaults to the
+// main title.
+func (rf *Rootfile) WriteNCX(w io.Writer) error {
+	if err := rf.Load(); err != nil {
+		return err
+	}
+	depth := 0
+	ids := make(map[string]bool)
+	keepOrder := len(rf.NCX.NavPoints) > 0
+	for pos, np := range rf.NCX.Walk() {
+		depth = max(depth, pos.Depth+1)
+		ids[np.ID] = true
+		keepOrder = keepOrder && np.PlayOrder > 0
+	}
+	uid := ""
+	for _, id := range rf.Metadata.Identifier {
+		if uid == "" || id.ID == rf.UniqueIdentifier {
+			uid = id.Value
+		}
+	}
+
+	x := &xmlWriter{}
+	x.header()
+	x.start("ncx", "xmlns", nsNCX, "version", "2005-1", "xml:lang", rf.Metadata.PrimaryLanguage())
+	x.start("head")
+	x.elem("meta", "", "name", "dtb:uid", "content", uid)
+	x.elem("meta", "", "name", "dtb:depth", "content", strconv.Itoa(max(depth, 1)))
+	x.elem("meta", "", "name", "dtb:totalPageCount", "content", "0")
+	x.elem("meta", "", "name", "dtb:maxPageNumber", "content", "0")
+	x.end("head")
+	x.start("docTitle")
+	x.elem("text", orDefault(rf.NCX.DocTitle, rf.Metadata.MainTitle().Name))
+	x.end("docTitle")
+	x.start("navMap")
+	n := &ncxWriter{x: x, ids: ids, keepOrder: keepOrder, order: make(map[string]int)}
+	n.points(rf.NCX.NavPoints)
+	x.end("navMap")
+	x.end("ncx")
+	return x.flush(w)
+}
+
+type ncxWriter struct {
+	x         *xmlWriter
+	ids       map[string]bool
+	keepOrder bool           // write NavPoint.PlayOrder as it is
+	order     map[string]int // play order by src
+	next      int            // navPoint id counter
+}
+
+func (n *ncxWriter) points(points []NavPoint) {
+	for _, np := range points {
+		id := np.ID
+		for id == "" || id != np.ID && n.ids[id] {
+			n.next++
+			id = "navPoint-" + strconv.Itoa(n.next)
+		}
+		n.ids[id] = true
+		order, ok := n.order[np.Content.Src]
+		if n.keepOrder {
+			order = np.PlayOrder
+		} else if !ok {
+			order = len(n.order) + 1
+			n.order[np.Content.Src] = order
+		}
+		n.x.start("navPoint", "id", id, "playOrder", strconv.Itoa(order))
+		n.x.start("navLabel")
+		n.x.elem("text", np.NavLabel.Text)
+		n.x.end("navLabel")
+		n.x.elem("content", "", "src", np.Content.Src)
+		n.points(np.NavPoints)
+		n.x.end("navPoint")
+	}
+}
+
+// xmlWriter builds an indented XML document. Attributes are passed as
+// name/value pairs and omitted when the value is empty; elements with no
+// text are written self-closed.
+type xmlWriter struct {
+	b     strings.Builder
+	depth int
+}
+
+func (x *xmlWriter) header() {
+	x.b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+}
+
+func (x *xmlWriter) open(name string, attrs []string) {
+	x.b.WriteString(strings.Repeat("  ", x.depth))
+	x.b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] == "" {
+			continue
+		}
+		fmt.Fprintf(&x.b, ` %s="%s"`, attrs[i], escapeXML(attrs[i+1]))
+	}
+}
+
+func (x *xmlWriter) start(name string, attrs ...string) {
+	x.open(name, attrs)
+	x.b.WriteString(">\n")
+	x.depth++
+}
+
+func (x *xmlWriter) end(name string) {
+	x.depth--
+	x.b.WriteString(strings.Repeat("  ", x.depth) + "</" + name + ">\n")
+}
+
+// elem writes a leaf element. An element with neither text nor attribute
+// values is dropped.
+func (x *xmlWriter) elem(name, text string, attrs ...string) {
+	if text == "" && !hasValue(attrs) {
+		return
+	}
+	x.open(name, attrs)
+	if text == "" {
+		x.b.WriteString("/>\n")
+		return
+	}
+	x.b.WriteString(">" + escapeXML(text) + "</" + name + ">\n")
+}
+
+func hasValue(attrs []string) bool {
+	for i := 1; i < len(attrs); i += 2 {
+		if attrs[i] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *xmlWriter) flush(w io.Writer) error {
+	_, err := io.WriteString(w, x.b.String())
+	return err
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func orDefault(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package gopub
 
 // Media type constants for common EPUB content types.
 const (
+	MediaTypeEPUB     = "application/epub+zip"
 	MediaTypeNCX      = "application/x-dtbncx+xml"
 	MediaTypeOEBPS    = "application/oebps-package+xml"
 	MediaTypeXHTML    = "application/xhtml+xml"
@@ -19,8 +19,14 @@ type Metadata struct {
 	Relation    []string     `xml:"relation"`
 	Coverage    string       `xml:"coverage"`
 	Rights      []string     `xml:"rights"`
+	// Link holds EPUB 3.0 <link> elements (records, alternates, voicing, …).
+	Link []Link `xml:"link"`
 	// Meta holds raw <meta> tags; consumed by processRefinements, then cleared.
 	Meta []MetaTag `xml:"meta"`
+	// Refinements holds the EPUB 3.0 <meta refines> tags that have no
+	// dedicated field, such as alternate-script, identifier-type or
+	// meta-auth, in document order.
+	Refinements []MetaTag `xml:"-"`
 	// Post-processed fields (not from XML directly).
 	OtherTags       map[string][]string `xml:"-"`
 	CoverManifestId string              `xml:"-"`
@@ -81,6 +87,8 @@ func (m *Metadata) PrimarySubject() string {
 
 // Identifier represents a dc:identifier element with optional scheme.
 type Identifier struct {
+	// ID is the element id; Package.UniqueIdentifier names one of them.
+	ID     string `xml:"id,attr"`
 	Scheme string `xml:"scheme,attr"`
 	Value  string `xml:",chardata"`
 }
@@ -95,8 +103,12 @@ type Date struct {
 type MetaTag struct {
 	Name     string `xml:"name,attr"`
 	Content  string `xml:"content,attr"`
+	ID       string `xml:"id,attr"`
 	Refines  string `xml:"refines,attr"`
 	Property string `xml:"property,attr"`
+	Scheme   string `xml:"scheme,attr"`
+	Lang     string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Dir      string `xml:"dir,attr"`
 	InnerXML string `xml:",chardata"`
 }
 
@@ -105,6 +117,9 @@ type Refinable struct {
 	Name   string `xml:",chardata"`
 	ID     string `xml:"id,attr"`
 	FileAs string `xml:"file-as,attr"`
+	// Lang and Dir are the xml:lang and dir attributes of the element.
+	Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Dir  string `xml:"dir,attr"`
 }
 
 // Creator represents a dc:creator or dc:contributor element.
@@ -156,9 +171,16 @@ func processRefinements(metadata *Metadata) {
 				refinesDisplaySeq[id] = meta.InnerXML
 			case "title-type":
 				refinesTitleType[id] = meta.InnerXML
+			case "group-position":
+				// Series position refining a belongs-to-collection meta.
+				if metadata.OtherTags["group-position"] == nil {
+					metadata.OtherTags["group-position"] = []string{meta.InnerXML}
+				}
 			default:
 				if key, ok := strings.CutPrefix(meta.Property, "dcterms:"); ok {
 					refinesDCTerms[key] = meta.InnerXML
+				} else {
+					metadata.Refinements = append(metadata.Refinements, meta)
 				}
 			}
 			continue
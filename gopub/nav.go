@@ -9,6 +9,8 @@ import (
 // NavDoc represents an EPUB 3.0 compatible navigation document.
 type NavDoc struct {
 	Navs []NavSection `xml:"body>nav"`
+	// HREF is the manifest href of the nav document; nav links are relative to it.
+	HREF string `xml:"-"`
 }
 
 // NavSection represents a single <nav> element (e.g. toc, landmarks).
@@ -29,12 +31,17 @@ type NavItem struct {
 type navLink struct {
 	Href string
 	Text string
+	// Type is the epub:type of the link (e.g. "cover", "bodymatter" in landmarks).
+	Type string
 }
 
 func (l *navLink) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	for _, attr := range start.Attr {
-		if attr.Name.Local == "href" {
+		switch attr.Name.Local {
+		case "href":
 			l.Href = attr.Value
+		case "type":
+			l.Type = attr.Value
 		}
 	}
 	var sb strings.Builder
@@ -68,27 +75,40 @@ func (l *navLink) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 // Non-fatal: missing nav document is silently skipped.
 func (r *Reader) setTOC() error {
 	for _, rf := range r.Container.Rootfiles {
-		for _, item := range rf.Manifest.Items {
-			if !hasNavProperty(item.Properties) {
-				continue
-			}
+		if err := r.setRootfileTOC(rf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			data, err := r.readItem(&item)
-			if err != nil {
-				return err
-			}
+// setRootfileTOC loads the EPUB 3.0 navigation document of rf, if it has one.
+func (r *Reader) setRootfileTOC(rf *Rootfile) error {
+	for _, item := range rf.Manifest.Items {
+		if !hasNavProperty(item.Properties) {
+			continue
+		}
 
-			if err := xmlDecodeBytes(data, &rf.NavDoc); err != nil {
-				return err
-			}
-			break
+		data, err := r.readItem(&item)
+		if err != nil {
+			return err
 		}
+
+		if err := r.decodeXML(data, &rf.NavDoc); err != nil {
+			return err
+		}
+		rf.NavDoc.HREF = item.HREF
+		break
 	}
 	return nil
 }
 
-// TOCNav returns the NavSection with epub:type "toc", or nil if not found.
+// TOCNav returns the NavSection with epub:type "toc", or nil if not found
+// or, with ModeLazy, if Load fails.
 func (rf *Rootfile) TOCNav() *NavSection {
+	if rf.Load() != nil {
+		return nil
+	}
 	for i := range rf.NavDoc.Navs {
 		if rf.NavDoc.Navs[i].Type == "toc" {
 			return &rf.NavDoc.Navs[i]
@@ -97,6 +117,20 @@ func (rf *Rootfile) TOCNav() *NavSection {
 	return nil
 }
 
+// LandmarksNav returns the NavSection with epub:type "landmarks", or nil if
+// not found or, with ModeLazy, if Load fails.
+func (rf *Rootfile) LandmarksNav() *NavSection {
+	if rf.Load() != nil {
+		return nil
+	}
+	for i := range rf.NavDoc.Navs {
+		if rf.NavDoc.Navs[i].Type == "landmarks" {
+			return &rf.NavDoc.Navs[i]
+		}
+	}
+	return nil
+}
+
 // navItemName searches the NavDoc for a display name matching href.
 func (rf *Rootfile) navItemName(href string) string {
 	for _, nav := range rf.NavDoc.Navs {
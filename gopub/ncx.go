@@ -26,23 +26,27 @@ type NavPoint struct {
 // Non-fatal: missing NCX is silently skipped.
 func (r *Reader) setNCX() error {
 	for _, rf := range r.Container.Rootfiles {
-		item := r.findNCXItem(rf)
-		if item == nil {
-			continue
-		}
-
-		data, err := r.readItem(item)
-		if err != nil {
-			return err
-		}
-
-		if err := xmlDecodeBytes(data, &rf.NCX); err != nil {
+		if err := r.setRootfileNCX(rf); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// setRootfileNCX loads the EPUB 2.0 NCX of rf, if it has one.
+func (r *Reader) setRootfileNCX(rf *Rootfile) error {
+	item := r.findNCXItem(rf)
+	if item == nil {
+		return nil
+	}
+
+	data, err := r.readItem(item)
+	if err != nil {
+		return err
+	}
+	return r.decodeXML(data, &rf.NCX)
+}
+
 // findNCXItem locates the NCX manifest item for a rootfile.
 // Prefers the spine toc attribute, then a manifest item with the
 // application/x-dtbncx+xml media type, then the conventional "ncx" ID.
@@ -0,0 +1,112 @@
+package onix
+
+import "strings"
+
+// relatorToRole maps MARC relator codes (as used in opf:role and EPUB 3.0
+// role refinements) to ONIX code list 17 contributor roles.
+var relatorToRole = map[string]string{
+	"aut": "A01", // By (author)
+	"ccp": "A02", // With
+	"aus": "A03", // Screenplay by
+	"lyr": "A05", // Lyrics by
+	"cmp": "A06", // By (composer)
+	"art": "A07", // By (artist)
+	"pht": "A08", // By (photographer)
+	"ill": "A12", // Illustrated by
+	"aui": "A15", // Introduction by
+	"win": "A15", // Introduction by
+	"wpr": "A16", // Preface by
+	"wfw": "A23", // Foreword by
+	"aft": "A19", // Afterword by
+	"ann": "A20", // Notes by
+	"com": "C01", // Compiled by
+	"cov": "A36", // Cover design or artwork by
+	"edt": "B01", // Edited by
+	"adp": "B05", // Adapted by
+	"trl": "B06", // Translated by
+	"nrt": "E07", // Read by
+	"prf": "E08", // Performed by
+	"ctb": "Z99", // Other
+}
+
+// roleToRelator is the inverse of relatorToRole, preferring the canonical
+// relator where several map to the same ONIX role.
+var roleToRelator = func() map[string]string {
+	m := make(map[string]string, len(relatorToRole))
+	for rel, role := range relatorToRole {
+		if _, ok := m[role]; !ok || rel < m[role] {
+			m[role] = rel
+		}
+	}
+	return m
+}()
+
+// contributorRole returns the ONIX role for a MARC relator, defaulting to
+// A01 for creators and Z99 for contributors.
+func contributorRole(relator string, creator bool) string {
+	if role, ok := relatorToRole[strings.ToLower(relator)]; ok {
+		return role
+	}
+	if creator {
+		return "A01"
+	}
+	return "Z99"
+}
+
+// iso639 maps ISO 639-1 two-letter codes to ISO 639-2/B codes used by ONIX.
+var iso639 = map[string]string{
+	"ar": "ara", "bg": "bul", "ca": "cat", "cs": "cze", "cy": "wel",
+	"da": "dan", "de": "ger", "el": "gre", "en": "eng", "es": "spa",
+	"et": "est", "eu": "baq", "fa": "per", "fi": "fin", "fr": "fre",
+	"ga": "gle", "gl": "glg", "he": "heb", "hi": "hin", "hr": "hrv",
+	"hu": "hun", "id": "ind", "is": "ice", "it": "ita", "ja": "jpn",
+	"ko": "kor", "la": "lat", "lt": "lit", "lv": "lav", "ms": "may",
+	"nb": "nob", "nl": "dut", "nn": "nno", "no": "nor", "pl": "pol",
+	"pt": "por", "ro": "rum", "ru": "rus", "sk": "slo", "sl": "slv",
+	"sr": "srp", "sv": "swe", "th": "tha", "tr": "tur", "uk": "ukr",
+	"vi": "vie", "zh": "chi",
+}
+
+var iso639Inverse = func() map[string]string {
+	m := make(map[string]string, len(iso639))
+	for two, three := range iso639 {
+		m[three] = two
+	}
+	return m
+}()
+
+// onixLanguage converts a BCP 47 tag such as "en-GB" to an ONIX language code.
+func onixLanguage(tag string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	if three, ok := iso639[primary]; ok {
+		return three
+	}
+	return primary
+}
+
+// bcp47Language converts an ONIX language code back to a BCP 47 primary tag.
+func bcp47Language(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if two, ok := iso639Inverse[code]; ok {
+		return two
+	}
+	return code
+}
+
+// isBISAC reports whether s looks like a BISAC subject code (e.g. "FIC009000").
+func isBISAC(s string) bool {
+	if len(s) != 9 {
+		return false
+	}
+	for i := 0; i < 3; i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	for i := 3; i < 9; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
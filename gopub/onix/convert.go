@@ -0,0 +1,456 @@
+package onix
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/uuid"
+)
+
+// Code list values used when building products.
+const (
+	notificationConfirmed = "03"   // list 1
+	compositionSingle     = "00"   // list 2
+	formDigital           = "ED"   // list 150: digital (delivered electronically)
+	formDetailEPUB        = "E101" // list 175
+	idProprietary         = "01"   // list 5
+	idISBN10              = "02"
+	idGTIN13              = "03"
+	idDOI                 = "06"
+	idISBN13              = "15"
+	titleDistinctive      = "01" // list 15
+	titleLevelProduct     = "01" // list 149
+	titleLevelCollection  = "02"
+	collectionPublisher   = "10" // list 148
+	languageOfText        = "01" // list 22
+	subjectBISAC          = "10" // list 26
+	subjectKeywords       = "20"
+	textDescription       = "03" // list 153
+	textShortDescription  = "02"
+	audienceUnrestricted  = "00" // list 154
+	publishingPublisher   = "01" // list 45
+	datePublication       = "01" // list 163
+	dateFormatYYYYMMDD    = "00" // list 55
+	dateFormatYYYYMM      = "01"
+	dateFormatYYYY        = "05"
+)
+
+// NewMessage wraps products in a Message with a header naming sender.
+func NewMessage(sender string, products ...Product) *Message {
+	m := &Message{Release: "3.0", Products: products}
+	m.Header.Sender.SenderName = sender
+	m.Header.SentDateTime = time.Now().UTC().Format("20060102T1504Z")
+	return m
+}
+
+// FromMetadata maps md to an ONIX 3.0 product describing an EPUB e-book.
+func FromMetadata(md *gopub.Metadata) Product {
+	p := Product{
+		NotificationType: notificationConfirmed,
+		DescriptiveDetail: DescriptiveDetail{
+			ProductComposition: compositionSingle,
+			ProductForm:        formDigital,
+			ProductFormDetail:  []string{formDetailEPUB},
+		},
+	}
+
+	for _, id := range md.Identifier {
+		if pid, ok := productIdentifier(id); ok {
+			p.ProductIdentifiers = append(p.ProductIdentifiers, pid)
+		}
+	}
+	if len(p.ProductIdentifiers) > 0 {
+		p.RecordReference = p.ProductIdentifiers[0].IDValue
+	} else {
+		// RecordReference is mandatory; make one up for books without ids.
+		p.RecordReference = uuid.New()
+	}
+
+	dd := &p.DescriptiveDetail
+	if series, index := seriesOf(md); series != "" {
+		dd.Collections = append(dd.Collections, Collection{
+			CollectionType: collectionPublisher,
+			TitleDetails: []TitleDetail{{
+				TitleType: titleDistinctive,
+				TitleElements: []TitleElement{{
+					TitleElementLevel: titleLevelCollection,
+					PartNumber:        index,
+					TitleText:         series,
+				}},
+			}},
+		})
+	}
+
+	if main := md.MainTitle(); main.Name != "" {
+		elem := TitleElement{TitleElementLevel: titleLevelProduct, TitleText: strings.TrimSpace(main.Name)}
+		for _, t := range md.Title {
+			if t.TitleType == "subtitle" {
+				elem.Subtitle = strings.TrimSpace(t.Name)
+				break
+			}
+		}
+		dd.TitleDetails = append(dd.TitleDetails, TitleDetail{
+			TitleType:     titleDistinctive,
+			TitleElements: []TitleElement{elem},
+		})
+	}
+
+	seq := 0
+	addContributors := func(creators []gopub.Creator, creator bool) {
+		for _, c := range creators {
+			if strings.TrimSpace(c.Name) == "" {
+				continue
+			}
+			seq++
+			dd.Contributors = append(dd.Contributors, Contributor{
+				SequenceNumber:     strconv.Itoa(seq),
+				ContributorRoles:   []string{contributorRole(c.CreatorRole, creator)},
+				PersonName:         strings.TrimSpace(c.Name),
+				PersonNameInverted: strings.TrimSpace(c.FileAs),
+			})
+		}
+	}
+	addContributors(md.Creator, true)
+	addContributors(md.Contributor, false)
+
+	for _, lang := range md.Language {
+		if code := onixLanguage(lang); code != "" {
+			dd.Languages = append(dd.Languages, Language{LanguageRole: languageOfText, LanguageCode: code})
+		}
+	}
+
+	for _, s := range md.Subject {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if isBISAC(s) {
+			dd.Subjects = append(dd.Subjects, Subject{SubjectSchemeIdentifier: subjectBISAC, SubjectCode: s})
+		} else {
+			dd.Subjects = append(dd.Subjects, Subject{SubjectSchemeIdentifier: subjectKeywords, SubjectHeadingText: s})
+		}
+	}
+
+	if desc := strings.TrimSpace(md.Description); desc != "" {
+		p.CollateralDetail = &CollateralDetail{TextContents: []TextContent{{
+			TextType:        textDescription,
+			ContentAudience: audienceUnrestricted,
+			Text:            desc,
+		}}}
+	}
+
+	var pd PublishingDetail
+	for _, pub := range md.Publisher {
+		if name := strings.TrimSpace(pub.Name); name != "" {
+			pd.Publishers = append(pd.Publishers, Publisher{PublishingRole: publishingPublisher, PublisherName: name})
+		}
+	}
+	for _, ev := range md.Event {
+		if ev.Name != "" && ev.Name != "publication" && ev.Name != "issued" {
+			continue
+		}
+		if d := onixDate(ev.Date); d != "" {
+			pd.PublishingDates = append(pd.PublishingDates, PublishingDate{
+				PublishingDateRole: datePublication,
+				Date:               Date{DateFormat: dateFormat(d), Value: d},
+			})
+			break
+		}
+	}
+	if len(pd.Publishers) > 0 || len(pd.PublishingDates) > 0 {
+		p.PublishingDetail = &pd
+	}
+	return p
+}
+
+// ToMetadata maps p back to gopub.Metadata. Fields ONIX cannot express
+// (meta tags, links, cover id) are left empty.
+func (p *Product) ToMetadata() gopub.Metadata {
+	var md gopub.Metadata
+
+	for _, pid := range p.ProductIdentifiers {
+		md.Identifier = append(md.Identifier, epubIdentifier(pid))
+	}
+
+	dd := &p.DescriptiveDetail
+	for _, td := range dd.TitleDetails {
+		if td.TitleType != titleDistinctive {
+			continue
+		}
+		for _, e := range td.TitleElements {
+			if e.TitleElementLevel != "" && e.TitleElementLevel != titleLevelProduct {
+				continue
+			}
+			md.Title = append(md.Title, gopub.Title{
+				Refinable: gopub.Refinable{Name: e.Text(), ID: "title"},
+				TitleType: "main",
+			})
+			if e.Subtitle != "" {
+				md.Title = append(md.Title, gopub.Title{
+					Refinable: gopub.Refinable{Name: e.Subtitle, ID: "subtitle"},
+					TitleType: "subtitle",
+				})
+			}
+			break
+		}
+		if len(md.Title) > 0 {
+			break
+		}
+	}
+
+	for _, c := range dd.Contributors {
+		role := ""
+		if len(c.ContributorRoles) > 0 {
+			role = c.ContributorRoles[0]
+		}
+		creator := gopub.Creator{
+			Refinable:   gopub.Refinable{Name: c.Name(), FileAs: c.PersonNameInverted},
+			CreatorRole: roleToRelator[role],
+		}
+		if creator.CreatorRole == "" {
+			creator.CreatorRole = "ctb"
+		}
+		if isPrimaryRole(role) {
+			creator.ID = "creator" + strconv.Itoa(len(md.Creator)+1)
+			md.Creator = append(md.Creator, creator)
+		} else {
+			creator.ID = "contributor" + strconv.Itoa(len(md.Contributor)+1)
+			md.Contributor = append(md.Contributor, creator)
+		}
+	}
+
+	for _, l := range dd.Languages {
+		if l.LanguageRole == "" || l.LanguageRole == languageOfText {
+			md.Language = append(md.Language, bcp47Language(l.LanguageCode))
+		}
+	}
+
+	for _, s := range dd.Subjects {
+		switch {
+		case s.SubjectHeadingText != "":
+			md.Subject = append(md.Subject, s.SubjectHeadingText)
+		case s.SubjectCode != "":
+			md.Subject = append(md.Subject, s.SubjectCode)
+		}
+	}
+
+	for _, c := range dd.Collections {
+		for _, td := range c.TitleDetails {
+			for _, e := range td.TitleElements {
+				if e.TitleElementLevel == titleLevelCollection && md.Series == "" {
+					md.Series = e.Text()
+					md.SeriesIndex = e.PartNumber
+				}
+			}
+		}
+	}
+
+	if cd := p.CollateralDetail; cd != nil {
+		for _, tc := range cd.TextContents {
+			if tc.TextType == textDescription || (md.Description == "" && tc.TextType == textShortDescription) {
+				md.Description = tc.Text
+			}
+		}
+	}
+
+	if pd := p.PublishingDetail; pd != nil {
+		for _, pub := range pd.Publishers {
+			md.Publisher = append(md.Publisher, gopub.Refinable{Name: pub.PublisherName})
+		}
+		for _, d := range pd.PublishingDates {
+			if d.PublishingDateRole == datePublication {
+				md.Event = append(md.Event, gopub.Date{Name: "publication", Date: epubDate(d.Date.Value)})
+			}
+		}
+	}
+	return md
+}
+
+// ApplyTo overwrites the fields of md that p provides, leaving everything
+// else (meta tags, links, cover, rights, …) untouched. Use it to correct an
+// EPUB's OPF metadata from a distributor's ONIX record.
+func (p *Product) ApplyTo(md *gopub.Metadata) {
+	pm := p.ToMetadata()
+	if len(pm.Identifier) > 0 {
+		md.Identifier = mergeIdentifiers(md.Identifier, pm.Identifier)
+	}
+	if len(pm.Title) > 0 {
+		md.Title = pm.Title
+	}
+	if len(pm.Creator) > 0 {
+		md.Creator = pm.Creator
+	}
+	if len(pm.Contributor) > 0 {
+		md.Contributor = pm.Contributor
+	}
+	if len(pm.Language) > 0 {
+		md.Language = pm.Language
+	}
+	if len(pm.Subject) > 0 {
+		md.Subject = pm.Subject
+	}
+	if pm.Description != "" {
+		md.Description = pm.Description
+	}
+	if len(pm.Publisher) > 0 {
+		md.Publisher = pm.Publisher
+	}
+	if len(pm.Event) > 0 {
+		events := pm.Event
+		for _, ev := range md.Event {
+			if ev.Name != "" && ev.Name != "publication" && ev.Name != "issued" {
+				events = append(events, ev)
+			}
+		}
+		md.Event = events
+	}
+	if pm.Series != "" {
+		md.Series = pm.Series
+		md.SeriesIndex = pm.SeriesIndex
+	}
+}
+
+// isPrimaryRole reports whether an ONIX role denotes a primary creator
+// ("By (author)", "With", "By (artist)", …) rather than a secondary contributor.
+func isPrimaryRole(role string) bool {
+	switch role {
+	case "A01", "A02", "A03", "A06", "A07", "A08":
+		return true
+	}
+	return false
+}
+
+// seriesOf returns the series title and index, preferring EPUB 3.0
+// collection metadata and falling back to Calibre's series tags.
+func seriesOf(md *gopub.Metadata) (string, string) {
+	if md.Series != "" {
+		return md.Series, md.SeriesIndex
+	}
+	if c, _ := md.Calibre(); c != nil && c.Series != "" {
+		index := ""
+		if c.SeriesIndex != 0 {
+			index = strconv.FormatFloat(c.SeriesIndex, 'f', -1, 64)
+		}
+		return c.Series, index
+	}
+	return "", ""
+}
+
+// productIdentifier classifies a dc:identifier into an ONIX identifier type.
+func productIdentifier(id gopub.Identifier) (ProductIdentifier, bool) {
+	v := strings.TrimSpace(id.Value)
+	if v == "" {
+		return ProductIdentifier{}, false
+	}
+	lower := strings.ToLower(v)
+	scheme := strings.ToUpper(id.Scheme)
+
+	if rest, ok := strings.CutPrefix(lower, "urn:isbn:"); ok || scheme == "ISBN" {
+		if !ok {
+			rest = lower
+		}
+		digits := strings.NewReplacer("-", "", " ", "").Replace(rest)
+		switch len(digits) {
+		case 13:
+			return ProductIdentifier{ProductIDType: idISBN13, IDValue: digits}, true
+		case 10:
+			return ProductIdentifier{ProductIDType: idISBN10, IDValue: strings.ToUpper(digits)}, true
+		}
+	}
+	if rest, ok := strings.CutPrefix(lower, "doi:"); ok || scheme == "DOI" || strings.HasPrefix(lower, "10.") {
+		if !ok {
+			rest = v
+		} else {
+			rest = v[len("doi:"):]
+		}
+		return ProductIdentifier{ProductIDType: idDOI, IDValue: rest}, true
+	}
+	if scheme == "GTIN" || scheme == "EAN" {
+		return ProductIdentifier{ProductIDType: idGTIN13, IDValue: v}, true
+	}
+
+	name := id.Scheme
+	if rest, ok := strings.CutPrefix(lower, "urn:uuid:"); ok {
+		name, v = "UUID", rest
+	}
+	if name == "" {
+		name = "Publisher identifier"
+	}
+	return ProductIdentifier{ProductIDType: idProprietary, IDTypeName: name, IDValue: v}, true
+}
+
+// epubIdentifier converts an ONIX identifier into a dc:identifier.
+func epubIdentifier(pid ProductIdentifier) gopub.Identifier {
+	switch pid.ProductIDType {
+	case idISBN13, idISBN10:
+		return gopub.Identifier{Scheme: "ISBN", Value: "urn:isbn:" + pid.IDValue}
+	case idGTIN13:
+		return gopub.Identifier{Scheme: "GTIN", Value: pid.IDValue}
+	case idDOI:
+		return gopub.Identifier{Scheme: "DOI", Value: "doi:" + pid.IDValue}
+	}
+	if strings.EqualFold(pid.IDTypeName, "UUID") {
+		return gopub.Identifier{Scheme: "UUID", Value: "urn:uuid:" + pid.IDValue}
+	}
+	return gopub.Identifier{Scheme: pid.IDTypeName, Value: pid.IDValue}
+}
+
+// mergeIdentifiers appends ONIX identifiers not already present in ids,
+// keeping existing identifiers (and so the package unique-identifier) intact.
+func mergeIdentifiers(ids, add []gopub.Identifier) []gopub.Identifier {
+	key := func(id gopub.Identifier) string {
+		pid, _ := productIdentifier(id)
+		return pid.ProductIDType + ":" + strings.ToLower(pid.IDValue)
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[key(id)] = true
+	}
+	for _, id := range add {
+		if !seen[key(id)] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// onixDate converts an ISO 8601 date or timestamp to YYYYMMDD, YYYYMM or YYYY.
+func onixDate(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		s = s[:i]
+	}
+	d := strings.ReplaceAll(s, "-", "")
+	switch len(d) {
+	case 4, 6, 8:
+		if _, err := strconv.Atoi(d); err == nil {
+			return d
+		}
+	}
+	return ""
+}
+
+// dateFormat returns the list 55 format code of an onixDate result.
+func dateFormat(d string) string {
+	switch len(d) {
+	case 6:
+		return dateFormatYYYYMM
+	case 4:
+		return dateFormatYYYY
+	}
+	return dateFormatYYYYMMDD
+}
+
+// epubDate converts an ONIX YYYYMMDD, YYYYMM or YYYY date to ISO 8601.
+func epubDate(d string) string {
+	d = strings.TrimSpace(d)
+	switch len(d) {
+	case 8:
+		return d[:4] + "-" + d[4:6] + "-" + d[6:]
+	case 6:
+		return d[:4] + "-" + d[4:]
+	}
+	return d
+}
@@ -0,0 +1,8 @@
+package onix
+
+import "errors"
+
+var (
+	ErrNotONIX   = errors.New("onix: document is not an ONIX 3.0 message or product")
+	ErrNoProduct = errors.New("onix: message contains no product")
+)
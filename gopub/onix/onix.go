@@ -0,0 +1,228 @@
+// Package onix converts between gopub.Metadata and ONIX for Books 3.0
+// <Product> records (reference tags only).
+package onix
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Namespace is the ONIX 3.0 reference-tag XML namespace.
+const Namespace = "http://ns.editeur.org/onix/3.0/reference"
+
+// Message is an ONIX 3.0 <ONIXMessage>.
+type Message struct {
+	XMLName  xml.Name  `xml:"ONIXMessage"`
+	Xmlns    string    `xml:"xmlns,attr,omitempty"`
+	Release  string    `xml:"release,attr"`
+	Header   Header    `xml:"Header"`
+	Products []Product `xml:"Product"`
+}
+
+// Header identifies the sender of a Message.
+type Header struct {
+	Sender struct {
+		SenderName string `xml:"SenderName,omitempty"`
+	} `xml:"Sender"`
+	SentDateTime string `xml:"SentDateTime"`
+}
+
+// Product is a single ONIX 3.0 <Product> record.
+type Product struct {
+	RecordReference    string              `xml:"RecordReference"`
+	NotificationType   string              `xml:"NotificationType"`
+	ProductIdentifiers []ProductIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  DescriptiveDetail   `xml:"DescriptiveDetail"`
+	CollateralDetail   *CollateralDetail   `xml:"CollateralDetail,omitempty"`
+	PublishingDetail   *PublishingDetail   `xml:"PublishingDetail,omitempty"`
+}
+
+// ProductIdentifier is a typed product identifier (code list 5).
+type ProductIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDTypeName    string `xml:"IDTypeName,omitempty"`
+	IDValue       string `xml:"IDValue"`
+}
+
+// DescriptiveDetail holds the bibliographic description of a product.
+type DescriptiveDetail struct {
+	ProductComposition string        `xml:"ProductComposition"`
+	ProductForm        string        `xml:"ProductForm"`
+	ProductFormDetail  []string      `xml:"ProductFormDetail,omitempty"`
+	Collections        []Collection  `xml:"Collection"`
+	TitleDetails       []TitleDetail `xml:"TitleDetail"`
+	Contributors       []Contributor `xml:"Contributor"`
+	Languages          []Language    `xml:"Language"`
+	Subjects           []Subject     `xml:"Subject"`
+}
+
+// Collection describes a series the product belongs to.
+type Collection struct {
+	CollectionType string        `xml:"CollectionType"`
+	TitleDetails   []TitleDetail `xml:"TitleDetail"`
+}
+
+// TitleDetail is a typed title (code list 15).
+type TitleDetail struct {
+	TitleType     string         `xml:"TitleType"`
+	TitleElements []TitleElement `xml:"TitleElement"`
+}
+
+// TitleElement is one level of a title (product, collection, …).
+type TitleElement struct {
+	TitleElementLevel  string `xml:"TitleElementLevel"`
+	PartNumber         string `xml:"PartNumber,omitempty"`
+	TitleText          string `xml:"TitleText,omitempty"`
+	TitlePrefix        string `xml:"TitlePrefix,omitempty"`
+	TitleWithoutPrefix string `xml:"TitleWithoutPrefix,omitempty"`
+	Subtitle           string `xml:"Subtitle,omitempty"`
+}
+
+// Text returns the full title text, joining prefix and remainder if needed.
+func (e *TitleElement) Text() string {
+	if e.TitleText != "" {
+		return e.TitleText
+	}
+	if e.TitlePrefix != "" {
+		return e.TitlePrefix + " " + e.TitleWithoutPrefix
+	}
+	return e.TitleWithoutPrefix
+}
+
+// Contributor is a person or organisation with a role (code list 17).
+type Contributor struct {
+	SequenceNumber     string   `xml:"SequenceNumber,omitempty"`
+	ContributorRoles   []string `xml:"ContributorRole"`
+	PersonName         string   `xml:"PersonName,omitempty"`
+	PersonNameInverted string   `xml:"PersonNameInverted,omitempty"`
+	CorporateName      string   `xml:"CorporateName,omitempty"`
+}
+
+// Name returns the display name of the contributor.
+func (c *Contributor) Name() string {
+	switch {
+	case c.PersonName != "":
+		return c.PersonName
+	case c.CorporateName != "":
+		return c.CorporateName
+	}
+	return c.PersonNameInverted
+}
+
+// Language is a typed language code (code lists 22 and 74).
+type Language struct {
+	LanguageRole string `xml:"LanguageRole"`
+	LanguageCode string `xml:"LanguageCode"`
+}
+
+// Subject is a subject code or heading in a scheme (code list 26).
+type Subject struct {
+	MainSubject             *struct{} `xml:"MainSubject,omitempty"`
+	SubjectSchemeIdentifier string    `xml:"SubjectSchemeIdentifier"`
+	SubjectCode             string    `xml:"SubjectCode,omitempty"`
+	SubjectHeadingText      string    `xml:"SubjectHeadingText,omitempty"`
+}
+
+// CollateralDetail holds descriptive texts.
+type CollateralDetail struct {
+	TextContents []TextContent `xml:"TextContent"`
+}
+
+// TextContent is a typed text such as a description (code list 153).
+type TextContent struct {
+	TextType        string `xml:"TextType"`
+	ContentAudience string `xml:"ContentAudience"`
+	Text            string `xml:"Text"`
+}
+
+// PublishingDetail holds the publisher and publishing dates.
+type PublishingDetail struct {
+	Publishers      []Publisher      `xml:"Publisher"`
+	PublishingDates []PublishingDate `xml:"PublishingDate"`
+}
+
+// Publisher is a publishing entity (code list 45).
+type Publisher struct {
+	PublishingRole string `xml:"PublishingRole"`
+	PublisherName  string `xml:"PublisherName"`
+}
+
+// PublishingDate is a typed date (code list 163).
+type PublishingDate struct {
+	PublishingDateRole string `xml:"PublishingDateRole"`
+	Date               Date   `xml:"Date"`
+}
+
+// Date is an ONIX date with an optional format code (code list 55).
+type Date struct {
+	DateFormat string `xml:"dateformat,attr,omitempty"`
+	Value      string `xml:",chardata"`
+}
+
+// Decode reads an ONIX 3.0 message. A bare <Product> document is accepted
+// and returned as a single-product message.
+func Decode(r io.Reader) (*Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "ONIXMessage":
+			var m Message
+			if err := dec.DecodeElement(&m, &start); err != nil {
+				return nil, err
+			}
+			return &m, nil
+		case "Product":
+			var p Product
+			if err := dec.DecodeElement(&p, &start); err != nil {
+				return nil, err
+			}
+			return &Message{Release: "3.0", Products: []Product{p}}, nil
+		}
+		return nil, ErrNotONIX
+	}
+}
+
+// Encode writes m as an indented ONIX 3.0 reference-tag document.
+func (m *Message) Encode(w io.Writer) error {
+	out := *m
+	out.Xmlns = Namespace
+	if out.Release == "" {
+		out.Release = "3.0"
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// FirstProduct returns the first product in m, or ErrNoProduct.
+func (m *Message) FirstProduct() (*Product, error) {
+	if len(m.Products) == 0 {
+		return nil, ErrNoProduct
+	}
+	return &m.Products[0], nil
+}
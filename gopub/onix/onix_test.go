@@ -0,0 +1,180 @@
+package onix
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+func testMetadata() gopub.Metadata {
+	return gopub.Metadata{
+		Title: []gopub.Title{
+			{Refinable: gopub.Refinable{Name: "Alice's Adventures in Wonderland", ID: "t1"}, TitleType: "main"},
+			{Refinable: gopub.Refinable{Name: "Illustrated", ID: "t2"}, TitleType: "subtitle"},
+		},
+		Identifier:  []gopub.Identifier{{Value: "urn:isbn:978-0-00-000000-2"}, {Value: "urn:uuid:1234"}},
+		Creator:     []gopub.Creator{{Refinable: gopub.Refinable{Name: "Lewis Carroll", FileAs: "Carroll, Lewis"}}},
+		Contributor: []gopub.Creator{{Refinable: gopub.Refinable{Name: "Arthur Rackham"}, CreatorRole: "ill"}},
+		Language:    []string{"en-GB"},
+		Subject:     []string{"FIC004000", "Fantasy"},
+		Description: "A girl falls down a rabbit hole.",
+		Publisher:   []gopub.Refinable{{Name: "Example Press"}},
+		Event:       []gopub.Date{{Name: "publication", Date: "2009-05-19"}, {Name: "conversion", Date: "2016-09-15"}},
+		Series:      "Classics",
+		SeriesIndex: "4",
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	md := testMetadata()
+	p := FromMetadata(&md)
+
+	var buf bytes.Buffer
+	if err := NewMessage("gopub", p).Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<ONIXMessage xmlns="` + Namespace + `" release="3.0">`,
+		"<ProductIDType>15</ProductIDType>",
+		"<IDValue>9780000000002</IDValue>",
+		"<ContributorRole>A12</ContributorRole>",
+		"<LanguageCode>eng</LanguageCode>",
+		"<SubjectCode>FIC004000</SubjectCode>",
+		`<Date dateformat="00">20090519</Date>`,
+		"<PartNumber>4</PartNumber>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("encoded ONIX missing %s", want)
+		}
+	}
+
+	msg, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod, err := msg.FirstProduct()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := prod.ToMetadata()
+
+	if got.MainTitle().Name != md.Title[0].Name {
+		t.Errorf("title: got %q", got.MainTitle().Name)
+	}
+	if len(got.Title) != 2 || got.Title[1].TitleType != "subtitle" {
+		t.Errorf("subtitle: got %+v", got.Title)
+	}
+	if len(got.Creator) != 1 || got.Creator[0].FileAs != "Carroll, Lewis" || got.Creator[0].CreatorRole != "aut" {
+		t.Errorf("creator: got %+v", got.Creator)
+	}
+	if len(got.Contributor) != 1 || got.Contributor[0].CreatorRole != "ill" {
+		t.Errorf("contributor: got %+v", got.Contributor)
+	}
+	if got.PrimaryLanguage() != "en" {
+		t.Errorf("language: got %q", got.PrimaryLanguage())
+	}
+	if len(got.Identifier) != 2 || got.Identifier[0].Value != "urn:isbn:9780000000002" || got.Identifier[1].Value != "urn:uuid:1234" {
+		t.Errorf("identifiers: got %+v", got.Identifier)
+	}
+	if len(got.Event) != 1 || got.Event[0].Date != "2009-05-19" {
+		t.Errorf("dates: got %+v", got.Event)
+	}
+	if got.Series != "Classics" || got.SeriesIndex != "4" {
+		t.Errorf("series: got %q %q", got.Series, got.SeriesIndex)
+	}
+	if got.Description != md.Description || got.PrimaryPublisher().Name != "Example Press" {
+		t.Errorf("description/publisher: got %+v", got)
+	}
+}
+
+func TestApplyTo(t *testing.T) {
+	md := testMetadata()
+	md.Rights = []string{"All rights reserved"}
+
+	p := Product{ProductIdentifiers: []ProductIdentifier{{ProductIDType: "15", IDValue: "9780000000002"}}}
+	p.DescriptiveDetail.TitleDetails = []TitleDetail{{
+		TitleType:     "01",
+		TitleElements: []TitleElement{{TitleElementLevel: "01", TitleText: "Corrected Title"}},
+	}}
+	p.ApplyTo(&md)
+
+	if md.MainTitle().Name != "Corrected Title" {
+		t.Errorf("title not applied: %+v", md.Title)
+	}
+	if len(md.Identifier) != 2 {
+		t.Errorf("duplicate identifier added: %+v", md.Identifier)
+	}
+	if len(md.Creator) != 1 || len(md.Rights) != 1 {
+		t.Errorf("unrelated fields changed: %+v", md)
+	}
+}
+
+func TestFromMetadataPartial(t *testing.T) {
+	for date, format := range map[string]string{"2009-05-19": "00", "2009-05": "01", "2009": "05"} {
+		md := gopub.Metadata{Event: []gopub.Date{{Name: "publication", Date: date}}}
+		p := FromMetadata(&md)
+		if p.RecordReference == "" {
+			t.Error("empty RecordReference without identifiers")
+		}
+		if got := p.PublishingDetail.PublishingDates[0].Date.DateFormat; got != format {
+			t.Errorf("%s: got dateformat %q, want %q", date, got, format)
+		}
+	}
+}
+
+func TestDecodeBareProduct(t *testing.T) {
+	msg, err := Decode(strings.NewReader(`<Product><RecordReference>x</RecordReference></Product>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Products) != 1 || msg.Products[0].RecordReference != "x" {
+		t.Errorf("got %+v", msg)
+	}
+	if _, err := Decode(strings.NewReader(`<package/>`)); err != ErrNotONIX {
+		t.Errorf("got %v, want ErrNotONIX", err)
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<ONIXMessage xmlns="http://ns.editeur.org/onix/3.0/reference" release="3.0">
+  <Product>
+    <RecordReference>rec-1</RecordReference>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780000000002</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <TitleDetail><TitleType>01</TitleType>
+        <TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>Linked</TitleText><Subtitle>A Test</Subtitle></TitleElement>
+      </TitleDetail>
+      <Contributor><ContributorRole>A01</ContributorRole><PersonName>Jane Doe</PersonName></Contributor>
+      <Language><LanguageRole>01</LanguageRole><LanguageCode>eng</LanguageCode></Language>
+    </DescriptiveDetail>
+    <CollateralDetail><TextContent><TextType>03</TextType><Text>About the book.</Text></TextContent></CollateralDetail>
+    <PublishingDetail>
+      <Publisher><PublishingRole>01</PublishingRole><PublisherName>Example Press</PublisherName></Publisher>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date>20200101</Date></PublishingDate>
+    </PublishingDetail>
+  </Product>
+</ONIXMessage>`
+	rec, err := gopub.ParseRecord([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Format != gopub.RecordONIX || rec.Title != "Linked" || rec.Subtitle != "A Test" {
+		t.Errorf("title: %+v", rec)
+	}
+	if len(rec.Contributors) != 1 || rec.Contributors[0] != (gopub.RecordContributor{Name: "Jane Doe", Role: "A01"}) {
+		t.Errorf("contributors: %+v", rec.Contributors)
+	}
+	if len(rec.Identifiers) != 1 || rec.Identifiers[0] != (gopub.Identifier{Scheme: "ISBN", Value: "9780000000002"}) {
+		t.Errorf("identifiers: %+v", rec.Identifiers)
+	}
+	if rec.Publisher != "Example Press" || rec.PublicationDate != "20200101" || rec.Description != "About the book." {
+		t.Errorf("publishing: %+v", rec)
+	}
+	if _, err := gopub.ParseRecord([]byte(`<ONIXMessage release="3.0"/>`)); err != gopub.ErrUnsupportedRecord {
+		t.Errorf("empty message: %v", err)
+	}
+}
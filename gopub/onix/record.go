@@ -0,0 +1,99 @@
+package onix
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub"
+)
+
+func init() {
+	gopub.RegisterRecordFormat(parseRecord, "ONIXMessage", "Product")
+}
+
+// recordSchemes maps ONIX list 5 product identifier types to the scheme
+// names used in gopub.Record.
+var recordSchemes = map[string]string{
+	idProprietary: "proprietary",
+	idISBN10:      "ISBN-10",
+	idGTIN13:      "GTIN-13",
+	idDOI:         "DOI",
+	"13":          "LCCN",
+	idISBN13:      "ISBN",
+}
+
+// parseRecord is the gopub.ParseRecord parser for ONIX messages and bare
+// products; only the first product is used.
+func parseRecord(data []byte) (*gopub.Record, error) {
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	p, err := m.FirstProduct()
+	if errors.Is(err, ErrNoProduct) {
+		return nil, gopub.ErrUnsupportedRecord
+	}
+	return p.Record(), nil
+}
+
+// Record returns the key fields of p as a gopub.Record, the form
+// gopub.Reader.LinkedRecord returns for linked ONIX records.
+func (p *Product) Record() *gopub.Record {
+	rec := &gopub.Record{Format: gopub.RecordONIX}
+	for _, id := range p.ProductIdentifiers {
+		scheme, ok := recordSchemes[id.ProductIDType]
+		if !ok {
+			scheme = "ONIX:" + id.ProductIDType
+		}
+		rec.Identifiers = append(rec.Identifiers, gopub.Identifier{Scheme: scheme, Value: strings.TrimSpace(id.IDValue)})
+	}
+
+	dd := &p.DescriptiveDetail
+	for _, td := range dd.TitleDetails {
+		if len(td.TitleElements) == 0 || (rec.Title != "" && td.TitleType != titleDistinctive) {
+			continue
+		}
+		e := &td.TitleElements[0]
+		rec.Title = strings.TrimSpace(e.Text())
+		rec.Subtitle = strings.TrimSpace(e.Subtitle)
+		if td.TitleType == titleDistinctive {
+			break
+		}
+	}
+	for _, c := range dd.Contributors {
+		role := ""
+		if len(c.ContributorRoles) > 0 {
+			role = c.ContributorRoles[0]
+		}
+		rec.Contributors = append(rec.Contributors, gopub.RecordContributor{Name: strings.TrimSpace(c.Name()), Role: role})
+	}
+	for _, l := range dd.Languages {
+		rec.Language = append(rec.Language, strings.TrimSpace(l.LanguageCode))
+	}
+	for _, s := range dd.Subjects {
+		if s.SubjectHeadingText != "" {
+			rec.Subjects = append(rec.Subjects, strings.TrimSpace(s.SubjectHeadingText))
+		} else if s.SubjectCode != "" {
+			rec.Subjects = append(rec.Subjects, strings.TrimSpace(s.SubjectCode))
+		}
+	}
+	if cd := p.CollateralDetail; cd != nil {
+		for _, tc := range cd.TextContents {
+			if tc.TextType == textDescription || (rec.Description == "" && tc.TextType == textShortDescription) {
+				rec.Description = strings.TrimSpace(tc.Text)
+			}
+		}
+	}
+	if pd := p.PublishingDetail; pd != nil {
+		if len(pd.Publishers) > 0 {
+			rec.Publisher = strings.TrimSpace(pd.Publishers[0].PublisherName)
+		}
+		for _, d := range pd.PublishingDates {
+			if d.PublishingDateRole == datePublication || rec.PublicationDate == "" {
+				rec.PublicationDate = strings.TrimSpace(d.Date.Value)
+			}
+		}
+	}
+	return rec
+}
@@ -0,0 +1,209 @@
+package gopub
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Mode selects how strictly a Reader treats malformed EPUBs.
+type Mode uint
+
+// ModeLenient repairs malformed XML (bare '&', non-ASCII tag names),
+// tolerates manifest items whose files are missing and duplicate manifest
+// ids, logging a warning for each. It is the default.
+const ModeLenient Mode = 0
+
+// Mode flags; combine with |.
+const (
+	// ModeStrict decodes XML as-is and fails with ErrBadManifest for missing
+	// manifest files and ErrDuplicateID for duplicate manifest ids.
+	ModeStrict Mode = 1 << iota
+	// ModeRecover salvages EPUBs whose ZIP central directory is missing or
+	// corrupt (e.g. truncated downloads) by scanning local file headers.
+	// The scan enforces the size, entry and compression ratio limits as it
+	// decompresses. See Reader.Recovery for what was recovered.
+	ModeRecover
+	// ModeFuzzyPaths resolves manifest, link and rootfile paths that match a
+	// ZIP entry only when compared case-insensitively, with '\' as '/' and
+	// in Unicode NFC form, as produced by some Windows tools. Each such match
+	// is reported as a warning.
+	ModeFuzzyPaths
+	// ModeLazy makes NewReader read only container.xml and the package
+	// metadata. The manifest, spine, NCX and nav document of a rootfile are
+	// parsed on first use; see Rootfile.Load.
+	ModeLazy
+)
+
+// ReaderOptions configures optional behaviour for Reader and ReadCloser.
+// The zero value is valid and applies no restrictions. Build it with the
+// With* options rather than directly.
+type ReaderOptions struct {
+	// MaxFileSize limits how many bytes are read from any single file inside
+	// the EPUB ZIP. 0 means unlimited. Set this when processing untrusted
+	// EPUBs to guard against ZIP-bomb / OOM attacks.
+	MaxFileSize int64
+	// MaxEntries limits the number of entries in the ZIP. 0 means unlimited.
+	MaxEntries int
+	// MaxTotalSize limits the sum of the declared uncompressed sizes of all
+	// entries. 0 means unlimited.
+	MaxTotalSize int64
+	// MaxCompressionRatio limits uncompressed/compressed size for entries of
+	// 64 KiB or more, both in the ZIP directory and while streaming an entry
+	// from ManifestItem.Open. 0 means unlimited.
+	MaxCompressionRatio float64
+	// MaxXMLDepth limits element nesting in container, package, NCX and nav
+	// documents. 0 means unlimited.
+	MaxXMLDepth int
+	// MaxXMLTokens limits the number of XML tokens (elements, text, comments)
+	// in each of those documents. 0 means unlimited.
+	MaxXMLTokens int
+	// MaxXMLAttrs limits the number of attributes on any one element of
+	// those documents. 0 means unlimited.
+	MaxXMLAttrs int
+	// MaxNavDepth limits the nesting of NCX navPoints and nav document lists.
+	// 0 means unlimited.
+	MaxNavDepth int
+	// MaxImagePixels limits the width × height an image declares before
+	// DecodeImage allocates it. 0 means unlimited.
+	MaxImagePixels int64
+	// SpillThreshold is how many bytes of container.xml and package
+	// documents a StreamReader buffers in memory before spilling to a
+	// temporary file. 0 means DefaultSpillThreshold.
+	SpillThreshold int64
+	// ItemCacheSize bounds the total size of decompressed manifest items kept
+	// in memory for ManifestItem.ReadAll, evicting the least recently used.
+	// 0 disables the cache.
+	ItemCacheSize int64
+	// CalibreSidecar makes OpenReader read the Calibre metadata.opf next to
+	// the book into ReadCloser.Sidecar.
+	CalibreSidecar bool
+	// Mode selects lenient or strict parsing and optional ZIP recovery.
+	Mode Mode
+	// Logger receives warnings about recoverable problems. nil discards them.
+	Logger *slog.Logger
+}
+
+// Option configures a Reader.
+type Option func(*ReaderOptions)
+
+// WithMaxFileSize limits how many bytes are read from any single file.
+func WithMaxFileSize(n int64) Option {
+	return func(o *ReaderOptions) { o.MaxFileSize = n }
+}
+
+// WithMaxEntries limits the number of entries in the ZIP.
+func WithMaxEntries(n int) Option {
+	return func(o *ReaderOptions) { o.MaxEntries = n }
+}
+
+// WithMaxTotalSize limits the total declared uncompressed size of the ZIP.
+func WithMaxTotalSize(n int64) Option {
+	return func(o *ReaderOptions) { o.MaxTotalSize = n }
+}
+
+// WithMaxCompressionRatio limits the compression ratio of large entries.
+func WithMaxCompressionRatio(ratio float64) Option {
+	return func(o *ReaderOptions) { o.MaxCompressionRatio = ratio }
+}
+
+// WithMaxXMLDepth limits element nesting in EPUB XML documents.
+func WithMaxXMLDepth(n int) Option {
+	return func(o *ReaderOptions) { o.MaxXMLDepth = n }
+}
+
+// WithMaxXMLTokens limits the token count of EPUB XML documents.
+func WithMaxXMLTokens(n int) Option {
+	return func(o *ReaderOptions) { o.MaxXMLTokens = n }
+}
+
+// WithMaxXMLAttrs limits the attributes per element of EPUB XML documents.
+func WithMaxXMLAttrs(n int) Option {
+	return func(o *ReaderOptions) { o.MaxXMLAttrs = n }
+}
+
+// WithMaxNavDepth limits the nesting of NCX and nav document entries.
+func WithMaxNavDepth(n int) Option {
+	return func(o *ReaderOptions) { o.MaxNavDepth = n }
+}
+
+// WithMaxImagePixels limits the pixel count of images DecodeImage decodes.
+func WithMaxImagePixels(n int64) Option {
+	return func(o *ReaderOptions) { o.MaxImagePixels = n }
+}
+
+// WithSpillThreshold sets the StreamReader in-memory buffer limit.
+func WithSpillThreshold(n int64) Option {
+	return func(o *ReaderOptions) { o.SpillThreshold = n }
+}
+
+// WithItemCache caches up to maxBytes of decompressed manifest items.
+func WithItemCache(maxBytes int64) Option {
+	return func(o *ReaderOptions) { o.ItemCacheSize = maxBytes }
+}
+
+// WithCalibreSidecar makes OpenReader read a Calibre metadata.opf found
+// next to the book.
+func WithCalibreSidecar() Option {
+	return func(o *ReaderOptions) { o.CalibreSidecar = true }
+}
+
+// WithLimits copies every limit from limits (e.g. RecommendedLimits()),
+// leaving SpillThreshold, ItemCacheSize, CalibreSidecar, Mode and Logger
+// unchanged.
+func WithLimits(limits ReaderOptions) Option {
+	return func(o *ReaderOptions) {
+		limits.SpillThreshold, limits.ItemCacheSize = o.SpillThreshold, o.ItemCacheSize
+		limits.CalibreSidecar = o.CalibreSidecar
+		limits.Mode, limits.Logger = o.Mode, o.Logger
+		*o = limits
+	}
+}
+
+// WithMode sets the parsing mode.
+func WithMode(m Mode) Option {
+	return func(o *ReaderOptions) { o.Mode = m }
+}
+
+// WithLogger sets the logger that receives warnings.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *ReaderOptions) { o.Logger = l }
+}
+
+// newReaderOptions applies opts to the zero ReaderOptions.
+func newReaderOptions(opts []Option) ReaderOptions {
+	var o ReaderOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+func (o *ReaderOptions) strict() bool {
+	return o.Mode&ModeStrict != 0
+}
+
+func (o *ReaderOptions) lazy() bool {
+	return o.Mode&ModeLazy != 0
+}
+
+// warn records a recoverable problem and logs it to the configured logger,
+// if any.
+func (r *Reader) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	r.mu.Lock()
+	r.warnings = append(r.warnings, msg)
+	r.mu.Unlock()
+	if r.opts.Logger != nil {
+		r.opts.Logger.Warn(msg)
+	}
+}
+
+// Warnings returns the recoverable problems found while opening the EPUB,
+// in the order they occurred.
+func (r *Reader) Warnings() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.warnings[:len(r.warnings):len(r.warnings)]
+}
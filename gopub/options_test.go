@@ -0,0 +1,95 @@
+package gopub
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestOpenReaderHonoursOptions(t *testing.T) {
+	if _, err := OpenReader("_test_files/alice.epub", WithMaxFileSize(1000)); err != ErrFileTooLarge {
+		t.Errorf(expFormat, ErrFileTooLarge, err)
+	}
+	if _, err := OpenReader("_test_files/alice.epub", WithMaxEntries(3)); err != ErrTooManyEntries {
+		t.Errorf(expFormat, ErrTooManyEntries, err)
+	}
+}
+
+func TestManifestItemOpenMaxFileSize(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub", WithMaxFileSize(50000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cover := &r.DefaultRendition().Manifest.Items[0] // 53530 bytes
+	if _, err := cover.Open(); err != ErrFileTooLarge {
+		t.Errorf(expFormat, ErrFileTooLarge, err)
+	}
+	if _, err := cover.ReadAll(); err != ErrFileTooLarge {
+		t.Errorf(expFormat, ErrFileTooLarge, err)
+	}
+
+	small := r.DefaultRendition().Manifest.Images()[5] // a.png, 1976 bytes
+	data, err := small.ReadAll()
+	if err != nil || len(data) != 1976 {
+		t.Errorf(expFormat, 1976, len(data))
+	}
+}
+
+func TestModeStrictAndLogger(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0"><metadata/>
+  <manifest>
+    <item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch" href="ch2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="ch"/></spine>
+</package>`,
+		"OEBPS/ch.xhtml": "<html/>",
+	}
+	data := buildTestEpub(t, files)
+
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data)), WithMode(ModeStrict)); err != ErrDuplicateID {
+		t.Errorf(expFormat, ErrDuplicateID, err)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.DefaultRendition().Spine.Itemrefs[0].HREF; got != "ch2.xhtml" {
+		t.Errorf("duplicate id: "+expFormat, "ch2.xhtml", got)
+	}
+	for _, want := range []string{"duplicate manifest item id", "references missing file"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log missing %q: %s", want, logs.String())
+		}
+	}
+}
+
+func TestModeStrictRejectsMalformedXML(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata><dc:title xmlns:dc="http://purl.org/dc/elements/1.1/">Salt & Pepper</dc:title></metadata>
+  <manifest><item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="ch"/></spine>
+</package>`,
+		"OEBPS/ch.xhtml": "<html/>",
+	}
+	data := buildTestEpub(t, files)
+
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data)), WithMode(ModeStrict)); err == nil {
+		t.Error("strict mode accepted a bare '&'")
+	}
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.DefaultRendition().Metadata.MainTitle().Name; got != "Salt & Pepper" {
+		t.Errorf(expFormat, "Salt & Pepper", got)
+	}
+}
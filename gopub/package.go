@@ -69,14 +69,34 @@ type ManifestItem struct {
 	MediaType  string `xml:"media-type,attr"`
 	Properties string `xml:"properties,attr"`
 	F          *zip.File
+	// r is the Reader the item belongs to; its limits apply to Open and ReadAll.
+	r *Reader
 }
 
 // Open returns a ReadCloser that provides access to the item's contents.
+// The owning Reader's limits apply: the stream fails with ErrFileTooLarge
+// beyond MaxFileSize and ErrCompressionRatio beyond MaxCompressionRatio.
 func (item *ManifestItem) Open() (io.ReadCloser, error) {
 	if item.F == nil {
 		return nil, ErrBadManifest
 	}
-	return item.F.Open()
+	if item.r == nil {
+		return item.F.Open()
+	}
+	return item.r.openZipFile(item.F)
+}
+
+// ReadAll reads the item's contents, honouring the owning Reader's limits.
+func (item *ManifestItem) ReadAll() ([]byte, error) {
+	if item.r == nil {
+		f, err := item.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return item.r.readItem(item)
 }
 
 // Spine defines the reading order of the epub documents.
@@ -218,9 +238,22 @@ func resolveXHTMLCover(r *Reader, xhtmlItem *ManifestItem, rf *Rootfile) (*Manif
 }
 
 // GetCover returns the cover image manifest item, or an error if not found.
+// Only declared covers are considered; see FindCover for heuristic discovery.
+// A cover meta naming an item missing from the manifest falls back to the
+// guide's cover reference; ErrBadManifest is returned only if there is none.
 func (r *Reader) GetCover() (*ManifestItem, error) {
+	item, _, err := r.declaredCover()
+	return item, err
+}
+
+// declaredCover resolves the cover named by the cover meta / cover-image
+// property or the EPUB 2.0 guide, reporting which of the two matched.
+func (r *Reader) declaredCover() (*ManifestItem, CoverStrategy, error) {
 	if len(r.Container.Rootfiles) == 0 {
-		return nil, ErrNoRootfile
+		return nil, "", ErrNoRootfile
+	}
+	if err := r.Load(); err != nil {
+		return nil, "", err
 	}
 
 	hasCoverId := false
@@ -236,15 +269,13 @@ func (r *Reader) GetCover() (*ManifestItem, error) {
 			if item.ID != coverId {
 				continue
 			}
-			return unwrapCoverItem(r, item, rf)
+			item, err := unwrapCoverItem(r, item, rf)
+			return item, CoverFromMetadata, err
 		}
 	}
 
-	if hasCoverId {
-		return nil, ErrBadManifest
-	}
-
-	// EPUB 2.0 guide fallback: <reference type="cover" href="...">
+	// EPUB 2.0 guide fallback: <reference type="cover" href="...">. It is
+	// also used when the cover meta names an item missing from the manifest.
 	for _, rf := range r.Container.Rootfiles {
 		for _, ref := range rf.Guide.References {
 			if ref.Type != "cover" {
@@ -262,13 +293,17 @@ func (r *Reader) GetCover() (*ManifestItem, error) {
 				item := &rf.Manifest.Items[i]
 				itemAbs := path.Join(opfDir, item.HREF)
 				if itemAbs == resolved {
-					return unwrapCoverItem(r, item, rf)
+					item, err := unwrapCoverItem(r, item, rf)
+					return item, CoverFromGuide, err
 				}
 			}
 		}
 	}
 
-	return nil, ErrMissingCoverId
+	if hasCoverId {
+		return nil, "", ErrBadManifest
+	}
+	return nil, "", ErrMissingCoverId
 }
 
 // unwrapCoverItem resolves SVG and XHTML wrappers to find the underlying image.
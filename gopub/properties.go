@@ -0,0 +1,224 @@
+package gopub
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+)
+
+// contentProperties are the manifest properties EPUB 3 requires on XHTML
+// content documents that use the corresponding feature, in sorted order.
+var contentProperties = []string{"mathml", "remote-resources", "scripted", "svg", "switch"}
+
+// PropertyReport compares the content properties (mathml,
+// remote-resources, scripted, svg and switch) an XHTML manifest item needs
+// with those it declares. Other properties, such as nav, are ignored.
+type PropertyReport struct {
+	Item     *ManifestItem
+	Needed   []string
+	Declared []string
+	// Missing are needed but not declared; Unneeded declared but not needed.
+	Missing  []string
+	Unneeded []string
+}
+
+// OK reports whether the declared properties match the needed ones.
+func (p *PropertyReport) OK() bool {
+	return len(p.Missing) == 0 && len(p.Unneeded) == 0
+}
+
+// DetectProperties parses the XHTML content document read from r and
+// returns the content properties it needs, sorted:
+//   - mathml for MathML
+//   - remote-resources for images, media, stylesheets, scripts, frames or
+//     CSS url()s loaded from http(s) URLs; hyperlinks do not count
+//   - scripted for JavaScript, event handler attributes and forms
+//   - svg for inline SVG
+//   - switch for epub:switch
+func DetectProperties(r io.Reader) ([]string, error) {
+	doc, err := xhtml.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	features := scanContent(doc)
+	var props []string
+	for _, p := range contentProperties {
+		if features[p] {
+			props = append(props, p)
+		}
+	}
+	return props, nil
+}
+
+// AnalyzeProperties detects the content properties each XHTML item of rf
+// needs and compares them with its declared properties. Items whose file
+// is missing or does not parse are skipped.
+func (rf *Rootfile) AnalyzeProperties() ([]PropertyReport, error) {
+	if err := rf.Load(); err != nil {
+		return nil, err
+	}
+	var reports []PropertyReport
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		if item.F == nil || item.MediaType != MediaTypeXHTML {
+			continue
+		}
+		data, err := item.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		needed, err := DetectProperties(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		report := PropertyReport{Item: item, Needed: needed}
+		for _, p := range strings.Fields(item.Properties) {
+			if slices.Contains(contentProperties, p) {
+				report.Declared = append(report.Declared, p)
+				if !slices.Contains(needed, p) {
+					report.Unneeded = append(report.Unneeded, p)
+				}
+			}
+		}
+		for _, p := range needed {
+			if !slices.Contains(report.Declared, p) {
+				report.Missing = append(report.Missing, p)
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// FixProperties sets the content properties of every XHTML item of rf to
+// those it needs, keeping its other properties, and returns the reports of
+// the items it changed.
+func (rf *Rootfile) FixProperties() ([]PropertyReport, error) {
+	reports, err := rf.AnalyzeProperties()
+	if err != nil {
+		return nil, err
+	}
+	var fixed []PropertyReport
+	for _, report := range reports {
+		if report.OK() {
+			continue
+		}
+		props := slices.DeleteFunc(strings.Fields(report.Item.Properties), func(p string) bool {
+			return slices.Contains(contentProperties, p)
+		})
+		report.Item.Properties = strings.Join(append(props, report.Needed...), " ")
+		fixed = append(fixed, report)
+	}
+	return fixed, nil
+}
+
+// contentFeatures returns the features the XHTML document item uses: the
+// content properties DetectProperties reports plus "audio" and "video" for
+// media elements. Other items and documents that do not parse have none.
+func contentFeatures(item *ManifestItem) (map[string]bool, error) {
+	if item.F == nil || item.MediaType != MediaTypeXHTML {
+		return make(map[string]bool), nil
+	}
+	data, err := item.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := xhtml.Parse(bytes.NewReader(data))
+	if err != nil {
+		return make(map[string]bool), nil
+	}
+	return scanContent(doc), nil
+}
+
+// resourceAttrs are the attributes through which elements load resources.
+var resourceAttrs = map[atom.Atom][]string{
+	atom.Img:    {"src", "srcset"},
+	atom.Audio:  {"src"},
+	atom.Video:  {"src", "poster"},
+	atom.Source: {"src", "srcset"},
+	atom.Track:  {"src"},
+	atom.Iframe: {"src"},
+	atom.Embed:  {"src"},
+	atom.Object: {"data"},
+	atom.Script: {"src"},
+	atom.Input:  {"src"},
+}
+
+// cssURL matches url() references and @import strings in CSS.
+var cssURL = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")\s]+)|@import\s+['"]([^'"]+)`)
+
+func scanContent(doc *html.Node) map[string]bool {
+	features := make(map[string]bool)
+	xhtml.Walk(doc, func(n *html.Node) {
+		for _, a := range n.Attr {
+			switch {
+			case a.Key == "style":
+				features["remote-resources"] = features["remote-resources"] || cssIsRemote(a.Val)
+			case n.Namespace == "svg" && (a.Key == "href" || a.Key == "xlink:href"):
+				features["remote-resources"] = features["remote-resources"] || n.Data == "image" && isRemote(a.Val)
+			case n.Namespace == "" && len(a.Key) > 2 && strings.HasPrefix(strings.ToLower(a.Key), "on"):
+				features["scripted"] = true
+			}
+		}
+		switch {
+		case n.Namespace == "svg":
+			features["svg"] = features["svg"] || n.Data == "svg"
+			features["scripted"] = features["scripted"] || n.Data == "script"
+			return
+		case n.Namespace == "math":
+			if n.Data == "math" {
+				features["mathml"] = true
+			}
+			return
+		case n.Data == "switch" || n.Data == "epub:switch":
+			features["switch"] = true
+		case n.DataAtom == atom.Script && isJavaScript(xhtml.Attr(n, "type")), n.DataAtom == atom.Form:
+			features["scripted"] = true
+		case n.DataAtom == atom.Audio || n.DataAtom == atom.Video:
+			features[n.Data] = true
+		case n.DataAtom == atom.Style && n.FirstChild != nil:
+			features["remote-resources"] = features["remote-resources"] || cssIsRemote(n.FirstChild.Data)
+		case n.DataAtom == atom.Link && strings.Contains(strings.ToLower(xhtml.Attr(n, "rel")), "stylesheet"):
+			features["remote-resources"] = features["remote-resources"] || isRemote(xhtml.Attr(n, "href"))
+		}
+		for _, key := range resourceAttrs[n.DataAtom] {
+			urls := []string{xhtml.Attr(n, key)}
+			if key == "srcset" {
+				urls = strings.Split(urls[0], ",")
+			}
+			for _, url := range urls {
+				url, _, _ = strings.Cut(strings.TrimSpace(url), " ")
+				features["remote-resources"] = features["remote-resources"] || isRemote(url)
+			}
+		}
+	})
+	return features
+}
+
+// isJavaScript reports whether a script element's type attribute names
+// JavaScript rather than a data block such as JSON.
+func isJavaScript(typ string) bool {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	return typ == "" || typ == "module" || strings.Contains(typ, "javascript") || strings.Contains(typ, "ecmascript")
+}
+
+func isRemote(url string) bool {
+	url = strings.ToLower(strings.TrimSpace(url))
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "//")
+}
+
+func cssIsRemote(css string) bool {
+	for _, m := range cssURL.FindAllStringSubmatch(css, -1) {
+		if isRemote(m[1]) || isRemote(m[2]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package gopub
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectProperties(t *testing.T) {
+	const head = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>`
+	for body, want := range map[string]string{
+		`<p>Plain <a href="https://example.com/">link</a></p>`:                    "",
+		`<script>run()</script>`:                                                  "scripted",
+		`<script type="application/ld+json">{}</script>`:                          "",
+		`<p onclick="f()">x</p>`:                                                  "scripted",
+		`<form><input type="text"/></form>`:                                       "scripted",
+		`<math xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math>`:      "mathml",
+		`<svg xmlns="http://www.w3.org/2000/svg"><script>f()</script></svg>`:      "scripted svg",
+		`<img src="https://example.com/a.png" alt=""/>`:                           "remote-resources",
+		`<img srcset="a.png 1x, //cdn.example.com/b.png 2x" src="a.png" alt=""/>`: "remote-resources",
+		`<p style="background: url('http://example.com/bg.png')">x</p>`:           "remote-resources",
+		`<style>@import "https://example.com/a.css";</style>`:                     "remote-resources",
+		`<audio src="a.mp3"/><video src="v.mp4"/>`:                                "",
+		`<epub:switch id="s"><epub:case required-namespace="x"/></epub:switch>`:   "switch",
+		`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">` +
+			`<image xlink:href="http://example.com/i.png"/></svg>`: "remote-resources svg",
+	} {
+		got, err := DetectProperties(strings.NewReader(head + body + "</body></html>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("%s: "+expFormat, body, want, strings.Join(got, " "))
+		}
+	}
+}
+
+func TestFixProperties(t *testing.T) {
+	src := testWriterRootfile("3.0")
+	src.Manifest.Items = []ManifestItem{
+		{ID: "nav", HREF: "nav.xhtml", MediaType: MediaTypeXHTML, Properties: "nav svg"},
+		{ID: "ch1", HREF: "ch1.xhtml", MediaType: MediaTypeXHTML, Properties: "scripted"},
+		{ID: "ch2", HREF: "ch2.xhtml", MediaType: MediaTypeXHTML, Properties: "mathml"},
+		{ID: "cover", HREF: "cover.png", MediaType: MediaTypePNG, Properties: "cover-image"},
+	}
+	r := writeTestEpub(t, src, map[string]string{
+		"OEBPS/nav.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><nav/></body></html>`,
+		"OEBPS/ch1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><script>f()</script></body></html>`,
+		"OEBPS/ch2.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body>` +
+			`<svg xmlns="http://www.w3.org/2000/svg"/><img src="http://example.com/a.png" alt=""/></body></html>`,
+		"OEBPS/cover.png": "png",
+	})
+	rf := r.DefaultRendition()
+
+	reports, err := rf.AnalyzeProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 || !reports[1].OK() {
+		t.Fatalf("reports: %+v", reports)
+	}
+	nav, ch2 := reports[0], reports[2]
+	if !slices.Equal(nav.Unneeded, []string{"svg"}) || len(nav.Missing) != 0 {
+		t.Errorf("nav: %+v", nav)
+	}
+	if !slices.Equal(ch2.Missing, []string{"remote-resources", "svg"}) || !slices.Equal(ch2.Unneeded, []string{"mathml"}) {
+		t.Errorf("ch2: %+v", ch2)
+	}
+
+	fixed, err := rf.FixProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) != 2 {
+		t.Errorf("fixed: "+expFormat, 2, len(fixed))
+	}
+	want := map[string]string{"nav": "nav", "ch1": "scripted", "ch2": "remote-resources svg", "cover": "cover-image"}
+	for _, item := range rf.Manifest.Items {
+		if item.Properties != want[item.ID] {
+			t.Errorf("%s properties: "+expFormat, item.ID, want[item.ID], item.Properties)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package gopub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Record formats recognised by ParseRecord.
+const (
+	RecordONIX    = "onix"
+	RecordMARCXML = "marcxml"
+)
+
+// Record is a parsed view of the key fields of a linked ONIX 3.0 or MARCXML
+// metadata record.
+type Record struct {
+	Format          string
+	Title           string
+	Subtitle        string
+	Contributors    []RecordContributor
+	Identifiers     []Identifier // Scheme is "ISBN", "GTIN-13", "ISSN", "LCCN", …
+	Publisher       string
+	PublicationDate string
+	Language        []string
+	Subjects        []string
+	Description     string
+}
+
+// RecordContributor is a person or organisation named in a Record.
+// Role is the ONIX contributor role code (e.g. "A01") or MARC relator term.
+type RecordContributor struct {
+	Name string
+	Role string
+}
+
+// LinkedRecord reads and parses the local metadata record referenced by l
+// with ParseRecord. ONIX records are parsed only if package gopub/onix is
+// imported, for example blank-imported; otherwise they, like records of any
+// other unregistered format, return an error wrapping ErrUnsupportedRecord
+// that names the record's root element.
+func (r *Reader) LinkedRecord(l *Link) (*Record, error) {
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+	if l.F == nil {
+		return nil, ErrBadLink
+	}
+	data, err := r.readZipFile(l.F)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRecord(data)
+}
+
+var (
+	recordMu sync.RWMutex
+	// recordParsers maps record root element names to parsers.
+	recordParsers = map[string]func([]byte) (*Record, error){
+		"collection": parseMARCRecord,
+		"record":     parseMARCRecord,
+	}
+)
+
+// RegisterRecordFormat makes ParseRecord hand records whose root element
+// has one of the given local names to parse. MARCXML is built in; package
+// onix registers ONIX 3.0 when it is imported.
+func RegisterRecordFormat(parse func(data []byte) (*Record, error), roots ...string) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	for _, root := range roots {
+		recordParsers[root] = parse
+	}
+}
+
+// ParseRecord parses a MARCXML record, or an ONIX 3.0 record if package
+// onix is imported, detecting the format from the root element. Returns an
+// error wrapping ErrUnsupportedRecord for anything else.
+func ParseRecord(data []byte) (*Record, error) {
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, ErrUnsupportedRecord
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			root = start.Name.Local
+			break
+		}
+	}
+
+	recordMu.RLock()
+	parse := recordParsers[root]
+	recordMu.RUnlock()
+	if parse == nil {
+		return nil, fmt.Errorf("%w: no parser registered for <%s>", ErrUnsupportedRecord, root)
+	}
+	return parse(data)
+}
+
+type marcRecord struct {
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []marcDataField `xml:"datafield"`
+}
+
+type marcDataField struct {
+	Tag       string `xml:"tag,attr"`
+	Subfields []struct {
+		Code  string `xml:"code,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"subfield"`
+}
+
+// subfield returns the first subfield with the given code.
+func (f *marcDataField) subfield(code string) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return strings.TrimSpace(sf.Value)
+		}
+	}
+	return ""
+}
+
+// isbdSubfield returns the first subfield with the given code, stripped of
+// trailing ISBD punctuation (e.g. "Alice's adventures in Wonderland /").
+func (f *marcDataField) isbdSubfield(code string) string {
+	return strings.TrimRight(f.subfield(code), " /:;,.")
+}
+
+func parseMARCRecord(data []byte) (*Record, error) {
+	var coll struct {
+		XMLName xml.Name
+		Record  []marcRecord `xml:"record"`
+		marcRecord
+	}
+	if err := xmlDecodeBytes(data, &coll); err != nil {
+		return nil, err
+	}
+	m := coll.marcRecord
+	if coll.XMLName.Local == "collection" {
+		if len(coll.Record) == 0 {
+			return nil, ErrUnsupportedRecord
+		}
+		m = coll.Record[0]
+	}
+
+	rec := &Record{Format: RecordMARCXML}
+	for _, cf := range m.ControlFields {
+		// 008/35-37 holds the language code.
+		if cf.Tag == "008" && len(cf.Value) >= 38 {
+			if lang := strings.TrimSpace(cf.Value[35:38]); lang != "" {
+				rec.Language = append(rec.Language, lang)
+			}
+		}
+	}
+	for i := range m.DataFields {
+		f := &m.DataFields[i]
+		switch f.Tag {
+		case "010":
+			if v := f.subfield("a"); v != "" {
+				rec.Identifiers = append(rec.Identifiers, Identifier{Scheme: "LCCN", Value: v})
+			}
+		case "020":
+			if v := f.subfield("a"); v != "" {
+				// Strip qualifiers such as "9780000000000 (pbk.)".
+				v, _, _ = strings.Cut(v, " ")
+				rec.Identifiers = append(rec.Identifiers, Identifier{Scheme: "ISBN", Value: v})
+			}
+		case "022":
+			if v := f.subfield("a"); v != "" {
+				rec.Identifiers = append(rec.Identifiers, Identifier{Scheme: "ISSN", Value: v})
+			}
+		case "041":
+			if v := f.subfield("a"); v != "" && len(rec.Language) == 0 {
+				rec.Language = append(rec.Language, v)
+			}
+		case "100", "110", "700", "710":
+			if v := f.isbdSubfield("a"); v != "" {
+				rec.Contributors = append(rec.Contributors, RecordContributor{Name: v, Role: f.isbdSubfield("e")})
+			}
+		case "245":
+			rec.Title = f.isbdSubfield("a")
+			rec.Subtitle = f.isbdSubfield("b")
+		case "260", "264":
+			if rec.Publisher == "" {
+				rec.Publisher = f.isbdSubfield("b")
+			}
+			if rec.PublicationDate == "" {
+				rec.PublicationDate = f.isbdSubfield("c")
+			}
+		case "520":
+			if rec.Description == "" {
+				rec.Description = f.subfield("a")
+			}
+		case "600", "610", "650", "651", "655":
+			if v := f.isbdSubfield("a"); v != "" {
+				rec.Subjects = append(rec.Subjects, v)
+			}
+		}
+	}
+	return rec, nil
+}
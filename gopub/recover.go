@@ -0,0 +1,465 @@
+package gopub
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/LapisApple/go-epub/gopub/internal/ziplimit"
+)
+
+const (
+	localHeaderLen   = 30
+	zip64ExtraID     = 0x0001
+	flagEncrypted    = 0x1
+	flagDescriptor   = 0x8
+	flagUTF8         = 0x800
+	uint32Overflow   = 0xFFFFFFFF
+	descriptorSigLen = 4
+)
+
+var (
+	localHeaderSig = []byte("PK\x03\x04")
+	descriptorSig  = []byte("PK\x07\x08")
+)
+
+// RecoveryReport describes how an EPUB with a damaged ZIP central directory
+// was salvaged by ModeRecover.
+type RecoveryReport struct {
+	// Cause is the error zip.NewReader returned for the original file.
+	Cause error
+	// Recovered lists the entries salvaged from their local file headers.
+	Recovered []string
+	// Unrecoverable lists the entries that were found but could not be read.
+	Unrecoverable []UnrecoverableEntry
+}
+
+// UnrecoverableEntry is a local file header whose data could not be salvaged.
+type UnrecoverableEntry struct {
+	// Name is the entry name, or "" if the header itself is truncated.
+	Name string
+	// Offset is the position of the local file header in the file.
+	Offset int64
+	Err    error
+}
+
+func (e UnrecoverableEntry) Error() string {
+	return fmt.Sprintf("epub: unrecoverable zip entry %q at offset %d: %v", e.Name, e.Offset, e.Err)
+}
+
+// Recovery returns the report of a ModeRecover salvage, or nil if the ZIP
+// central directory was intact.
+func (r *Reader) Recovery() *RecoveryReport {
+	return r.recovery
+}
+
+// openZip opens ra as a ZIP archive. If the central directory is missing or
+// corrupt and ModeRecover is set, the entries are salvaged from their local
+// file headers instead.
+func (r *Reader) openZip(ra io.ReaderAt, size int64) (*zip.Reader, error) {
+	z, err := zip.NewReader(ra, size)
+	if err == nil || r.opts.Mode&ModeRecover == 0 {
+		return z, err
+	}
+	z, report, rerr := recoverZip(ra, size, &r.opts)
+	if rerr != nil {
+		return nil, fmt.Errorf("%w (recovery failed: %w)", err, rerr)
+	}
+	report.Cause = err
+	r.recovery = report
+	r.warn("epub: zip central directory unreadable (%v); recovered %d entries, %d unrecoverable",
+		err, len(report.Recovered), len(report.Unrecoverable))
+	for _, u := range report.Unrecoverable {
+		r.warn("%v", u)
+	}
+	return z, nil
+}
+
+// recoverZip scans ra for local file headers and opens the entries whose
+// data is complete and passes its CRC check through a central directory
+// synthesized after the end of ra. The scan reads ra in chunks and stops
+// with an error once opts' entry count, total size or compression ratio
+// limits are exceeded; entries larger than MaxFileSize are unrecoverable.
+func recoverZip(ra io.ReaderAt, size int64, opts *ReaderOptions) (*zip.Reader, *RecoveryReport, error) {
+	s := &recoverScan{ra: ra, size: size, opts: opts}
+	report := &RecoveryReport{}
+	var entries []localEntry
+	for off := int64(0); ; {
+		hdr, err := s.find(localHeaderSig, off, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr < 0 {
+			break
+		}
+		if opts.MaxEntries > 0 && len(entries)+len(report.Unrecoverable) >= opts.MaxEntries {
+			return nil, nil, ErrTooManyEntries
+		}
+		e, err := s.parseLocalEntry(hdr)
+		switch {
+		case s.err != nil:
+			return nil, nil, s.err
+		case errors.Is(err, ErrTotalSizeTooLarge), errors.Is(err, ErrCompressionRatio):
+			return nil, nil, err
+		case err != nil:
+			report.Unrecoverable = append(report.Unrecoverable, UnrecoverableEntry{Name: e.hdr.Name, Offset: hdr, Err: err})
+			off = hdr + int64(len(localHeaderSig))
+			continue
+		}
+		entries = append(entries, e)
+		report.Recovered = append(report.Recovered, e.hdr.Name)
+		off = e.next
+	}
+	if len(entries) == 0 {
+		return nil, nil, errors.New("no readable local file headers")
+	}
+	dir := centralDirectory(entries, size)
+	z, err := zip.NewReader(&appendedReaderAt{ra: ra, size: size, tail: dir}, size+int64(len(dir)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return z, report, nil
+}
+
+// recoverScan reads a damaged archive for recoverZip, counting the bytes
+// it decompresses against the limits.
+type recoverScan struct {
+	ra    io.ReaderAt
+	size  int64
+	opts  *ReaderOptions
+	total int64 // bytes decompressed so far
+	buf   []byte
+	// err is the first read error from ra other than io.EOF.
+	err error
+}
+
+func (s *recoverScan) ReadAt(p []byte, off int64) (int, error) {
+	n, err := s.ra.ReadAt(p, off)
+	if err != nil && !errors.Is(err, io.EOF) && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// find returns the offset of the first sig in [off, limit), or -1.
+func (s *recoverScan) find(sig []byte, off, limit int64) (int64, error) {
+	if s.buf == nil {
+		s.buf = make([]byte, 64<<10)
+	}
+	for off < limit {
+		n, err := s.ReadAt(s.buf[:min(int64(len(s.buf)), limit-off)], off)
+		if i := bytes.Index(s.buf[:n], sig); i >= 0 {
+			return off + int64(i), nil
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+		if err != nil || n < len(sig) {
+			break
+		}
+		// Overlap chunks so signatures spanning a boundary are found.
+		off += int64(n - len(sig) + 1)
+	}
+	return -1, nil
+}
+
+// localEntry is a ZIP entry parsed from its local file header.
+type localEntry struct {
+	hdr    zip.FileHeader
+	offset int64 // of the local file header
+	next   int64 // offset just past the entry and its data descriptor
+}
+
+// parseLocalEntry parses the local file header at off and verifies the
+// entry's data against its CRC-32 and uncompressed size. On error, the
+// returned entry carries the name if the header was readable.
+func (s *recoverScan) parseLocalEntry(off int64) (localEntry, error) {
+	e := localEntry{offset: off}
+	h := make([]byte, localHeaderLen)
+	if _, err := s.ReadAt(h, off); err != nil {
+		return e, io.ErrUnexpectedEOF
+	}
+	le := binary.LittleEndian
+	flags := le.Uint16(h[6:])
+	method := le.Uint16(h[8:])
+	crc := le.Uint32(h[14:])
+	csize := uint64(le.Uint32(h[18:]))
+	usize := uint64(le.Uint32(h[22:]))
+	nameLen := int(le.Uint16(h[26:]))
+	extraLen := int(le.Uint16(h[28:]))
+	nameExtra := make([]byte, nameLen+extraLen)
+	if _, err := s.ReadAt(nameExtra, off+localHeaderLen); err != nil {
+		return e, io.ErrUnexpectedEOF
+	}
+	start := off + localHeaderLen + int64(nameLen+extraLen)
+	e.hdr = zip.FileHeader{
+		Name:         string(nameExtra[:nameLen]),
+		Flags:        flags & flagUTF8,
+		Method:       method,
+		ModifiedTime: le.Uint16(h[10:]),
+		ModifiedDate: le.Uint16(h[12:]),
+	}
+	if flags&flagEncrypted != 0 {
+		return e, errors.New("encrypted entry")
+	}
+	if method != zip.Store && method != zip.Deflate {
+		return e, zip.ErrAlgorithm
+	}
+	if csize == uint32Overflow || usize == uint32Overflow {
+		csize, usize = zip64Sizes(nameExtra[nameLen:], csize, usize)
+	}
+
+	var (
+		sum uint32
+		n   uint64
+		err error
+	)
+	switch {
+	case flags&flagDescriptor == 0:
+		if csize > uint64(s.size-start) {
+			return e, io.ErrUnexpectedEOF
+		}
+		sum, n, _, err = s.inflate(start, int64(csize), method)
+		e.next = start + int64(csize)
+	case method == zip.Deflate:
+		// Deflate streams are self-terminating; the descriptor follows.
+		var consumed int64
+		sum, n, consumed, err = s.inflate(start, s.size-start, method)
+		if err != nil {
+			return e, err
+		}
+		csize = uint64(consumed)
+		crc, usize, e.next, err = s.readDescriptor(start, start+consumed)
+	default:
+		var end int64
+		end, crc, usize, e.next, err = s.findStoredDescriptor(start)
+		if err != nil {
+			return e, err
+		}
+		csize = uint64(end - start)
+		sum, n, _, err = s.inflate(start, int64(csize), method)
+	}
+	if err != nil {
+		return e, err
+	}
+	if sum != crc || n != usize {
+		return e, zip.ErrChecksum
+	}
+	e.hdr.CRC32 = crc
+	e.hdr.CompressedSize64 = csize
+	e.hdr.UncompressedSize64 = usize
+	return e, nil
+}
+
+// inflate decompresses up to csize bytes of entry data at start and
+// returns its CRC-32, uncompressed size and the compressed bytes consumed.
+// It fails with ErrFileTooLarge, ErrTotalSizeTooLarge or ErrCompressionRatio
+// as soon as the output exceeds a limit.
+func (s *recoverScan) inflate(start, csize int64, method uint16) (uint32, uint64, int64, error) {
+	cr := &countingReader{br: bufio.NewReader(io.NewSectionReader(s, start, csize))}
+	var rd io.Reader = cr
+	if method == zip.Deflate {
+		fr := flate.NewReader(cr)
+		defer fr.Close()
+		rd = fr
+	}
+	h := crc32.NewIEEE()
+	buf := make([]byte, 32<<10)
+	var n int64
+	for {
+		k, err := rd.Read(buf)
+		h.Write(buf[:k])
+		n += int64(k)
+		s.total += int64(k)
+		consumed := cr.n
+		switch {
+		case s.opts.MaxFileSize > 0 && n > s.opts.MaxFileSize:
+			return 0, 0, 0, ErrFileTooLarge
+		case s.opts.MaxTotalSize > 0 && s.total > s.opts.MaxTotalSize:
+			return 0, 0, 0, ErrTotalSizeTooLarge
+		case ziplimit.ExceedsRatio(uint64(n), uint64(consumed), s.opts.MaxCompressionRatio):
+			return 0, 0, 0, ErrCompressionRatio
+		}
+		if err == io.EOF {
+			return h.Sum32(), uint64(n), consumed, nil
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+}
+
+// readDescriptor reads the data descriptor following the compressed data
+// [start, end) of an entry, with or without its signature and in 32- or
+// 64-bit form.
+func (s *recoverScan) readDescriptor(start, end int64) (crc uint32, usize uint64, next int64, err error) {
+	d := make([]byte, descriptorSigLen+20)
+	n, _ := s.ReadAt(d, end)
+	d = d[:n]
+	next = end
+	if bytes.HasPrefix(d, descriptorSig) {
+		d = d[descriptorSigLen:]
+		next += descriptorSigLen
+	}
+	if len(d) < 12 {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	le := binary.LittleEndian
+	crc = le.Uint32(d)
+	if uint64(le.Uint32(d[4:])) == uint64(end-start) {
+		return crc, uint64(le.Uint32(d[8:])), next + 12, nil
+	}
+	if len(d) >= 20 && le.Uint64(d[4:]) == uint64(end-start) {
+		return crc, le.Uint64(d[12:]), next + 20, nil
+	}
+	return 0, 0, 0, zip.ErrFormat
+}
+
+// findStoredDescriptor scans stored data starting at start for a data
+// descriptor whose size matches its distance from start. The scan gives
+// up with ErrFileTooLarge beyond MaxFileSize.
+func (s *recoverScan) findStoredDescriptor(start int64) (end int64, crc uint32, usize uint64, next int64, err error) {
+	limit := s.size
+	if s.opts.MaxFileSize > 0 {
+		limit = min(limit, start+s.opts.MaxFileSize+descriptorSigLen)
+	}
+	le := binary.LittleEndian
+	d := make([]byte, 12)
+	for off := start; ; off = end + 1 {
+		end, err = s.find(descriptorSig, off, limit)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		if end < 0 {
+			if limit < s.size {
+				return 0, 0, 0, 0, ErrFileTooLarge
+			}
+			return 0, 0, 0, 0, io.ErrUnexpectedEOF
+		}
+		if n, _ := s.ReadAt(d, end+descriptorSigLen); n == len(d) && uint64(le.Uint32(d[4:])) == uint64(end-start) {
+			return end, le.Uint32(d), uint64(le.Uint32(d[8:])), end + descriptorSigLen + 12, nil
+		}
+	}
+}
+
+// appendedReaderAt reads the first size bytes of ra followed by tail.
+type appendedReaderAt struct {
+	ra   io.ReaderAt
+	size int64
+	tail []byte
+}
+
+func (a *appendedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	if off < a.size {
+		m := int(min(int64(len(p)), a.size-off))
+		k, err := a.ra.ReadAt(p[:m], off)
+		if k < m {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return k, err
+		}
+		n = m
+	}
+	if tailOff := off + int64(n) - a.size; n < len(p) && tailOff < int64(len(a.tail)) {
+		n += copy(p[n:], a.tail[tailOff:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// centralDirectory returns a ZIP central directory and end record listing
+// entries, for placement at offset dirOffset after them.
+func centralDirectory(entries []localEntry, dirOffset int64) []byte {
+	le := binary.LittleEndian
+	var b []byte
+	for _, e := range entries {
+		// ZIP64 extra fields hold only the values that overflow, in this order.
+		var extra []byte
+		field := func(v uint64) uint32 {
+			if v < uint32Overflow {
+				return uint32(v)
+			}
+			extra = le.AppendUint64(extra, v)
+			return uint32Overflow
+		}
+		usize := field(e.hdr.UncompressedSize64)
+		csize := field(e.hdr.CompressedSize64)
+		offset := field(uint64(e.offset))
+		version := uint16(20)
+		if len(extra) > 0 {
+			extra = append(le.AppendUint16(le.AppendUint16(nil, zip64ExtraID), uint16(len(extra))), extra...)
+			version = 45
+		}
+		b = le.AppendUint32(b, 0x02014b50)
+		b = le.AppendUint16(b, version) // made by
+		b = le.AppendUint16(b, version) // needed
+		b = le.AppendUint16(b, e.hdr.Flags)
+		b = le.AppendUint16(b, e.hdr.Method)
+		b = le.AppendUint16(b, e.hdr.ModifiedTime)
+		b = le.AppendUint16(b, e.hdr.ModifiedDate)
+		b = le.AppendUint32(b, e.hdr.CRC32)
+		b = le.AppendUint32(b, csize)
+		b = le.AppendUint32(b, usize)
+		b = le.AppendUint16(b, uint16(len(e.hdr.Name)))
+		b = le.AppendUint16(b, uint16(len(extra)))
+		b = append(b, make([]byte, 6)...) // comment length, disk, internal attributes
+		b = le.AppendUint32(b, 0)         // external attributes
+		b = le.AppendUint32(b, offset)
+		b = append(b, e.hdr.Name...)
+		b = append(b, extra...)
+	}
+
+	count, size, offset := uint64(len(entries)), uint64(len(b)), uint64(dirOffset)
+	if count >= 0xFFFF || size >= uint32Overflow || offset >= uint32Overflow {
+		end64 := offset + size
+		b = le.AppendUint32(b, 0x06064b50)
+		b = le.AppendUint64(b, 44) // size of the remaining record
+		b = le.AppendUint16(b, 45)
+		b = le.AppendUint16(b, 45)
+		b = append(b, make([]byte, 8)...) // disk numbers
+		b = le.AppendUint64(b, count)
+		b = le.AppendUint64(b, count)
+		b = le.AppendUint64(b, size)
+		b = le.AppendUint64(b, offset)
+		b = le.AppendUint32(b, 0x07064b50)
+		b = le.AppendUint32(b, 0)
+		b = le.AppendUint64(b, end64)
+		b = le.AppendUint32(b, 1)
+		count, size, offset = 0xFFFF, uint32Overflow, uint32Overflow
+	}
+	b = le.AppendUint32(b, 0x06054b50)
+	b = append(b, make([]byte, 4)...) // disk numbers
+	b = le.AppendUint16(b, uint16(count))
+	b = le.AppendUint16(b, uint16(count))
+	b = le.AppendUint32(b, uint32(size))
+	b = le.AppendUint32(b, uint32(offset))
+	return le.AppendUint16(b, 0) // comment length
+}
+
+// zip64Sizes reads the sizes from a ZIP64 extended information extra field,
+// returning csize and usize unchanged if there is none.
+func zip64Sizes(extra []byte, csize, usize uint64) (uint64, uint64) {
+	le := binary.LittleEndian
+	for len(extra) >= 4 {
+		id, n := le.Uint16(extra), int(le.Uint16(extra[2:]))
+		extra = extra[4:]
+		if n > len(extra) {
+			break
+		}
+		if id == zip64ExtraID && n >= 16 {
+			return le.Uint64(extra[8:]), le.Uint64(extra)
+		}
+		extra = extra[n:]
+	}
+	return csize, usize
+}
@@ -0,0 +1,156 @@
+package gopub
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecoverTruncatedEpub(t *testing.T) {
+	data, err := os.ReadFile("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Recovery() != nil {
+		t.Error("intact file reported a recovery")
+	}
+	cd := bytes.Index(data, []byte("PK\x01\x02"))
+	if cd < 0 {
+		t.Fatal("no central directory in fixture")
+	}
+
+	t.Run("no central directory", func(t *testing.T) {
+		trunc := data[:cd]
+		if _, err := NewReader(bytes.NewReader(trunc), int64(len(trunc))); !errors.Is(err, zip.ErrFormat) {
+			t.Fatalf(expFormat, zip.ErrFormat, err)
+		}
+		r, err := NewReader(bytes.NewReader(trunc), int64(len(trunc)), WithMode(ModeRecover))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep := r.Recovery()
+		if rep == nil || !errors.Is(rep.Cause, zip.ErrFormat) {
+			t.Fatalf("unexpected report %+v", rep)
+		}
+		if len(rep.Recovered) != len(full.entries) || len(rep.Unrecoverable) != 0 {
+			t.Errorf(expFormat, len(full.entries), len(rep.Recovered))
+		}
+		if got, want := r.Rootfiles[0].Metadata.MainTitle(), full.Rootfiles[0].Metadata.MainTitle(); got != want {
+			t.Errorf(expFormat, want, got)
+		}
+		if _, err := r.Rootfiles[0].Manifest.Items[0].ReadAll(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("corrupt entry", func(t *testing.T) {
+		cover := full.Rootfiles[0].Manifest.Items[0].F
+		hdr := bytes.Index(data, []byte(cover.Name)) - localHeaderLen
+		damaged := bytes.Clone(data[:cd])
+		damaged[hdr+localHeaderLen+len(cover.Name)+1000] ^= 0xFF
+		r, err := NewReader(bytes.NewReader(damaged), int64(len(damaged)), WithMode(ModeRecover))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep := r.Recovery()
+		if len(rep.Recovered) != len(full.entries)-1 || len(rep.Unrecoverable) != 1 {
+			t.Fatalf("recovered %d, unrecoverable %v", len(rep.Recovered), rep.Unrecoverable)
+		}
+		if u := rep.Unrecoverable[0]; u.Name != cover.Name || u.Offset != int64(hdr) {
+			t.Errorf("unexpected entry %+v", u)
+		}
+		if r.Rootfiles[0].Manifest.Items[0].F != nil {
+			t.Error("corrupt entry resolved to a file")
+		}
+	})
+
+	t.Run("truncated entry", func(t *testing.T) {
+		last := bytes.LastIndex(data[:cd], localHeaderSig)
+		trunc := data[:last+(cd-last)/2]
+		_, rep, err := recoverZip(bytes.NewReader(trunc), int64(len(trunc)), &ReaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rep.Recovered) != len(full.entries)-1 || len(rep.Unrecoverable) != 1 {
+			t.Fatalf("recovered %d, unrecoverable %v", len(rep.Recovered), rep.Unrecoverable)
+		}
+		if !errors.Is(rep.Unrecoverable[0].Err, io.ErrUnexpectedEOF) {
+			t.Errorf(expFormat, io.ErrUnexpectedEOF, rep.Unrecoverable[0].Err)
+		}
+	})
+}
+
+func TestRecoverDataDescriptors(t *testing.T) {
+	// zip.Writer writes data descriptors for both stored and deflated entries.
+	data := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf": limitsTestOPF,
+		"OEBPS/ch.xhtml":    "<html><body>chapter</body></html>",
+		"OEBPS/toc.ncx":     nestedNavPoints(2),
+	})
+	var stored bytes.Buffer
+	zw := zip.NewWriter(&stored)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/stored.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("stored PK\x07\x08 payload"))
+	zw.Close()
+	cd := bytes.Index(data, []byte("PK\x01\x02"))
+	storedCD := bytes.Index(stored.Bytes(), []byte("PK\x01\x02"))
+	trunc := append(data[:cd:cd], stored.Bytes()[:storedCD]...)
+
+	r, err := NewReader(bytes.NewReader(trunc), int64(len(trunc)), WithMode(ModeRecover))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Recovery().Recovered); n != 6 {
+		t.Errorf(expFormat, 6, n)
+	}
+	got, err := r.readZipFile(r.files["OEBPS/stored.txt"])
+	if err != nil || string(got) != "stored PK\x07\x08 payload" {
+		t.Errorf("stored entry: %q, %v", got, err)
+	}
+}
+
+func TestRecoverLimits(t *testing.T) {
+	data := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf": limitsTestOPF,
+		"OEBPS/ch.xhtml":    "<html/>",
+		"OEBPS/toc.ncx":     nestedNavPoints(2),
+		"OEBPS/zeros.bin":   strings.Repeat("\x00", 1<<20),
+	})
+	trunc := data[:bytes.Index(data, []byte("PK\x01\x02"))]
+	open := func(limits ReaderOptions) (*Reader, error) {
+		return NewReader(bytes.NewReader(trunc), int64(len(trunc)), WithMode(ModeRecover), WithLimits(limits))
+	}
+
+	for name, tt := range map[string]struct {
+		limits ReaderOptions
+		want   error
+	}{
+		"ratio":   {ReaderOptions{MaxCompressionRatio: 50}, ErrCompressionRatio},
+		"total":   {ReaderOptions{MaxTotalSize: 1 << 19}, ErrTotalSizeTooLarge},
+		"entries": {ReaderOptions{MaxEntries: 3}, ErrTooManyEntries},
+	} {
+		if _, err := open(tt.limits); !errors.Is(err, tt.want) {
+			t.Errorf("%s: "+expFormat, name, tt.want, err)
+		}
+	}
+
+	r, err := open(ReaderOptions{MaxFileSize: 1 << 19})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := r.Recovery().Unrecoverable
+	if len(u) != 1 || u[0].Name != "OEBPS/zeros.bin" || !errors.Is(u[0].Err, ErrFileTooLarge) {
+		t.Errorf("unrecoverable: %v", u)
+	}
+}
@@ -0,0 +1,219 @@
+package singlehtml
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+)
+
+var (
+	cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssURL     = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+	cssImport  = regexp.MustCompile(`@import\s+(?:url\(\s*)?["']?([^"')\s;]+)["']?\s*\)?[^;]*;`)
+)
+
+// maxImportDepth bounds @import nesting.
+const maxImportDepth = 8
+
+// loadCSS reads the stylesheet at the ZIP path name with its url()
+// references embedded and its @import rules inlined. seen guards against
+// import cycles.
+func (e *exporter) loadCSS(name string, seen map[string]bool) (string, error) {
+	if seen[name] || len(seen) > maxImportDepth {
+		return "", nil
+	}
+	item := e.items[name]
+	if item == nil {
+		return "", nil
+	}
+	seen[name] = true
+	defer delete(seen, name)
+
+	data, err := item.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	css := cssComment.ReplaceAllString(string(data), "")
+	css = cssImport.ReplaceAllStringFunc(css, func(rule string) string {
+		if err != nil {
+			return ""
+		}
+		href := cssImport.FindStringSubmatch(rule)[1]
+		target, _, ok := xhtml.Resolve(name, href)
+		if !ok || e.items[target] == nil {
+			return ""
+		}
+		var imported string
+		imported, err = e.loadCSS(target, seen)
+		return imported
+	})
+	if err != nil {
+		return "", err
+	}
+	css = e.rewriteURLs(name, css, &err)
+	return css, err
+}
+
+// rewriteURLs replaces url() references in css, found in the ZIP entry
+// from, with data URIs. The first error is stored in *errp.
+func (e *exporter) rewriteURLs(from, css string, errp *error) string {
+	return cssURL.ReplaceAllStringFunc(css, func(m string) string {
+		sub := cssURL.FindStringSubmatch(m)
+		href := sub[1] + sub[2] + sub[3]
+		target, _, ok := xhtml.Resolve(from, href)
+		if !ok || e.items[target] == nil {
+			return m
+		}
+		uri, err := e.dataURI(target)
+		if err != nil {
+			if *errp == nil {
+				*errp = err
+			}
+			return m
+		}
+		return `url("` + uri + `")`
+	})
+}
+
+// scopeCSS prefixes every selector in css with scope, so that the rules
+// only apply inside elements matching it. Selectors on html, body or :root
+// are replaced by scope. Rules inside @media, @supports and similar blocks
+// are scoped too; other at-rules such as @font-face and @keyframes are
+// kept as they are.
+func scopeCSS(css, scope string) string {
+	var b strings.Builder
+	for {
+		css = strings.TrimSpace(css)
+		i := strings.IndexAny(css, "{;}")
+		if i < 0 {
+			return b.String()
+		}
+		prelude := strings.TrimSpace(css[:i])
+		switch css[i] {
+		case ';':
+			if strings.HasPrefix(prelude, "@") && !strings.HasPrefix(prelude, "@charset") {
+				b.WriteString(prelude + ";\n")
+			}
+			css = css[i+1:]
+			continue
+		case '}':
+			css = css[i+1:]
+			continue
+		}
+		end := closingBrace(css, i)
+		body := css[i+1 : end]
+		css = css[min(end+1, len(css)):]
+		switch {
+		case isGroupingRule(prelude):
+			b.WriteString(prelude + " {\n" + scopeCSS(body, scope) + "}\n")
+		case strings.HasPrefix(prelude, "@"):
+			b.WriteString(prelude + " {" + body + "}\n")
+		default:
+			b.WriteString(scopeSelectors(prelude, scope) + " {" + body + "}\n")
+		}
+	}
+}
+
+// closingBrace returns the index of the brace closing the one at open, or
+// len(css) if it is unterminated. Braces inside strings are ignored.
+func closingBrace(css string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+func isGroupingRule(prelude string) bool {
+	for _, at := range []string{"@media", "@supports", "@layer", "@container", "@document", "@-moz-document"} {
+		if strings.HasPrefix(prelude, at) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeSelectors scopes each selector of a comma-separated list.
+func scopeSelectors(list, scope string) string {
+	var out []string
+	depth, start := 0, 0
+	for i := 0; i <= len(list); i++ {
+		if i < len(list) {
+			switch list[i] {
+			case '(', '[':
+				depth++
+			case ')', ']':
+				depth--
+			}
+			if list[i] != ',' || depth > 0 {
+				continue
+			}
+		}
+		if sel := strings.TrimSpace(list[start:i]); sel != "" {
+			out = append(out, scopeSelector(sel, scope))
+		}
+		start = i + 1
+	}
+	return strings.Join(out, ", ")
+}
+
+func scopeSelector(sel, scope string) string {
+	rest, matched := sel, false
+	for {
+		head := rootPrefix(rest)
+		if head == "" {
+			break
+		}
+		matched = true
+		after := rest[len(head):]
+		if after != "" && strings.ContainsRune(".#:[", rune(after[0])) {
+			return scope + after // compound selector on the root, e.g. body.dark p
+		}
+		rest = strings.TrimLeft(after, " \t\n>")
+	}
+	switch {
+	case !matched:
+		return scope + " " + sel
+	case rest == "":
+		return scope
+	}
+	return scope + " " + rest
+}
+
+// rootPrefix returns the html, body or :root selector s starts with, or "".
+func rootPrefix(s string) string {
+	for _, r := range []string{"html", "body", ":root"} {
+		if strings.HasPrefix(s, r) && !isIdentByte(s, len(r)) {
+			return r
+		}
+	}
+	return ""
+}
+
+// isIdentByte reports whether s[i] continues a CSS identifier.
+func isIdentByte(s string, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+	c := s[i]
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
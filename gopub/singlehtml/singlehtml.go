@@ -0,0 +1,473 @@
+// Package singlehtml exports an EPUB rendition as one self-contained HTML
+// file: spine documents are concatenated in order, stylesheets are inlined
+// with selectors scoped to the documents that link them, and images and
+// fonts are embedded as data URIs.
+package singlehtml
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TOCID is the id of the generated table of contents.
+const TOCID = "toc"
+
+// Write writes the spine of rf to w as a single HTML document with a table
+// of contents built from the nav document, or the NCX for EPUB 2.
+// Cross-document links become in-page links; ids that occur in more than
+// one document are prefixed with a per-document key.
+func Write(w io.Writer, rf *gopub.Rootfile) error {
+	if err := rf.Load(); err != nil {
+		return err
+	}
+	e := newExporter(rf)
+	if err := e.parse(); err != nil {
+		return err
+	}
+	e.assignIDs()
+	for _, doc := range e.docs {
+		if err := e.rewrite(doc); err != nil {
+			return err
+		}
+	}
+	css, err := e.stylesheets()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	e.writeHead(bw, css)
+	e.writeTOC(bw)
+	for _, doc := range e.docs {
+		if err := e.writeDocument(bw, doc); err != nil {
+			return err
+		}
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// WriteFile writes the spine of rf to the HTML file name.
+func WriteFile(name string, rf *gopub.Rootfile) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, rf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// document is a parsed spine document.
+type document struct {
+	path    string // ZIP path
+	key     string // id of the document's section
+	root    *nethtml.Node
+	body    *nethtml.Node
+	ids     map[string]string // original id -> id in the output
+	sheets  []string          // ZIP paths of linked stylesheets
+	styles  []string          // contents of <style> elements
+	classes []string          // scope classes of the section
+}
+
+type exporter struct {
+	rf     *gopub.Rootfile
+	items  map[string]*gopub.ManifestItem // by ZIP path
+	docs   []*document
+	byPath map[string]*document
+	data   map[string]string // data URIs by ZIP path
+}
+
+func newExporter(rf *gopub.Rootfile) *exporter {
+	e := &exporter{
+		rf:     rf,
+		items:  make(map[string]*gopub.ManifestItem),
+		byPath: make(map[string]*document),
+		data:   make(map[string]string),
+	}
+	for i := range rf.Manifest.Items {
+		if item := &rf.Manifest.Items[i]; item.F != nil {
+			e.items[item.F.Name] = item
+		}
+	}
+	return e
+}
+
+// parse reads every spine document, in spine order.
+func (e *exporter) parse() error {
+	for i := range e.rf.Spine.Itemrefs {
+		item := e.rf.Spine.Itemrefs[i].ManifestItem
+		if item == nil || item.F == nil || e.byPath[item.F.Name] != nil {
+			continue
+		}
+		rc, err := item.Open()
+		if err != nil {
+			return err
+		}
+		root, err := xhtml.Parse(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", item.F.Name, err)
+		}
+		doc := &document{path: item.F.Name, root: root, ids: make(map[string]string)}
+		if doc.body = xhtml.Find(root, atom.Body); doc.body == nil {
+			doc.body = root
+		}
+		e.docs = append(e.docs, doc)
+		e.byPath[doc.path] = doc
+	}
+	return nil
+}
+
+// assignIDs picks section ids for the documents and renames ids that occur
+// in more than one document, or clash with a generated id.
+func (e *exporter) assignIDs() {
+	count := map[string]int{TOCID: 1}
+	for _, doc := range e.docs {
+		seen := make(map[string]bool)
+		xhtml.Walk(doc.root, func(n *nethtml.Node) {
+			if id := xhtml.Attr(n, "id"); id != "" && !seen[id] {
+				seen[id] = true
+				count[id]++
+			}
+		})
+	}
+	used := make(map[string]bool)
+	for id := range count {
+		used[id] = true
+	}
+	for _, doc := range e.docs {
+		base := path.Base(doc.path)
+		doc.key = xhtml.UniqueName(used, xhtml.AnchorName(strings.TrimSuffix(base, path.Ext(base))))
+	}
+	for _, doc := range e.docs {
+		xhtml.Walk(doc.root, func(n *nethtml.Node) {
+			id := xhtml.Attr(n, "id")
+			if id == "" || doc.ids[id] != "" {
+				return
+			}
+			if count[id] > 1 {
+				doc.ids[id] = xhtml.UniqueName(used, doc.key+"-"+id)
+			} else {
+				doc.ids[id] = id
+			}
+		})
+	}
+}
+
+// link returns the in-page or data URI replacement for href found in the
+// ZIP entry from, or href itself if it leaves the book.
+func (e *exporter) link(from, href string) (string, error) {
+	target, frag, ok := xhtml.Resolve(from, href)
+	if !ok {
+		return href, nil
+	}
+	if doc := e.byPath[target]; doc != nil {
+		if id := doc.ids[frag]; id != "" {
+			return "#" + id, nil
+		}
+		return "#" + doc.key, nil
+	}
+	if e.items[target] != nil {
+		return e.dataURI(target)
+	}
+	return href, nil
+}
+
+// dataURI returns the contents of the manifest item at the ZIP path
+// target as a data URI.
+func (e *exporter) dataURI(target string) (string, error) {
+	if uri, ok := e.data[target]; ok {
+		return uri, nil
+	}
+	item := e.items[target]
+	data, err := item.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	mediaType := item.MediaType
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(path.Ext(target))
+	}
+	uri := "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	e.data[target] = uri
+	return uri, nil
+}
+
+// resourceAttrs lists, per element, the attributes embedded as data URIs.
+var resourceAttrs = map[string][]string{
+	"img":    {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+	"source": {"src"},
+	"track":  {"src"},
+	"embed":  {"src"},
+	"object": {"data"},
+	"image":  {"xlink:href", "href"},
+}
+
+// rewrite renames ids, rewrites links and embeds resources in doc, and
+// collects the stylesheets it uses.
+func (e *exporter) rewrite(doc *document) error {
+	var remove []*nethtml.Node
+	var err error
+	set := func(a *nethtml.Attribute, val string, ferr error) {
+		if ferr != nil && err == nil {
+			err = ferr
+		}
+		a.Val = val
+	}
+	xhtml.Walk(doc.root, func(n *nethtml.Node) {
+		switch {
+		case n.DataAtom == atom.Script:
+			remove = append(remove, n)
+			return
+		case n.DataAtom == atom.Link:
+			if hasToken(xhtml.Attr(n, "rel"), "stylesheet") {
+				if target, _, ok := xhtml.Resolve(doc.path, xhtml.Attr(n, "href")); ok && e.items[target] != nil {
+					doc.sheets = append(doc.sheets, target)
+				}
+				remove = append(remove, n)
+			}
+			return
+		case n.DataAtom == atom.Style:
+			doc.styles = append(doc.styles, e.rewriteURLs(doc.path, textContent(n), &err))
+			remove = append(remove, n)
+			return
+		}
+		for i := range n.Attr {
+			a := &n.Attr[i]
+			switch {
+			case a.Key == "id":
+				a.Val = doc.ids[a.Val]
+			case a.Key == "href" && (n.DataAtom == atom.A || n.DataAtom == atom.Area):
+				val, lerr := e.link(doc.path, a.Val)
+				set(a, val, lerr)
+			case a.Key == "style":
+				a.Val = e.rewriteURLs(doc.path, a.Val, &err)
+			case hasString(resourceAttrs[n.Data], a.Key):
+				if target, _, ok := xhtml.Resolve(doc.path, a.Val); ok && e.items[target] != nil {
+					val, derr := e.dataURI(target)
+					set(a, val, derr)
+				}
+			}
+		}
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+	return err
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *nethtml.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == nethtml.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+// stylesheets returns the scoped CSS of every manifest stylesheet linked
+// by a spine document, then of the documents' <style> elements, and sets
+// each document's scope classes.
+func (e *exporter) stylesheets() (string, error) {
+	var b strings.Builder
+	for i, item := range e.rf.Manifest.Stylesheets() {
+		if item.F == nil {
+			continue
+		}
+		var users []*document
+		for _, doc := range e.docs {
+			if hasString(doc.sheets, item.F.Name) {
+				users = append(users, doc)
+			}
+		}
+		if len(users) == 0 {
+			continue
+		}
+		css, err := e.loadCSS(item.F.Name, map[string]bool{})
+		if err != nil {
+			return "", err
+		}
+		scope := "epub-css-" + strconv.Itoa(i+1)
+		for _, doc := range users {
+			doc.classes = append(doc.classes, scope)
+		}
+		fmt.Fprintf(&b, "/* %s */\n%s", item.HREF, scopeCSS(css, "."+scope))
+	}
+	for _, doc := range e.docs {
+		if len(doc.styles) == 0 {
+			continue
+		}
+		scope := "epub-style-" + doc.key
+		doc.classes = append(doc.classes, scope)
+		for _, css := range doc.styles {
+			b.WriteString(scopeCSS(css, "."+scope))
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *exporter) writeHead(w *bufio.Writer, css string) {
+	md := &e.rf.Metadata
+	w.WriteString("<!DOCTYPE html>\n<html")
+	if lang := md.PrimaryLanguage(); lang != "" {
+		fmt.Fprintf(w, ` lang="%s"`, html.EscapeString(lang))
+	}
+	w.WriteString(">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(w, "<title>%s</title>\n", html.EscapeString(md.MainTitle().Name))
+	if css != "" {
+		// The CSS is written raw; only a closing tag could end it early.
+		w.WriteString("<style>\n" + strings.ReplaceAll(css, "</", `<\/`) + "</style>\n")
+	}
+	w.WriteString("</head>\n<body>\n")
+}
+
+// writeTOC writes a header with the title, creators and table of contents.
+func (e *exporter) writeTOC(w *bufio.Writer) {
+	md := &e.rf.Metadata
+	w.WriteString("<header>\n")
+	fmt.Fprintf(w, "<h1>%s</h1>\n", html.EscapeString(md.MainTitle().Name))
+	var creators []string
+	for _, c := range md.Creator {
+		creators = append(creators, html.EscapeString(c.Name))
+	}
+	if len(creators) > 0 {
+		fmt.Fprintf(w, "<p>%s</p>\n", strings.Join(creators, ", "))
+	}
+
+	if toc := e.rf.TOCNav(); toc != nil {
+		href, _ := url.PathUnescape(e.rf.NavDoc.HREF)
+		navPath := path.Join(path.Dir(e.rf.FullPath), href)
+		fmt.Fprintf(w, "<nav id=\"%s\">\n", TOCID)
+		e.writeNavItems(w, navPath, toc.Items)
+		w.WriteString("</nav>\n")
+	} else if len(e.rf.NCX.NavPoints) > 0 {
+		ncxPath := e.rf.FullPath
+		for item := range e.rf.Manifest.ByMediaType("application/x-dtbncx+xml") {
+			if item.F != nil {
+				ncxPath = item.F.Name
+				break
+			}
+		}
+		fmt.Fprintf(w, "<nav id=\"%s\">\n", TOCID)
+		e.writeNavPoints(w, ncxPath, e.rf.NCX.NavPoints)
+		w.WriteString("</nav>\n")
+	}
+	w.WriteString("</header>\n")
+}
+
+func (e *exporter) writeNavItems(w *bufio.Writer, from string, items []gopub.NavItem) {
+	if len(items) == 0 {
+		return
+	}
+	w.WriteString("<ol>\n")
+	for _, item := range items {
+		e.writeTOCEntry(w, from, item.Link.Href, item.Link.Text)
+		e.writeNavItems(w, from, item.SubItems)
+		w.WriteString("</li>\n")
+	}
+	w.WriteString("</ol>\n")
+}
+
+func (e *exporter) writeNavPoints(w *bufio.Writer, from string, points []gopub.NavPoint) {
+	if len(points) == 0 {
+		return
+	}
+	w.WriteString("<ol>\n")
+	for _, p := range points {
+		e.writeTOCEntry(w, from, p.Content.Src, p.NavLabel.Text)
+		e.writeNavPoints(w, from, p.NavPoints)
+		w.WriteString("</li>\n")
+	}
+	w.WriteString("</ol>\n")
+}
+
+// writeTOCEntry opens a TOC list item; the caller closes it.
+func (e *exporter) writeTOCEntry(w *bufio.Writer, from, href, text string) {
+	text = html.EscapeString(strings.TrimSpace(text))
+	if href == "" {
+		fmt.Fprintf(w, "<li><span>%s</span>\n", text)
+		return
+	}
+	if target, _, ok := xhtml.Resolve(from, href); ok && e.byPath[target] != nil {
+		href, _ = e.link(from, href)
+	}
+	fmt.Fprintf(w, "<li><a href=\"%s\">%s</a>\n", html.EscapeString(href), text)
+}
+
+// writeDocument writes doc's body as a section carrying the body's
+// attributes, so that scoped body selectors still match.
+func (e *exporter) writeDocument(w *bufio.Writer, doc *document) error {
+	section := &nethtml.Node{Type: nethtml.ElementNode, Data: "section", DataAtom: atom.Section}
+	classes := append([]string{"epub-doc"}, doc.classes...)
+	for _, a := range doc.body.Attr {
+		switch a.Key {
+		case "id":
+			// The section is addressed by the document key; keep the
+			// body's id on a marker so links to it still work.
+			continue
+		case "class":
+			classes = append(classes, strings.Fields(a.Val)...)
+		default:
+			section.Attr = append(section.Attr, a)
+		}
+	}
+	section.Attr = append([]nethtml.Attribute{
+		{Key: "id", Val: doc.key},
+		{Key: "class", Val: strings.Join(classes, " ")},
+	}, section.Attr...)
+	if id := xhtml.Attr(doc.body, "id"); id != "" {
+		section.AppendChild(&nethtml.Node{
+			Type: nethtml.ElementNode, Data: "span", DataAtom: atom.Span,
+			Attr: []nethtml.Attribute{{Key: "id", Val: id}},
+		})
+	}
+	for c := doc.body.FirstChild; c != nil; {
+		next := c.NextSibling
+		doc.body.RemoveChild(c)
+		section.AppendChild(c)
+		c = next
+	}
+	if err := nethtml.Render(w, section); err != nil {
+		return err
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
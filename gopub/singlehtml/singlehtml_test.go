@@ -0,0 +1,132 @@
+package singlehtml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LapisApple/go-epub/gopub"
+	"github.com/LapisApple/go-epub/gopub/internal/epubtest"
+)
+
+const testOPF = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Sample</dc:title>
+    <dc:creator>Ann Author</dc:creator>
+    <dc:identifier id="uid">urn:uuid:1</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="one" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="style/book.css" media-type="text/css"/>
+    <item id="font" href="fonts/serif.woff" media-type="font/woff"/>
+    <item id="pic" href="img/pic.png" media-type="image/png"/>
+  </manifest>
+  <spine><itemref idref="one"/><itemref idref="two"/></spine>
+</package>`
+
+const testNav = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+<nav epub:type="toc"><ol>
+<li><a href="text/one.xhtml">One</a><ol><li><a href="text/one.xhtml#sec">Section</a></li></ol></li>
+<li><a href="text/two.xhtml">Two</a></li>
+</ol></nav></body></html>`
+
+const testCSS = `@charset "utf-8";
+@font-face { font-family: Serif; src: url(../fonts/serif.woff); }
+body { margin: 0 }
+body.dark p, h1 { color: red }
+@media print { p { color: black } }
+/* a comment { } */`
+
+func chapter(body string) string {
+	return `<html xmlns="http://www.w3.org/1999/xhtml"><head>
+<link rel="stylesheet" href="../style/book.css"/><script src="x.js"></script></head>` + body + `</html>`
+}
+
+func testRendition(t *testing.T) *gopub.Rootfile {
+	return epubtest.Rendition(t, map[string]string{
+		"OEBPS/content.opf": testOPF,
+		"OEBPS/nav.xhtml":   testNav,
+		"OEBPS/text/one.xhtml": chapter(`<body class="dark"><h1 id="note">One</h1>
+<p id="sec">See <a href="two.xhtml#note">two</a> and <a href="#sec">here</a>.<a id="p1"/></p>
+<p><img src="../img/pic.png" alt=""/></p></body>`),
+		"OEBPS/text/two.xhtml":   chapter(`<body><h1 id="note">Two</h1><p><a href="one.xhtml">back</a></p></body>`),
+		"OEBPS/style/book.css":   testCSS,
+		"OEBPS/fonts/serif.woff": "wOFF",
+		"OEBPS/img/pic.png":      "png",
+	})
+}
+
+func TestWrite(t *testing.T) {
+	var out strings.Builder
+	if err := Write(&out, testRendition(t)); err != nil {
+		t.Fatal(err)
+	}
+	doc := out.String()
+	for _, want := range []string{
+		`<html lang="en">`,
+		"<title>Sample</title>",
+		`<li><a href="#one">One</a>`,
+		`<li><a href="#sec">Section</a>`,
+		`<section id="one" class="epub-doc epub-css-1 dark">`,
+		`<h1 id="one-note">One</h1>`,
+		`<h1 id="two-note">Two</h1>`,
+		`<a href="#two-note">two</a>`,
+		`<a href="#sec">here</a>`,
+		`<a id="p1"></a></p>`,
+		`<a href="#one">back</a>`,
+		`src="data:image/png;base64,cG5n"`,
+		`src: url("data:font/woff;base64,d09GRg==")`,
+		".epub-css-1 {",
+		".epub-css-1.dark p, .epub-css-1 h1 {",
+		"@media print {\n.epub-css-1 p {",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("output missing %q:\n%s", want, doc)
+		}
+	}
+	for _, unwanted := range []string{"<script", "<link", "@charset", "comment", "book.css\""} {
+		if strings.Contains(doc, unwanted) {
+			t.Errorf("output contains %q", unwanted)
+		}
+	}
+}
+
+func TestWriteMissingStylesheet(t *testing.T) {
+	opf := strings.Replace(testOPF, `<item id="css"`,
+		`<item id="gone" href="style/gone.css" media-type="text/css"/>
+    <item id="css"`, 1)
+	rf := epubtest.Rendition(t, map[string]string{
+		"OEBPS/content.opf":    opf,
+		"OEBPS/nav.xhtml":      testNav,
+		"OEBPS/text/one.xhtml": chapter(`<body><p>One</p></body>`),
+		"OEBPS/text/two.xhtml": chapter(`<body><p>Two</p></body>`),
+		"OEBPS/style/book.css": `@import "gone.css"; p { color: red }`,
+	})
+	var out strings.Builder
+	if err := Write(&out, rf); err != nil {
+		t.Fatal(err)
+	}
+	if doc := out.String(); !strings.Contains(doc, ".epub-css-2 p {") {
+		t.Errorf("output missing the scoped stylesheet:\n%s", doc)
+	}
+}
+
+func TestScopeSelectors(t *testing.T) {
+	for sel, want := range map[string]string{
+		"p":                ".s p",
+		"html body > div":  ".s div",
+		":root":            ".s",
+		"body#main .x, a":  ".s#main .x, .s a",
+		":is(h1, h2) span": ".s :is(h1, h2) span",
+		"bodytext":         ".s bodytext",
+	} {
+		if got := scopeSelectors(sel, ".s"); got != want {
+			t.Errorf("%q: "+expFormat, sel, want, got)
+		}
+	}
+}
+
+const expFormat = "Expected: %v, but got: %v\n"
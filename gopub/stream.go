@@ -0,0 +1,551 @@
+package gopub
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"iter"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/LapisApple/go-epub/gopub/internal/ziplimit"
+)
+
+// DefaultSpillThreshold is the number of bytes a StreamReader buffers in
+// memory before spilling to a temporary file when SpillThreshold is 0.
+const DefaultSpillThreshold = 16 << 20
+
+var (
+	centralHeaderSig = []byte("PK\x01\x02")
+	endOfDirSig      = []byte("PK\x05\x06")
+)
+
+// StreamReader reads an EPUB from a non-seekable io.Reader such as an HTTP
+// body or a pipe, in one pass over its local file headers.
+//
+// Only container.xml and package documents are buffered, spilling to a
+// temporary file beyond the SpillThreshold option. Rootfiles in Container
+// gain their Package as soon as both have been read; manifest items are not
+// backed by ZIP entries, so their Open methods fail with ErrBadManifest.
+type StreamReader struct {
+	Container
+	r       *Reader // options and XML decoding
+	br      *bufio.Reader
+	items   map[string]*ManifestItem
+	spooled map[string]*spool
+	parsed  map[*Rootfile]bool
+	tmp     *os.File
+	tmpSize int64
+	inMem   int64
+	entries int
+	total   int64
+	started bool
+}
+
+// StreamEntry is one file of a streamed EPUB. It is an io.Reader over the
+// decompressed contents, valid until the iteration advances.
+type StreamEntry struct {
+	Name     string
+	Modified time.Time
+	// ManifestItem is the entry's manifest item if its package document
+	// appeared earlier in the stream, or nil.
+	ManifestItem *ManifestItem
+	rd           io.Reader
+}
+
+func (e *StreamEntry) Read(p []byte) (int, error) {
+	return e.rd.Read(p)
+}
+
+// spool is a buffered entry, held in memory or in the temporary file.
+type spool struct {
+	mem     []byte
+	off, n  int64
+	spilled bool
+}
+
+// NewStreamReader returns a StreamReader consuming r. The MaxEntries,
+// MaxTotalSize and MaxFileSize limits apply to the decompressed stream.
+func NewStreamReader(r io.Reader, opts ...Option) *StreamReader {
+	return &StreamReader{
+		r:       &Reader{opts: newReaderOptions(opts)},
+		br:      bufio.NewReader(r),
+		items:   make(map[string]*ManifestItem),
+		spooled: make(map[string]*spool),
+		parsed:  make(map[*Rootfile]bool),
+	}
+}
+
+// Close removes the temporary spill file, if any.
+func (s *StreamReader) Close() error {
+	if s.tmp == nil {
+		return nil
+	}
+	name := s.tmp.Name()
+	s.tmp.Close()
+	s.tmp = nil
+	return os.Remove(name)
+}
+
+// Warnings returns the recoverable problems found so far.
+func (s *StreamReader) Warnings() []string {
+	return s.r.Warnings()
+}
+
+// Entries yields every file in the stream in archive order. Entries not
+// read by the loop body are skipped; all are CRC-checked. Once the stream
+// ends, a missing container.xml or package document is yielded as an
+// error. Entries may only be ranged over once.
+func (s *StreamReader) Entries() iter.Seq2[*StreamEntry, error] {
+	return func(yield func(*StreamEntry, error) bool) {
+		if s.started {
+			yield(nil, errors.New("epub: StreamReader entries already read"))
+			return
+		}
+		s.started = true
+		for {
+			e, finish, err := s.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(e, nil) {
+				return
+			}
+			if err := finish(); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+		if err := s.finishPackages(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// streamHeader is a parsed local file header.
+type streamHeader struct {
+	name          string
+	flags, method uint16
+	crc           uint32
+	csize, usize  uint64
+	modified      time.Time
+	hasDescriptor bool
+}
+
+// next reads the next local file header and returns its entry together
+// with a function that consumes the rest of the entry and verifies it.
+func (s *StreamReader) next() (*StreamEntry, func() error, error) {
+	h, err := s.readHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.entries++
+	if max := s.r.opts.MaxEntries; max > 0 && s.entries > max {
+		return nil, nil, ErrTooManyEntries
+	}
+
+	body, finish, err := s.body(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	e := &StreamEntry{Name: h.name, Modified: h.modified, rd: body}
+
+	if s.wantSpool(h.name) {
+		sp, err := s.spool(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := finish(); err != nil {
+			return nil, nil, err
+		}
+		s.spooled[h.name] = sp
+		if err := s.spooledPackage(h.name); err != nil {
+			return nil, nil, err
+		}
+		rd, err := s.open(sp)
+		if err != nil {
+			return nil, nil, err
+		}
+		e.rd, finish = rd, func() error { return nil }
+	}
+	e.ManifestItem = s.items[h.name]
+	return e, finish, nil
+}
+
+// readHeader reads a local file header, returning io.EOF at the central
+// directory or the end of the stream.
+func (s *StreamReader) readHeader() (streamHeader, error) {
+	var h streamHeader
+	sig, err := s.br.Peek(4)
+	if len(sig) < 4 || bytes.Equal(sig, centralHeaderSig) || bytes.Equal(sig, endOfDirSig) {
+		if err != nil && err != io.EOF {
+			return h, err
+		}
+		return h, io.EOF
+	}
+	if !bytes.Equal(sig, localHeaderSig) {
+		return h, zip.ErrFormat
+	}
+	var buf [localHeaderLen]byte
+	if _, err := io.ReadFull(s.br, buf[:]); err != nil {
+		return h, io.ErrUnexpectedEOF
+	}
+	le := binary.LittleEndian
+	h.flags = le.Uint16(buf[6:])
+	h.method = le.Uint16(buf[8:])
+	h.modified = msDosTime(le.Uint16(buf[12:]), le.Uint16(buf[10:]))
+	h.crc = le.Uint32(buf[14:])
+	h.csize = uint64(le.Uint32(buf[18:]))
+	h.usize = uint64(le.Uint32(buf[22:]))
+	h.hasDescriptor = h.flags&flagDescriptor != 0
+	rest := make([]byte, int(le.Uint16(buf[26:]))+int(le.Uint16(buf[28:])))
+	if _, err := io.ReadFull(s.br, rest); err != nil {
+		return h, io.ErrUnexpectedEOF
+	}
+	nameLen := int(le.Uint16(buf[26:]))
+	h.name = string(rest[:nameLen])
+	if h.csize == uint32Overflow || h.usize == uint32Overflow {
+		h.csize, h.usize = zip64Sizes(rest[nameLen:], h.csize, h.usize)
+	}
+	if h.flags&flagEncrypted != 0 {
+		return h, errors.New("epub: encrypted zip entry " + h.name)
+	}
+	if h.method != zip.Store && h.method != zip.Deflate {
+		return h, zip.ErrAlgorithm
+	}
+	return h, nil
+}
+
+// countingReader counts the bytes read from a bufio.Reader while keeping
+// io.ByteReader, so flate does not read past the end of its stream.
+type countingReader struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.br.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.br.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// checkedReader computes the CRC-32 and size of what it reads and enforces
+// MaxFileSize, MaxTotalSize and MaxCompressionRatio.
+type checkedReader struct {
+	rd  io.Reader
+	crc hash.Hash32
+	n   int64
+	s   *StreamReader
+	// compressed returns the compressed bytes consumed so far.
+	compressed func() uint64
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.rd.Read(p)
+	c.crc.Write(p[:n])
+	c.n += int64(n)
+	c.s.total += int64(n)
+	if max := c.s.r.opts.MaxFileSize; max > 0 && c.n > max {
+		return n, ErrFileTooLarge
+	}
+	if max := c.s.r.opts.MaxTotalSize; max > 0 && c.s.total > max {
+		return n, ErrTotalSizeTooLarge
+	}
+	if ziplimit.ExceedsRatio(uint64(c.n), c.compressed(), c.s.r.opts.MaxCompressionRatio) {
+		return n, ErrCompressionRatio
+	}
+	return n, err
+}
+
+// body returns the decompressed contents of the entry h and a function that
+// drains them, reads the data descriptor and verifies the checksum.
+func (s *StreamReader) body(h streamHeader) (io.Reader, func() error, error) {
+	var src io.Reader
+	var stored *storedScanner
+	counter := &countingReader{br: s.br}
+	compressed := func() uint64 { return h.csize }
+	switch {
+	case !h.hasDescriptor:
+		src = io.LimitReader(s.br, int64(h.csize))
+	case h.method == zip.Deflate:
+		src = counter
+		compressed = func() uint64 { return uint64(counter.n) }
+	default:
+		stored = &storedScanner{br: s.br}
+		src = stored
+		compressed = func() uint64 { return uint64(stored.n) }
+	}
+
+	var fr io.ReadCloser
+	rd := src
+	if h.method == zip.Deflate {
+		fr = flate.NewReader(src)
+		rd = fr
+	}
+	cr := &checkedReader{rd: rd, crc: crc32.NewIEEE(), s: s, compressed: compressed}
+
+	finish := func() error {
+		if _, err := io.Copy(io.Discard, cr); err != nil {
+			return err
+		}
+		if fr != nil {
+			fr.Close()
+		}
+		crc, usize := h.crc, h.usize
+		switch {
+		case stored != nil:
+			crc, usize = stored.crc, stored.usize
+		case h.hasDescriptor:
+			var err error
+			if crc, usize, err = s.readDescriptor(counter.n); err != nil {
+				return err
+			}
+		default:
+			if _, err := io.Copy(io.Discard, src); err != nil {
+				return err
+			}
+		}
+		if cr.crc.Sum32() != crc || uint64(cr.n) != usize {
+			return zip.ErrChecksum
+		}
+		return nil
+	}
+	return cr, finish, nil
+}
+
+// readDescriptor reads the data descriptor following a deflated entry of
+// csize compressed bytes.
+func (s *StreamReader) readDescriptor(csize int64) (uint32, uint64, error) {
+	le := binary.LittleEndian
+	d, _ := s.br.Peek(4 + 20)
+	skip := 0
+	if bytes.HasPrefix(d, descriptorSig) {
+		d, skip = d[4:], 4
+	}
+	if len(d) >= 12 && int64(le.Uint32(d[4:])) == csize {
+		_, err := s.br.Discard(skip + 12)
+		return le.Uint32(d), uint64(le.Uint32(d[8:])), err
+	}
+	if len(d) >= 20 && int64(le.Uint64(d[4:])) == csize {
+		_, err := s.br.Discard(skip + 20)
+		return le.Uint32(d), le.Uint64(d[12:]), err
+	}
+	return 0, 0, zip.ErrFormat
+}
+
+// storedScanner reads a stored entry written with a data descriptor, whose
+// end is only marked by a descriptor whose size matches the bytes before
+// it. The last bytes read are held back until they cannot start the
+// descriptor signature.
+type storedScanner struct {
+	br   *bufio.Reader
+	held []byte
+	n    int64 // bytes returned
+	done bool
+	// crc and usize are set from the descriptor once Read returns io.EOF.
+	crc   uint32
+	usize uint64
+}
+
+func (sc *storedScanner) Read(p []byte) (int, error) {
+	le := binary.LittleEndian
+	var n int
+	for n < len(p) && !sc.done {
+		b, err := sc.br.ReadByte()
+		if err != nil {
+			return n, io.ErrUnexpectedEOF
+		}
+		sc.held = append(sc.held, b)
+		if len(sc.held) < len(descriptorSig) {
+			continue
+		}
+		if bytes.Equal(sc.held, descriptorSig) {
+			if d, _ := sc.br.Peek(12); len(d) == 12 && int64(le.Uint32(d[4:])) == sc.n {
+				sc.crc, sc.usize, sc.done = le.Uint32(d), uint64(le.Uint32(d[8:])), true
+				sc.br.Discard(12)
+				break
+			}
+		}
+		p[n] = sc.held[0]
+		n++
+		sc.n++
+		sc.held = append(sc.held[:0], sc.held[1:]...)
+	}
+	if n == 0 && sc.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// wantSpool reports whether the entry must be buffered: container.xml and
+// anything that may be a package document.
+func (s *StreamReader) wantSpool(name string) bool {
+	if name == containerPath {
+		return true
+	}
+	if len(s.Rootfiles) > 0 {
+		for _, rf := range s.Rootfiles {
+			if rf.FullPath == name {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.EqualFold(path.Ext(name), ".opf")
+}
+
+// spool buffers rd in memory up to the spill threshold and in the
+// temporary file beyond it.
+func (s *StreamReader) spool(rd io.Reader) (*spool, error) {
+	threshold := s.r.opts.SpillThreshold
+	if threshold == 0 {
+		threshold = DefaultSpillThreshold
+	}
+	room := max(threshold-s.inMem, 0)
+	mem, err := io.ReadAll(io.LimitReader(rd, room+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(mem)) <= room {
+		s.inMem += int64(len(mem))
+		return &spool{mem: mem, n: int64(len(mem))}, nil
+	}
+
+	if s.tmp == nil {
+		if s.tmp, err = os.CreateTemp("", "gopub-stream-*"); err != nil {
+			return nil, err
+		}
+	}
+	sp := &spool{off: s.tmpSize, spilled: true}
+	if _, err := s.tmp.WriteAt(mem, sp.off); err != nil {
+		return nil, err
+	}
+	rest, err := io.Copy(io.NewOffsetWriter(s.tmp, sp.off+int64(len(mem))), rd)
+	if err != nil {
+		return nil, err
+	}
+	sp.n = int64(len(mem)) + rest
+	s.tmpSize += sp.n
+	return sp, nil
+}
+
+// open returns a reader over a spooled entry.
+func (s *StreamReader) open(sp *spool) (io.Reader, error) {
+	if !sp.spilled {
+		return bytes.NewReader(sp.mem), nil
+	}
+	return io.NewSectionReader(s.tmp, sp.off, sp.n), nil
+}
+
+// readSpool returns the full contents of a spooled entry.
+func (s *StreamReader) readSpool(sp *spool) ([]byte, error) {
+	rd, err := s.open(sp)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(rd)
+}
+
+// spooledPackage parses container.xml or a package document that has just
+// been spooled, once both are available.
+func (s *StreamReader) spooledPackage(name string) error {
+	if name == containerPath {
+		data, err := s.readSpool(s.spooled[name])
+		if err != nil {
+			return err
+		}
+		if err := s.r.decodeXML(data, &s.Container); err != nil {
+			if err == io.EOF {
+				return ErrBadContainerfile
+			}
+			return err
+		}
+		if len(s.Rootfiles) < 1 {
+			return ErrNoRootfile
+		}
+	}
+	for _, rf := range s.Rootfiles {
+		if sp := s.spooled[rf.FullPath]; sp != nil && !s.parsed[rf] {
+			if err := s.parsePackage(rf, sp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parsePackage decodes the package document of rf and indexes its manifest
+// items by ZIP path.
+func (s *StreamReader) parsePackage(rf *Rootfile, sp *spool) error {
+	data, err := s.readSpool(sp)
+	if err != nil {
+		return err
+	}
+	if err := s.r.decodeXML(data, &rf.Package); err != nil {
+		return err
+	}
+	if err := checkVersion(rf.Version); err != nil {
+		return err
+	}
+	setCoverProperty(rf)
+	processRefinements(&rf.Metadata)
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		href, _ := url.PathUnescape(item.HREF)
+		s.items[path.Join(path.Dir(rf.FullPath), href)] = item
+	}
+	s.parsed[rf] = true
+	return nil
+}
+
+// finishPackages reports a missing container.xml or package document once
+// the stream has ended.
+func (s *StreamReader) finishPackages() error {
+	if s.spooled[containerPath] == nil {
+		return ErrNoContainerfile
+	}
+	if len(s.Rootfiles) < 1 {
+		return ErrNoRootfile
+	}
+	for _, rf := range s.Rootfiles {
+		if !s.parsed[rf] {
+			return ErrBadRootfile
+		}
+	}
+	return nil
+}
+
+// msDosTime converts an MS-DOS date and time to a time.Time in UTC.
+func msDosTime(dosDate, dosTime uint16) time.Time {
+	return time.Date(
+		int(dosDate>>9+1980),
+		time.Month(dosDate>>5&0xf),
+		int(dosDate&0x1f),
+		int(dosTime>>11),
+		int(dosTime>>5&0x3f),
+		int(dosTime&0x1f*2),
+		0,
+		time.UTC,
+	)
+}
@@ -0,0 +1,159 @@
+package gopub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStreamReader(t *testing.T) {
+	data, err := os.ReadFile("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStreamReader(io.MultiReader(bytes.NewReader(data)))
+	defer s.Close()
+	n := 0
+	for e, err := range s.Entries() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := r.readZipFile(r.files[e.Name])
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: contents differ", e.Name)
+		}
+		if !e.Modified.Equal(r.files[e.Name].Modified) && !r.files[e.Name].Modified.IsZero() {
+			t.Errorf("%s: "+expFormat, e.Name, r.files[e.Name].Modified, e.Modified)
+		}
+		n++
+	}
+	if n != len(r.entries) {
+		t.Errorf(expFormat, len(r.entries), n)
+	}
+	if got, want := s.DefaultRendition().Metadata.MainTitle().Name, epubExpectations["alice.epub"].title; got != want {
+		t.Errorf(expFormat, want, got)
+	}
+}
+
+func TestStreamReaderPackageLast(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, content string, method uint16) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	add("mimetype", "application/epub+zip", zip.Store)
+	add("OEBPS/ch.xhtml", "<html>"+strings.Repeat("text ", 1000)+"</html>", zip.Deflate)
+	add("OEBPS/content.opf", limitsTestOPF, zip.Deflate)
+	add(containerPath, testContainer, zip.Store)
+	add("OEBPS/toc.ncx", nestedNavPoints(1), zip.Store)
+	// A stored entry with a data descriptor, containing a descriptor
+	// signature that does not end it.
+	big := strings.Repeat("image data PK\x07\x08", 10000)
+	add("OEBPS/big.bin", big, zip.Store)
+	zw.Close()
+
+	// A threshold smaller than the package document forces a spill to disk.
+	s := NewStreamReader(&buf, WithSpillThreshold(100))
+	defer s.Close()
+	var names []string
+	for e, err := range s.Entries() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved := e.ManifestItem != nil; resolved != (e.Name == "OEBPS/toc.ncx") {
+			t.Errorf("%s: manifest item resolved: %v", e.Name, resolved)
+		}
+		if e.Name == "OEBPS/big.bin" {
+			got, err := io.ReadAll(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != big {
+				t.Errorf("%s: contents differ", e.Name)
+			}
+		}
+		names = append(names, e.Name)
+	}
+	if len(names) != 6 {
+		t.Errorf(expFormat, 6, names)
+	}
+	if s.tmp == nil {
+		t.Error("package document not spilled to a temporary file")
+	}
+	if got := s.DefaultRendition().Metadata.MainTitle().Name; got != "Limits" {
+		t.Errorf(expFormat, "Limits", got)
+	}
+	if len(s.DefaultRendition().Spine.Itemrefs) != 1 {
+		t.Error("spine not parsed")
+	}
+	name := s.tmp.Name()
+	s.Close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("temporary file not removed: %v", err)
+	}
+}
+
+func TestStreamReaderErrors(t *testing.T) {
+	data := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf": limitsTestOPF,
+		"OEBPS/ch.xhtml":    strings.Repeat("x", 5000),
+	})
+	stream := func(data []byte, opts ...Option) error {
+		s := NewStreamReader(bytes.NewReader(data), opts...)
+		defer s.Close()
+		for _, err := range s.Entries() {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := stream(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream(data[:len(data)/2]); err == nil {
+		t.Error("truncated stream accepted")
+	}
+	if err := stream(data, WithMaxFileSize(1000)); err != ErrFileTooLarge {
+		t.Errorf(expFormat, ErrFileTooLarge, err)
+	}
+	if err := stream(data, WithMaxEntries(2)); err != ErrTooManyEntries {
+		t.Errorf(expFormat, ErrTooManyEntries, err)
+	}
+	bomb := buildTestEpub(t, map[string]string{
+		"OEBPS/content.opf": limitsTestOPF,
+		"OEBPS/ch.xhtml":    strings.Repeat("x", 1<<20),
+	})
+	if err := stream(bomb, WithMaxCompressionRatio(100)); err != ErrCompressionRatio {
+		t.Errorf(expFormat, ErrCompressionRatio, err)
+	}
+
+	corrupt := bytes.Clone(data)
+	i := bytes.Index(corrupt, []byte("OEBPS/ch.xhtml")) + len("OEBPS/ch.xhtml") + 3
+	corrupt[i] ^= 0xFF
+	if err := stream(corrupt); err == nil {
+		t.Error("corrupt entry accepted")
+	}
+
+	noContainer := buildTestEpub(t, map[string]string{containerPath: "", "OEBPS/ch.xhtml": "x"})
+	if err := stream(noContainer); err == nil {
+		t.Error("empty container accepted")
+	}
+}
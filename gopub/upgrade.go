@@ -0,0 +1,275 @@
+package gopub
+
+import (
+	"bytes"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/LapisApple/go-epub/gopub/internal/xhtml"
+)
+
+// landmarkTypes maps EPUB 2 guide reference types to EPUB 3 landmark
+// types. Types without an equivalent, such as "other.*", are dropped.
+var landmarkTypes = map[string]string{
+	"cover":            "cover",
+	"title-page":       "titlepage",
+	"toc":              "toc",
+	"index":            "index",
+	"glossary":         "glossary",
+	"acknowledgements": "acknowledgments",
+	"bibliography":     "bibliography",
+	"colophon":         "colophon",
+	"copyright-page":   "copyright-page",
+	"dedication":       "dedication",
+	"epigraph":         "epigraph",
+	"foreword":         "foreword",
+	"loi":              "loi",
+	"lot":              "lot",
+	"notes":            "endnotes",
+	"preface":          "preface",
+	"text":             "bodymatter",
+	"start":            "bodymatter",
+}
+
+// identifierURNs maps identifier schemes to the URN prefix EPUB 3 uses in
+// place of opf:scheme.
+var identifierURNs = map[string]string{"isbn": "urn:isbn:", "uuid": "urn:uuid:", "doi": "urn:doi:"}
+
+// Upgrade converts the EPUB 2 package rf to EPUB 3 in place:
+//   - a navigation document is added to the manifest, its toc built from
+//     the NCX and its landmarks from the guide; the NCX and guide stay for
+//     older readers
+//   - ISBN, UUID and DOI identifiers get their URN prefix, calibre series
+//     metas become Series and SeriesIndex, and the modification event, as a
+//     UTC timestamp, or the current time becomes Modified; WritePackage then
+//     writes file-as, role, title-type and other identifier schemes as
+//     refinements, and events with a DCMI term as dcterms: metas
+//   - the cover image gets the cover-image property, and XHTML documents
+//     the content properties FixProperties detects
+//   - Version becomes "3.0"
+//
+// The navigation document has no file yet; Rewrite generates it. Upgrade
+// does nothing to packages that are already EPUB 3.
+func (rf *Rootfile) Upgrade() error {
+	if err := rf.Load(); err != nil {
+		return err
+	}
+	if !rf.IsEPUB2() {
+		return nil
+	}
+	rf.upgradeMetadata()
+	rf.upgradeNav()
+	if err := rf.upgradeProperties(); err != nil {
+		return err
+	}
+	rf.Version = "3.0"
+	return nil
+}
+
+func (rf *Rootfile) upgradeMetadata() {
+	md := &rf.Metadata
+	for i := range md.Identifier {
+		id := &md.Identifier[i]
+		urn := identifierURNs[strings.ToLower(id.Scheme)]
+		if urn != "" && !strings.HasPrefix(strings.ToLower(id.Value), "urn:") {
+			id.Value = urn + strings.TrimSpace(id.Value)
+		}
+	}
+	if md.Modified == "" {
+		// dcterms:modified must be a full UTC timestamp, which the usually
+		// date-only modification event of EPUB 2 is not.
+		modified := time.Now()
+		for _, d := range md.Event {
+			if d.Name == "modification" {
+				if t, ok := parseCalibreTime(d.Date); ok {
+					modified = t
+				}
+				break
+			}
+		}
+		md.Modified = modified.UTC().Format(time.RFC3339)
+	}
+	if v := md.OtherTags["calibre:series"]; len(v) > 0 && md.Series == "" {
+		md.Series = v[0]
+		if v := md.OtherTags["calibre:series_index"]; len(v) > 0 {
+			md.SeriesIndex = v[0]
+		}
+	}
+	delete(md.OtherTags, "calibre:series")
+	delete(md.OtherTags, "calibre:series_index")
+}
+
+// upgradeNav adds a navigation document generated from the NCX and guide.
+func (rf *Rootfile) upgradeNav() {
+	if slices.ContainsFunc(rf.Manifest.Items, func(item ManifestItem) bool { return hasProperty(item.Properties, "nav") }) {
+		return
+	}
+	// NCX links are relative to the NCX, nav links to the nav document,
+	// which is stored next to the package document.
+	ncxDir := ""
+	for _, item := range rf.Manifest.Items {
+		if item.ID == rf.Spine.Toc || item.MediaType == MediaTypeNCX {
+			ncxDir = path.Dir(item.HREF)
+			break
+		}
+	}
+	var toc func([]NavPoint) []NavItem
+	toc = func(points []NavPoint) []NavItem {
+		var items []NavItem
+		for _, np := range points {
+			var item NavItem
+			item.Link.Text = strings.TrimSpace(np.NavLabel.Text)
+			item.Link.Href = rebaseHref(ncxDir, np.Content.Src)
+			item.SubItems = toc(np.NavPoints)
+			items = append(items, item)
+		}
+		return items
+	}
+	rf.NavDoc.Navs = []NavSection{{Type: "toc", Items: toc(rf.NCX.NavPoints)}}
+
+	var landmarks []NavItem
+	for _, ref := range rf.Guide.References {
+		typ := landmarkTypes[strings.ToLower(ref.Type)]
+		if typ == "" {
+			continue
+		}
+		var item NavItem
+		item.Link.Text = orDefault(ref.Title, typ)
+		item.Link.Href = ref.Href
+		item.Link.Type = typ
+		landmarks = append(landmarks, item)
+	}
+	if len(landmarks) > 0 {
+		rf.NavDoc.Navs = append(rf.NavDoc.Navs, NavSection{Type: "landmarks", Items: landmarks})
+	}
+
+	rf.NavDoc.HREF = rf.newHREF("nav", ".xhtml")
+	rf.addItem(ManifestItem{ID: rf.newID("nav"), HREF: rf.NavDoc.HREF, MediaType: MediaTypeXHTML, Properties: "nav"})
+}
+
+// upgradeProperties sets the cover-image property and the content
+// properties the XHTML documents need.
+func (rf *Rootfile) upgradeProperties() error {
+	cover := rf.coverImageID()
+	for i := range rf.Manifest.Items {
+		if item := &rf.Manifest.Items[i]; item.ID == cover {
+			item.Properties = addProperty(item.Properties, "cover-image")
+		}
+	}
+	_, err := rf.FixProperties()
+	return err
+}
+
+// coverImageID returns the id of the cover image: the one named by the
+// cover meta, or the first image of the guide's cover page.
+func (rf *Rootfile) coverImageID() string {
+	byHref := make(map[string]*ManifestItem)
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		if item.ID == rf.Metadata.CoverManifestId && strings.HasPrefix(item.MediaType, "image/") {
+			return item.ID
+		}
+		byHref[item.HREF] = item
+	}
+	for _, ref := range rf.Guide.References {
+		if ref.Type != "cover" {
+			continue
+		}
+		page := byHref[strings.SplitN(ref.Href, "#", 2)[0]]
+		if page == nil || page.F == nil {
+			return ""
+		}
+		if strings.HasPrefix(page.MediaType, "image/") {
+			return page.ID
+		}
+		data, err := page.ReadAll()
+		if err != nil {
+			return ""
+		}
+		doc, err := xhtml.Parse(bytes.NewReader(data))
+		if err != nil {
+			return ""
+		}
+		id := ""
+		xhtml.Walk(doc, func(n *html.Node) {
+			if id != "" || n.Data != "img" && n.Data != "image" {
+				return
+			}
+			for _, key := range []string{"src", "href", "xlink:href"} {
+				target, _, ok := xhtml.Resolve(page.HREF, xhtml.Attr(n, key))
+				if img := byHref[target]; ok && img != nil && strings.HasPrefix(img.MediaType, "image/") {
+					id = img.ID
+					return
+				}
+			}
+		})
+		return id
+	}
+	return ""
+}
+
+// rebaseHref makes href, found in a file in dir, relative to the package
+// document; dir is itself relative to the package document.
+func rebaseHref(dir, href string) string {
+	if dir == "." || dir == "" || strings.Contains(href, ":") {
+		return href
+	}
+	target, fragment, ok := xhtml.Resolve(dir+"/", href)
+	if !ok {
+		return href
+	}
+	if fragment != "" {
+		target += "#" + fragment
+	}
+	return target
+}
+
+// newID returns id, or id with the lowest numeric suffix that no manifest
+// item uses.
+func (rf *Rootfile) newID(id string) string {
+	used := func(id string) bool {
+		return slices.ContainsFunc(rf.Manifest.Items, func(item ManifestItem) bool { return item.ID == id })
+	}
+	return uniqueName(id, "", used)
+}
+
+// newHREF returns name+ext, or name with a numeric suffix, that no manifest
+// item uses.
+func (rf *Rootfile) newHREF(name, ext string) string {
+	used := func(href string) bool {
+		return slices.ContainsFunc(rf.Manifest.Items, func(item ManifestItem) bool { return strings.EqualFold(item.HREF, href) })
+	}
+	return uniqueName(name, ext, used)
+}
+
+func uniqueName(name, ext string, used func(string) bool) string {
+	candidate := name + ext
+	for i := 1; used(candidate); i++ {
+		candidate = name + "-" + strconv.Itoa(i) + ext
+	}
+	return candidate
+}
+
+// addItem appends item to the manifest and points the spine at the moved
+// items.
+func (rf *Rootfile) addItem(item ManifestItem) {
+	rf.Manifest.Items = append(rf.Manifest.Items, item)
+	for i := range rf.Spine.Itemrefs {
+		ref := &rf.Spine.Itemrefs[i]
+		if j := slices.IndexFunc(rf.Manifest.Items, func(item ManifestItem) bool { return item.ID == ref.IDREF }); j >= 0 {
+			ref.ManifestItem = &rf.Manifest.Items[j]
+		}
+	}
+}
+
+func addProperty(properties, p string) string {
+	if hasProperty(properties, p) {
+		return properties
+	}
+	return strings.TrimSpace(properties + " " + p)
+}
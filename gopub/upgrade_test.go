@@ -0,0 +1,196 @@
+package gopub
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func rewrite(t *testing.T, r *Reader) *Rootfile {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Rewrite(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.DefaultRendition()
+}
+
+func TestUpgrade(t *testing.T) {
+	src := testWriterRootfile("2.0")
+	src.Metadata.CoverManifestId = ""
+	src.Metadata.OtherTags = map[string][]string{"calibre:series": {"Saga"}, "calibre:series_index": {"4"}}
+	src.Metadata.Series, src.Metadata.SeriesIndex, src.Metadata.Modified = "", "", ""
+	src.Metadata.Event = append(src.Metadata.Event, Date{Name: "modification", Date: "2021-05-06"})
+	src.Manifest.Items = append(src.Manifest.Items, ManifestItem{ID: "cov", HREF: "text/cover.xhtml", MediaType: MediaTypeXHTML})
+	src.Guide.References = []GuideReference{
+		{Type: "cover", Title: "Cover", Href: "text/cover.xhtml"},
+		{Type: "text", Href: "ch1.xhtml"},
+		{Type: "other.ms-coverimage", Href: "cover.png"},
+	}
+	var sub NavPoint
+	sub.NavLabel.Text = "Section"
+	sub.Content.Src = "ch1.xhtml#s1"
+	src.NCX.NavPoints = src.NCX.NavPoints[:1]
+	src.NCX.NavPoints[0].NavPoints = []NavPoint{sub}
+	r := writeTestEpub(t, src, map[string]string{
+		"OEBPS/ch1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><p id="s1">Hi</p>` +
+			`<svg xmlns="http://www.w3.org/2000/svg"><rect/></svg><script>x()</script></body></html>`,
+		"OEBPS/text/cover.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><img src="../cover.png" alt=""/></body></html>`,
+		"OEBPS/cover.png":        "png",
+		"OEBPS/nav.xhtml":        "<html/>",
+	})
+
+	rf := r.DefaultRendition()
+	if err := rf.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	got := rewrite(t, r)
+	md := got.Metadata
+	if got.Version != "3.0" || md.Identifier[0].Value != "urn:isbn:9780000000002" {
+		t.Errorf("package: %q %+v", got.Version, md.Identifier)
+	}
+	if md.Series != "Saga" || md.SeriesIndex != "4" || md.Modified != "2021-05-06T00:00:00Z" || md.OtherTags["calibre:series"] != nil {
+		t.Errorf("metas: %q %q %q %v", md.Series, md.SeriesIndex, md.Modified, md.OtherTags)
+	}
+	if c := md.Creator[0]; c.FileAs != "Doe, Jane" || c.CreatorRole != "aut" {
+		t.Errorf("creator: %+v", c)
+	}
+	want := map[string]string{"nav-1": "nav", "ch1": "scripted svg", "cover": "cover-image"}
+	for _, item := range got.Manifest.Items {
+		if item.Properties != want[item.ID] {
+			t.Errorf("%s properties: "+expFormat, item.ID, want[item.ID], item.Properties)
+		}
+	}
+	toc := got.TOCNav()
+	if toc == nil || len(toc.Items) != 1 || toc.Items[0].SubItems[0].Link.Href != "ch1.xhtml#s1" {
+		t.Fatalf("toc: %+v", got.NavDoc)
+	}
+	l := got.LandmarksNav()
+	if l == nil || len(l.Items) != 2 || l.Items[0].Link.Type != "cover" || l.Items[1].Link.Type != "bodymatter" || l.Items[1].Link.Text != "bodymatter" {
+		t.Errorf("landmarks: %+v", l)
+	}
+	if len(got.NCX.NavPoints) != 1 || len(got.Guide.References) != 3 {
+		t.Errorf("NCX or guide dropped: %+v %+v", got.NCX, got.Guide)
+	}
+
+	if err := got.Upgrade(); err != nil || len(got.Manifest.Items) != len(rf.Manifest.Items) {
+		t.Errorf("upgrading an EPUB 3 package changed it: %v", err)
+	}
+}
+
+func TestUpgradeSchemesAndEvents(t *testing.T) {
+	r, err := OpenReader("_test_files/alice.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	rf := r.DefaultRendition()
+	rf.Metadata.Event = append(rf.Metadata.Event, Date{Name: "creation", Date: "2009-01-01"})
+	if err := rf.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	md := rewrite(t, &r.Reader).Metadata
+
+	want := MetaTag{Refines: "#id", Property: "identifier-type", InnerXML: "URI"}
+	if !slices.Contains(md.Refinements, want) {
+		t.Errorf("identifier-type: %+v", md.Refinements)
+	}
+	// conversion has no DCMI term.
+	if v := md.OtherTags["dcterms:created"]; len(v) != 1 || v[0] != "2009-01-01" || md.OtherTags["dcterms:conversion"] != nil {
+		t.Errorf("events: %v", md.OtherTags)
+	}
+	if len(md.Event) != 1 || md.Event[0].Date != "2009-05-19" {
+		t.Errorf("dates: %+v", md.Event)
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	src := testWriterRootfile("3.0")
+	src.Metadata.CoverManifestId = ""
+	src.Metadata.Identifier = []Identifier{{Value: "urn:isbn:9780000000002"}}
+	src.Spine.Toc = ""
+	// The toc lists ch1 first, but ch2 comes first in reading order.
+	src.Spine.Itemrefs = []SpineItem{{IDREF: "ch2", SpineProperties: "page-spread-left"}, {IDREF: "ch1"}}
+	src.Manifest.Items = []ManifestItem{
+		{ID: "nav", HREF: "text/nav.xhtml", MediaType: MediaTypeXHTML, Properties: "nav"},
+		{ID: "ch1", HREF: "ch1.xhtml", MediaType: MediaTypeXHTML, Properties: "scripted"},
+		{ID: "ch2", HREF: "ch2.xhtml", MediaType: MediaTypeXHTML},
+		{ID: "cover", HREF: "cover.png", MediaType: MediaTypePNG, Properties: "cover-image"},
+		{ID: "clip", HREF: "clip.mp3", MediaType: MediaTypeMP3},
+	}
+	link := func(text, href, typ string) NavItem {
+		var item NavItem
+		item.Link.Text, item.Link.Href, item.Link.Type = text, href, typ
+		return item
+	}
+	part := link("Part I", "", "")
+	part.SubItems = []NavItem{link("One", "../ch1.xhtml", ""), link("Two", "../ch2.xhtml#s", "")}
+	src.NavDoc.Navs = []NavSection{
+		{Type: "toc", Items: []NavItem{part, link("Again", "../ch1.xhtml", "")}},
+		{Type: "landmarks", Items: []NavItem{link("Start", "../ch1.xhtml", "bodymatter"), link("Other", "../ch2.xhtml", "other")}},
+	}
+	var nav bytes.Buffer
+	if err := src.WriteNav(&nav); err != nil {
+		t.Fatal(err)
+	}
+	r := writeTestEpub(t, src, map[string]string{
+		"OEBPS/text/nav.xhtml": nav.String(),
+		"OEBPS/ch1.xhtml":      `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Hi</p></body></html>`,
+		"OEBPS/ch2.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><p id="s">` +
+			`<math xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math></p><video src="v.mp4"/></body></html>`,
+		"OEBPS/cover.png": "png",
+		"OEBPS/clip.mp3":  "mp3",
+	})
+
+	rf := r.DefaultRendition()
+	issues, err := rf.Downgrade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIssues := []DowngradeIssue{
+		{ItemID: "ch1", HREF: "ch1.xhtml", Feature: "scripted"},
+		{ItemID: "ch2", HREF: "ch2.xhtml", Feature: "video"},
+		{ItemID: "ch2", HREF: "ch2.xhtml", Feature: "mathml"},
+		{ItemID: "clip", HREF: "clip.mp3", Feature: "audio"},
+	}
+	if !slices.Equal(issues, wantIssues) {
+		t.Errorf("issues: "+expFormat, wantIssues, issues)
+	}
+
+	got := rewrite(t, r)
+	md := got.Metadata
+	if id := md.Identifier[0]; got.Version != "2.0" || md.CoverManifestId != "cover" || id.Scheme != "ISBN" || id.Value != "9780000000002" {
+		t.Errorf("package: %q %q %+v", got.Version, md.CoverManifestId, md.Identifier)
+	}
+	if c := md.Creator[0]; c.FileAs != "Doe, Jane" || c.CreatorRole != "aut" {
+		t.Errorf("creator: %+v", c)
+	}
+	if !slices.Contains(md.Event, Date{Name: "modification", Date: "2024-01-02T03:04:05Z"}) {
+		t.Errorf("events: %+v", md.Event)
+	}
+	for _, item := range got.Manifest.Items {
+		if item.Properties != "" {
+			t.Errorf("%s kept properties %q", item.ID, item.Properties)
+		}
+	}
+	if got.Spine.Toc != "ncx" || got.Spine.Itemrefs[0].SpineProperties != "" {
+		t.Errorf("spine: %+v", got.Spine)
+	}
+	var ncx []string
+	for _, np := range got.NCX.Walk() {
+		ncx = append(ncx, np.NavLabel.Text+"="+np.Content.Src+"@"+strconv.Itoa(np.PlayOrder))
+	}
+	wantNCX := []string{"One=ch1.xhtml@2", "Two=ch2.xhtml#s@1", "Again=ch1.xhtml@2"}
+	if !slices.Equal(ncx, wantNCX) {
+		t.Errorf("ncx: "+expFormat, wantNCX, ncx)
+	}
+	wantGuide := []GuideReference{{Type: "text", Title: "Start", Href: "ch1.xhtml"}}
+	if !slices.Equal(got.Guide.References, wantGuide) {
+		t.Errorf("guide: "+expFormat, wantGuide, got.Guide.References)
+	}
+}
@@ -0,0 +1,193 @@
+package gopub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Writer writes an EPUB container: the stored mimetype entry first, then
+// the entries added by the caller, then META-INF/container.xml listing the
+// rootfiles on Close.
+type Writer struct {
+	zw        *zip.Writer
+	rootfiles []string
+	names     map[string]bool
+	err       error
+}
+
+// NewWriter returns a Writer writing an EPUB to w.
+func NewWriter(w io.Writer) *Writer {
+	ew := &Writer{zw: zip.NewWriter(w), names: make(map[string]bool)}
+	f, err := ew.zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err == nil {
+		_, err = io.WriteString(f, MediaTypeEPUB)
+	}
+	ew.err = err
+	ew.names["mimetype"] = true
+	return ew
+}
+
+// Create adds a compressed entry with the given slash-separated name and
+// returns a writer for its contents, valid until the next call on w. Names
+// must be relative, clean and unique; ErrUnsafePath and ErrDuplicateEntry
+// are returned otherwise.
+func (w *Writer) Create(name string) (io.Writer, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	if err := w.reserve(name); err != nil {
+		return nil, err
+	}
+	return w.zw.Create(name)
+}
+
+// WriteFile adds an entry holding data.
+func (w *Writer) WriteFile(name string, data []byte) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// CopyFile copies the ZIP entry f from another archive without
+// recompressing it.
+func (w *Writer) CopyFile(f *zip.File) error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.reserve(f.Name); err != nil {
+		return err
+	}
+	return w.zw.Copy(f)
+}
+
+// AddRootfile writes rf's package document to rf.FullPath and lists it in
+// the container. The content it references must be added separately.
+func (w *Writer) AddRootfile(rf *Rootfile) error {
+	f, err := w.Create(rf.FullPath)
+	if err != nil {
+		return err
+	}
+	if err := rf.WritePackage(f); err != nil {
+		return err
+	}
+	w.rootfiles = append(w.rootfiles, rf.FullPath)
+	return nil
+}
+
+// CopyRootfile copies the package document f from another archive
+// unchanged and lists it in the container.
+func (w *Writer) CopyRootfile(f *zip.File) error {
+	if err := w.CopyFile(f); err != nil {
+		return err
+	}
+	w.rootfiles = append(w.rootfiles, f.Name)
+	return nil
+}
+
+// Close writes the container document and finishes the archive. It does
+// not close the underlying writer. It returns ErrNoRootfile if no rootfile
+// was added.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.rootfiles) == 0 {
+		return ErrNoRootfile
+	}
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+`)
+	for _, name := range w.rootfiles {
+		b.WriteString(`    <rootfile full-path="`)
+		xml.EscapeText(&b, []byte(name))
+		b.WriteString(`" media-type="` + MediaTypeOEBPS + `"/>` + "\n")
+	}
+	b.WriteString("  </rootfiles>\n</container>\n")
+	if err := w.WriteFile(containerPath, []byte(b.String())); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// Rewrite writes the book read by r to w with its package documents
+// serialized from r's Rootfiles, keeping changes made to them such as by
+// Upgrade or Downgrade. Navigation documents and NCX files listed in a
+// manifest without a file in the archive are generated from NavDoc and
+// NCX, replacing unlisted entries of the same name; every other entry is
+// copied unchanged.
+func Rewrite(w io.Writer, r *Reader) error {
+	skip := map[string]bool{"mimetype": true, containerPath: true}
+	type generated struct {
+		name  string
+		write func(io.Writer) error
+	}
+	var gen []generated
+	for _, rf := range r.Rootfiles {
+		if err := rf.Load(); err != nil {
+			return err
+		}
+		skip[rf.FullPath] = true
+		for _, item := range rf.Manifest.Items {
+			var write func(io.Writer) error
+			switch {
+			case item.F != nil:
+				continue
+			case hasProperty(item.Properties, "nav"):
+				write = rf.WriteNav
+			case item.MediaType == MediaTypeNCX:
+				write = rf.WriteNCX
+			default:
+				continue
+			}
+			href, _ := url.PathUnescape(item.HREF)
+			name := path.Join(path.Dir(rf.FullPath), href)
+			skip[name] = true
+			gen = append(gen, generated{name, write})
+		}
+	}
+
+	ew := NewWriter(w)
+	for f := range r.Files() {
+		if skip[f.Name] || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if err := ew.CopyFile(f); err != nil {
+			return err
+		}
+	}
+	for _, g := range gen {
+		f, err := ew.Create(g.name)
+		if err != nil {
+			return err
+		}
+		if err := g.write(f); err != nil {
+			return err
+		}
+	}
+	for _, rf := range r.Rootfiles {
+		if err := ew.AddRootfile(rf); err != nil {
+			return err
+		}
+	}
+	return ew.Close()
+}
+
+func (w *Writer) reserve(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return ErrUnsafePath
+	}
+	if w.names[name] {
+		return ErrDuplicateEntry
+	}
+	w.names[name] = true
+	return nil
+}
@@ -0,0 +1,252 @@
+package gopub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testWriterRootfile(version string) *Rootfile {
+	rf := &Rootfile{FullPath: "OEBPS/content.opf"}
+	rf.Version = version
+	rf.UniqueIdentifier = "bookid"
+	rf.Metadata = Metadata{
+		Title:      []Title{{Refinable: Refinable{Name: "Written & Read"}, TitleType: "main"}},
+		Language:   []string{"en"},
+		Identifier: []Identifier{{Scheme: "ISBN", Value: "9780000000002"}},
+		Creator: []Creator{{
+			Refinable:   Refinable{Name: "Jane Doe", FileAs: "Doe, Jane"},
+			CreatorRole: "aut",
+		}},
+		Event:           []Date{{Date: "2020-01-01"}},
+		CoverManifestId: "cover",
+		Modified:        "2024-01-02T03:04:05Z",
+		Series:          "Saga",
+		SeriesIndex:     "2",
+		OtherTags:       map[string][]string{"generator": {"test"}, "rendition:layout": {"reflowable"}},
+	}
+	rf.Manifest.Items = []ManifestItem{
+		{ID: "nav", HREF: "nav.xhtml", MediaType: MediaTypeXHTML, Properties: "nav"},
+		{ID: "ncx", HREF: "toc.ncx", MediaType: MediaTypeNCX},
+		{ID: "ch1", HREF: "ch1.xhtml", MediaType: MediaTypeXHTML},
+		{ID: "cover", HREF: "cover.png", MediaType: MediaTypePNG, Properties: "cover-image"},
+	}
+	rf.Spine = Spine{Toc: "ncx", Itemrefs: []SpineItem{{IDREF: "ch1"}}}
+	var item NavItem
+	item.Link.Href = "ch1.xhtml"
+	item.Link.Text = "Chapter 1"
+	rf.NavDoc.Navs = []NavSection{{Type: "toc", Items: []NavItem{item}}}
+	var point NavPoint
+	point.NavLabel.Text = "Chapter 1"
+	point.Content.Src = "ch1.xhtml"
+	rf.NCX.NavPoints = []NavPoint{point, point}
+	return rf
+}
+
+// writeTestEpub writes rf with files and reads it back. The nav document
+// and NCX are generated from rf unless files holds them.
+func writeTestEpub(t *testing.T, rf *Rootfile, files map[string]string) *Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for name, content := range files {
+		if err := w.WriteFile(name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, write := range map[string]func(*bytes.Buffer) error{
+		"OEBPS/nav.xhtml": func(b *bytes.Buffer) error { return rf.WriteNav(b) },
+		"OEBPS/toc.ncx":   func(b *bytes.Buffer) error { return rf.WriteNCX(b) },
+	} {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		var b bytes.Buffer
+		if err := write(&b); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteFile(name, b.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddRootfile(rf); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if first := buf.Bytes()[30:38]; string(first) != "mimetype" {
+		t.Errorf("first entry: "+expFormat, "mimetype", string(first))
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, version := range []string{"3.0", "2.0"} {
+		t.Run(version, func(t *testing.T) {
+			got := writeTestEpub(t, testWriterRootfile(version), map[string]string{
+				"OEBPS/ch1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Hi</p></body></html>`,
+				"OEBPS/cover.png": "png",
+			}).DefaultRendition()
+			md := got.Metadata
+			if got.Version != version || got.UniqueIdentifier != "bookid" || md.Identifier[0].ID != "bookid" {
+				t.Errorf("package: %q %q %+v", got.Version, got.UniqueIdentifier, md.Identifier)
+			}
+			c := md.Creator[0]
+			if c.Name != "Jane Doe" || c.FileAs != "Doe, Jane" || c.CreatorRole != "aut" {
+				t.Errorf("creator: %+v", c)
+			}
+			if md.MainTitle().Name != "Written & Read" || md.CoverManifestId != "cover" || md.Event[0].Date != "2020-01-01" {
+				t.Errorf("metadata: %+v", md)
+			}
+			if md.OtherTags["generator"][0] != "test" {
+				t.Errorf("generator: %v", md.OtherTags)
+			}
+			if version == "3.0" {
+				if md.Modified != "2024-01-02T03:04:05Z" || md.Series != "Saga" || md.SeriesIndex != "2" {
+					t.Errorf("epub 3 metas: %q %q %q", md.Modified, md.Series, md.SeriesIndex)
+				}
+				if got.Manifest.Items[0].Properties != "nav" || got.TOCNav() == nil || got.TOCNav().Items[0].Link.Text != "Chapter 1" {
+					t.Errorf("nav not written: %+v", got.NavDoc)
+				}
+			} else {
+				if md.Identifier[0].Scheme != "ISBN" || md.OtherTags["calibre:series"][0] != "Saga" {
+					t.Errorf("epub 2 metas: %+v", md)
+				}
+				if got.Manifest.Items[0].Properties != "" {
+					t.Errorf("properties written to EPUB 2 package")
+				}
+			}
+			points := got.NCX.NavPoints
+			if len(points) != 2 || points[0].PlayOrder != 1 || points[1].PlayOrder != 1 || points[0].ID == points[1].ID {
+				t.Errorf("ncx: %+v", points)
+			}
+		})
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	for name, want := range map[string]error{
+		"mimetype":    ErrDuplicateEntry,
+		"../x":        ErrUnsafePath,
+		"/abs":        ErrUnsafePath,
+		"a/./b":       ErrUnsafePath,
+		"OEBPS/a.css": nil,
+	} {
+		if _, err := w.Create(name); !errors.Is(err, want) {
+			t.Errorf("%s: "+expFormat, name, want, err)
+		}
+	}
+	if err := w.Close(); !errors.Is(err, ErrNoRootfile) {
+		t.Errorf(expFormat, ErrNoRootfile, err)
+	}
+}
+
+func TestWritePackage(t *testing.T) {
+	var b strings.Builder
+	if err := testWriterRootfile("3.0").WritePackage(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<dc:title id="title-1">Written &amp; Read</dc:title>`,
+		`<meta refines="#creator-1" property="role" scheme="marc:relators">aut</meta>`,
+		`<meta property="rendition:layout">reflowable</meta>`,
+		`<meta name="generator" content="test"/>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("package missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWritePackageRefinements(t *testing.T) {
+	const opf = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="isbn">9780000000002</dc:identifier>
+    <meta refines="#isbn" property="identifier-type" scheme="onix:codelist5">15</meta>
+    <dc:title id="t" xml:lang="ja" dir="ltr">吾輩は猫である</dc:title>
+    <meta refines="#t" property="alternate-script" xml:lang="en">I Am a Cat</meta>
+    <dc:creator id="c">夏目漱石</dc:creator>
+    <meta refines="#c" property="role" scheme="marc:relators">aut</meta>
+    <meta refines="#c" property="alternate-script" xml:lang="en" id="alt">Natsume Sōseki</meta>
+    <meta refines="#alt" property="meta-auth">https://example.com/</meta>
+    <meta refines="#gone" property="alternate-script">Dropped</meta>
+    <dc:language>ja</dc:language>
+  </metadata>
+  <manifest><item id="ch" href="ch.xhtml" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="ch"/></spine>
+</package>`
+	r := openTestEpub(t, map[string]string{"OEBPS/content.opf": opf, "OEBPS/ch.xhtml": "<html/>"})
+	rf := r.DefaultRendition()
+	if n := len(rf.Metadata.Refinements); n != 5 {
+		t.Errorf("refinements: "+expFormat, 5, n)
+	}
+
+	var b strings.Builder
+	if err := rf.WritePackage(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`<dc:identifier id="uid">9780000000002</dc:identifier>`,
+		`<meta refines="#uid" property="identifier-type" scheme="onix:codelist5">15</meta>`,
+		`<dc:title id="t" xml:lang="ja" dir="ltr">吾輩は猫である</dc:title>`,
+		`<meta refines="#t" property="alternate-script" xml:lang="en">I Am a Cat</meta>`,
+		`<meta id="alt" refines="#c" property="alternate-script" xml:lang="en">Natsume Sōseki</meta>`,
+		`<meta refines="#alt" property="meta-auth">https://example.com/</meta>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("package missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Dropped") {
+		t.Errorf("refinement of a missing element written:\n%s", out)
+	}
+}
+
+func TestWriteNCX(t *testing.T) {
+	point := func(src string, order int) NavPoint {
+		var np NavPoint
+		np.NavLabel.Text = src
+		np.Content.Src = src
+		np.PlayOrder = order
+		return np
+	}
+	for _, tc := range []struct {
+		name   string
+		points []NavPoint
+		want   []int
+	}{
+		{"kept", []NavPoint{point("b.xhtml", 2), point("a.xhtml", 1), point("b.xhtml", 2)}, []int{2, 1, 2}},
+		{"renumbered", []NavPoint{point("b.xhtml", 2), point("a.xhtml", 0), point("b.xhtml", 5)}, []int{1, 2, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rf := testWriterRootfile("2.0")
+			rf.NCX.NavPoints = tc.points
+			var b bytes.Buffer
+			if err := rf.WriteNCX(&b); err != nil {
+				t.Fatal(err)
+			}
+			var got NCX
+			if err := xml.Unmarshal(b.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			var orders []int
+			for _, np := range got.Walk() {
+				orders = append(orders, np.PlayOrder)
+			}
+			if !slices.Equal(orders, tc.want) {
+				t.Errorf(expFormat, tc.want, orders)
+			}
+		})
+	}
+}